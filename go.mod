@@ -5,6 +5,8 @@ go 1.23.6
 require (
 	gioui.org v0.8.0
 	github.com/spf13/cobra v1.8.0
+	golang.org/x/net v0.27.0
+	golang.org/x/text v0.16.0
 )
 
 require (
@@ -16,5 +18,4 @@ require (
 	golang.org/x/exp/shiny v0.0.0-20240707233637-46b078467d37 // indirect
 	golang.org/x/image v0.18.0 // indirect
 	golang.org/x/sys v0.22.0 // indirect
-	golang.org/x/text v0.16.0 // indirect
 )
@@ -0,0 +1,163 @@
+package browser
+
+import (
+	"context"
+	"fmt"
+	"html"
+	"net/http"
+	"runtime"
+	"strings"
+	"time"
+)
+
+// aboutHandler serves the built-in about: pages from engine state.
+type aboutHandler struct {
+	engine *engine
+}
+
+func newAboutHandler(e *engine) SchemeHandler {
+	return &aboutHandler{engine: e}
+}
+
+func (ah *aboutHandler) Load(ctx context.Context, req *FetchRequest) (*Response, error) {
+	name := strings.TrimPrefix(req.URL, urlScheme(req.URL)+":")
+	if cut := strings.IndexAny(name, "?#"); cut >= 0 {
+		name = name[:cut]
+	}
+
+	var content string
+	switch strings.ToLower(name) {
+	case "blank":
+		content = "<!DOCTYPE html>\n<html>\n<head>\n<title>about:blank</title>\n</head>\n<body>\n</body>\n</html>\n"
+	case "version":
+		content = ah.renderVersionPage()
+	case "history":
+		content = renderHistoryPage(ah.engine.history.Entries())
+	case "cache":
+		content = renderCachePage(ah.engine.apiHandler.GetCache())
+	case "downloads":
+		content = renderDownloadsPage(ah.engine.downloads.List())
+	default:
+		return nil, NewBrowserErrorWithContext(ErrFileNotFound, "unknown about page", req.URL)
+	}
+
+	header := http.Header{}
+	header.Set("Content-Type", "text/html; charset=utf-8")
+	return NewResponse(req.URL, req.URL, http.StatusOK, header, []byte(content)), nil
+}
+
+func (ah *aboutHandler) renderVersionPage() string {
+	e := ah.engine
+
+	rows := [][2]string{
+		{"Version", e.appVersion},
+		{"User agent", DefaultUserAgent},
+		{"Go", runtime.Version()},
+		{"Platform", runtime.GOOS + "/" + runtime.GOARCH},
+		{"Profile", e.profileDir},
+		{"Schemes", strings.Join(append([]string{"http", "https"}, e.apiHandler.GetSchemeRegistry().Schemes()...), ", ")},
+	}
+
+	var page strings.Builder
+	writeAboutHeader(&page, e.appName)
+	page.WriteString("<table>\n")
+	for _, row := range rows {
+		value := row[1]
+		if value == "" {
+			value = "(none)"
+		}
+		fmt.Fprintf(&page, "<tr><td><b>%s</b></td><td>%s</td></tr>\n", html.EscapeString(row[0]), html.EscapeString(value))
+	}
+	page.WriteString("</table>\n</body>\n</html>\n")
+	return page.String()
+}
+
+func renderHistoryPage(entries []HistoryEntry) string {
+	var page strings.Builder
+	writeAboutHeader(&page, "History")
+
+	if len(entries) == 0 {
+		page.WriteString("<p>No pages have been visited yet.</p>\n")
+	}
+
+	page.WriteString("<ul>\n")
+	for i := len(entries) - 1; i >= 0; i-- {
+		entry := entries[i]
+		title := entry.Title
+		if title == "" {
+			title = entry.URL
+		}
+		fmt.Fprintf(&page, "<li><small>%s</small> <a href=\"%s\">%s</a></li>\n",
+			entry.VisitedAt.Format(DirectoryListingTimeFormat), html.EscapeString(entry.URL), html.EscapeString(title))
+	}
+	page.WriteString("</ul>\n</body>\n</html>\n")
+	return page.String()
+}
+
+func renderCachePage(cache HTTPCache) string {
+	var page strings.Builder
+	writeAboutHeader(&page, "Cache")
+
+	if cache == nil {
+		page.WriteString("<p>The HTTP cache is disabled.</p>\n</body>\n</html>\n")
+		return page.String()
+	}
+
+	entries := cache.Entries()
+	totalSize := 0
+	for _, entry := range entries {
+		totalSize += len(entry.Body)
+	}
+	fmt.Fprintf(&page, "<p>%d entries, %d bytes</p>\n", len(entries), totalSize)
+
+	now := time.Now()
+	page.WriteString("<table>\n<tr><th>URL</th><th>Status</th><th>Type</th><th>Size</th><th>State</th></tr>\n")
+	for _, entry := range entries {
+		state := "stale"
+		if entry.IsFresh(now) {
+			state = "fresh"
+		}
+		fmt.Fprintf(&page, "<tr><td><a href=\"%s\">%s</a></td><td>%d</td><td>%s</td><td>%d</td><td>%s</td></tr>\n",
+			html.EscapeString(entry.URL), html.EscapeString(entry.URL), entry.StatusCode,
+			html.EscapeString(entry.Header.Get("Content-Type")), len(entry.Body), state)
+	}
+	page.WriteString("</table>\n</body>\n</html>\n")
+	return page.String()
+}
+
+func renderDownloadsPage(downloads []Download) string {
+	var page strings.Builder
+	writeAboutHeader(&page, "Downloads")
+
+	if len(downloads) == 0 {
+		page.WriteString("<p>Nothing has been downloaded yet.</p>\n</body>\n</html>\n")
+		return page.String()
+	}
+
+	page.WriteString("<table>\n<tr><th>File</th><th>From</th><th>State</th><th>Received</th><th>Started</th></tr>\n")
+	for i := len(downloads) - 1; i >= 0; i-- {
+		download := downloads[i]
+
+		received := fmt.Sprintf("%d bytes", download.ReceivedBytes)
+		if download.TotalBytes >= 0 {
+			received = fmt.Sprintf("%d of %d bytes", download.ReceivedBytes, download.TotalBytes)
+		}
+		state := download.State.String()
+		if download.Error != "" {
+			state += ": " + download.Error
+		}
+
+		fmt.Fprintf(&page, "<tr><td>%s</td><td><a href=\"%s\">%s</a></td><td>%s</td><td>%s</td><td>%s</td></tr>\n",
+			html.EscapeString(download.Path), html.EscapeString(download.URL), html.EscapeString(download.URL),
+			html.EscapeString(state), received, download.StartedAt.Format(DirectoryListingTimeFormat))
+	}
+	page.WriteString("</table>\n</body>\n</html>\n")
+	return page.String()
+}
+
+func writeAboutHeader(page *strings.Builder, title string) {
+	page.WriteString("<!DOCTYPE html>\n<html>\n<head>\n")
+	fmt.Fprintf(page, "<title>%s</title>\n", html.EscapeString(title))
+	page.WriteString("</head>\n<body>\n")
+	fmt.Fprintf(page, "<h1>%s</h1>\n", html.EscapeString(title))
+}
@@ -0,0 +1,147 @@
+package browser
+
+import (
+	"bytes"
+	"strings"
+	"unicode/utf8"
+
+	"golang.org/x/text/encoding/htmlindex"
+)
+
+type CharsetDecoder interface {
+	// DetectCharset picks the encoding of body: a byte order mark wins, then
+	// the charset declared by the Content-Type header, then (for HTML) a
+	// <meta> declaration near the start of the document.
+	DetectCharset(body []byte, declared string, isHTML bool) string
+	DecodeToUTF8(body []byte, charset string) (string, error)
+}
+
+type charsetDecoder struct{}
+
+func NewCharsetDecoder() CharsetDecoder {
+	return &charsetDecoder{}
+}
+
+var byteOrderMarks = []struct {
+	mark    []byte
+	charset string
+}{
+	{[]byte{0xEF, 0xBB, 0xBF}, "utf-8"},
+	{[]byte{0xFE, 0xFF}, "utf-16be"},
+	{[]byte{0xFF, 0xFE}, "utf-16le"},
+}
+
+func (cd *charsetDecoder) DetectCharset(body []byte, declared string, isHTML bool) string {
+	if charset := cd.detectBOM(body); charset != "" {
+		return charset
+	}
+
+	if charset := cd.canonicalName(declared); charset != "" {
+		return charset
+	}
+
+	if isHTML {
+		if charset := cd.canonicalName(cd.prescanMeta(body)); charset != "" {
+			// A document cannot declare itself UTF-16 from inside ASCII-compatible markup
+			if strings.HasPrefix(charset, "utf-16") {
+				return DefaultCharset
+			}
+			return charset
+		}
+	}
+
+	if utf8.Valid(body) {
+		return DefaultCharset
+	}
+	return FallbackCharset
+}
+
+func (cd *charsetDecoder) DecodeToUTF8(body []byte, charset string) (string, error) {
+	body = cd.stripBOM(body, charset)
+
+	if charset == "" || charset == DefaultCharset {
+		return string(body), nil
+	}
+
+	enc, err := htmlindex.Get(charset)
+	if err != nil {
+		return "", NewBrowserErrorWithContext(ErrUnsupportedContent, "unknown character encoding", charset)
+	}
+
+	decoded, err := enc.NewDecoder().Bytes(body)
+	if err != nil {
+		return "", NewBrowserErrorWithContext(ErrParsingFailed, "failed to decode "+charset+" content: "+err.Error(), charset)
+	}
+
+	return string(decoded), nil
+}
+
+func (cd *charsetDecoder) detectBOM(body []byte) string {
+	for _, bom := range byteOrderMarks {
+		if bytes.HasPrefix(body, bom.mark) {
+			return bom.charset
+		}
+	}
+	return ""
+}
+
+func (cd *charsetDecoder) stripBOM(body []byte, charset string) []byte {
+	for _, bom := range byteOrderMarks {
+		if bom.charset == charset && bytes.HasPrefix(body, bom.mark) {
+			return body[len(bom.mark):]
+		}
+	}
+	return body
+}
+
+// canonicalName maps a charset label such as "latin1" or "SJIS" to its WHATWG
+// encoding name, or returns "" when the label is unknown.
+func (cd *charsetDecoder) canonicalName(label string) string {
+	label = strings.TrimSpace(label)
+	if label == "" {
+		return ""
+	}
+
+	enc, err := htmlindex.Get(label)
+	if err != nil {
+		return ""
+	}
+
+	name, err := htmlindex.Name(enc)
+	if err != nil {
+		return ""
+	}
+	return name
+}
+
+// prescanMeta looks for <meta charset> or <meta http-equiv="Content-Type">
+// in the first bytes of an HTML document.
+func (cd *charsetDecoder) prescanMeta(body []byte) string {
+	if len(body) > CharsetPrescanLength {
+		body = body[:CharsetPrescanLength]
+	}
+
+	tokenizer := NewTokenizer(string(body))
+	for tokenizer.HasMore() {
+		token, err := tokenizer.NextToken()
+		if err != nil || token.Type == TokenTypeEOF {
+			break
+		}
+
+		if token.Tag != "meta" || (token.Type != TokenTypeStartTag && token.Type != TokenTypeSelfClosingTag) {
+			continue
+		}
+
+		if charset := token.Attributes["charset"]; charset != "" {
+			return charset
+		}
+
+		if strings.EqualFold(token.Attributes["http-equiv"], "content-type") {
+			if _, charset := parseContentType(token.Attributes["content"]); charset != "" {
+				return charset
+			}
+		}
+	}
+
+	return ""
+}
@@ -7,8 +7,71 @@ const (
 
 	IDByteLength             = 8
 	MaxConcurrentConnections = 10
+	MaxConnectionsPerHost    = 6
 	DefaultTimeout           = 30 * time.Second
 	KeepAliveTimeout         = 30 * time.Second
+	MaxRedirects             = 10
+
+	MaxFileSize                = 50 << 20 // 50 MiB
+	DirectoryListingTimeFormat = "2006-01-02 15:04"
+
+	DefaultDataURLMediaType = "text/plain"
+	DefaultDataURLCharset   = "us-ascii"
+
+	DefaultCharset       = "utf-8"
+	FallbackCharset      = "windows-1252"
+	CharsetPrescanLength = 1024
+
+	MaxMemoryCacheSize        = 64 << 20 // 64 MiB
+	MaxCacheEntrySize         = 8 << 20  // 8 MiB
+	HeuristicFreshnessDivisor = 10
+	MaxHeuristicFreshness     = 24 * time.Hour
+
+	DefaultRetryAttempts = 3
+	RetryBaseDelay       = 250 * time.Millisecond
+	RetryMaxDelay        = 5 * time.Second
+	MaxRetryAfterDelay   = 30 * time.Second
+	MaxRetryDrainSize    = 64 << 10 // 64 KiB
+
+	// MaxReferrerLength is the longest Referer sent before falling back to
+	// the referrer's origin
+	MaxReferrerLength = 4096
+
+	// MaxRefreshDelay is the longest Refresh delay honoured, in seconds
+	MaxRefreshDelay       = 24 * 60 * 60
+	MinReloadRefreshDelay = time.Second
+
+	MaxQueuedHints        = 64
+	MaxConcurrentHints    = 2
+	MaxPreconnectsPerHost = 2
+	PreconnectIdleTimeout = 10 * time.Second
+	// PreloadLifetime is how long a preloaded response waits to be used
+	PreloadLifetime     = 5 * time.Minute
+	MaxPreloadCacheSize = 16 << 20 // 16 MiB
+
+	// MaxHARBodySize is the most of a response body a HAR recording keeps
+	MaxHARBodySize = 8 << 20 // 8 MiB
+
+	CookieFileName      = "cookies.json"
+	ProxyConfigFileName = "proxy.json"
+	HSTSFileName        = "hsts.json"
+	DownloadsFileName   = "downloads.json"
+	HSTSPreloadFileName = "hsts_preload.json"
+	MaxHSTSMaxAge       = 365 * 24 * time.Hour
+
+	FilterListDirName   = "filters"
+	FilterListExtension = ".txt"
+	AllowlistFileName   = "content_blocking_allowlist.json"
+
+	DefaultDownloadDirName   = "Downloads"
+	DefaultDownloadName      = "download"
+	DownloadPartialExtension = ".part"
+	DownloadBufferSize       = 32 << 10 // 32 KiB
+	MaxDownloadNameLength    = 200
+
+	DefaultAppName    = "GoBrowser"
+	DefaultAppVersion = "dev"
+	MaxHistoryEntries = 1000
 )
 
 // Layout and Typography
@@ -137,6 +200,17 @@ const (
 	ValueTransparent = "transparent"
 )
 
+// View-source highlighting colours
+const (
+	ViewSourceLineNumberColor = "#999999"
+	ViewSourceTagColor        = "#881280"
+	ViewSourceAttrNameColor   = "#994500"
+	ViewSourceAttrValueColor  = "#1A1AA6"
+	ViewSourceCommentColor    = "#236E25"
+	ViewSourceDoctypeColor    = "#808080"
+	ViewSourceTabWidth        = 4
+)
+
 // Color Parsing Constants
 const (
 	HexColorShortLength = 3 // #RGB
@@ -0,0 +1,332 @@
+package browser
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// ContentBlocker blocks requests and hides page elements using Adblock Plus
+// filter lists. It is a RequestInterceptor, so it blocks requests before
+// they reach the network.
+type ContentBlocker interface {
+	RequestInterceptor
+	LoadFilterList(path string) error
+	AddFilters(list string) error
+	RuleCount() int
+	ShouldBlock(req *FetchRequest) bool
+	// ElementHidingCSS returns a stylesheet hiding the elements matched by
+	// the hiding rules that apply to pageURL.
+	ElementHidingCSS(pageURL string) string
+	BlockedCount(tabID string) int
+	ResetBlockedCount(tabID string)
+	AllowSite(pageURL string)
+	DisallowSite(pageURL string)
+	IsSiteAllowed(pageURL string) bool
+	AllowedSites() []string
+	// Save writes the allowlist to disk.
+	Save() error
+}
+
+// filterRuleSet indexes network rules by the host they are anchored to, so
+// most rules are never tested against unrelated requests.
+type filterRuleSet struct {
+	byHost  map[string][]*filterRule
+	generic []*filterRule
+}
+
+func (rs *filterRuleSet) add(rule *filterRule) {
+	if rule.anchorHost != "" {
+		rs.byHost[rule.anchorHost] = append(rs.byHost[rule.anchorHost], rule)
+		return
+	}
+	rs.generic = append(rs.generic, rule)
+}
+
+func (rs *filterRuleSet) match(req *filterRequest, accept func(*filterRule) bool) *filterRule {
+	// ||example.com^ applies to example.com and all of its subdomains
+	for host := req.host; host != ""; {
+		for _, rule := range rs.byHost[host] {
+			if accept(rule) && rule.matches(req) {
+				return rule
+			}
+		}
+		dot := strings.Index(host, ".")
+		if dot < 0 {
+			break
+		}
+		host = host[dot+1:]
+	}
+
+	for _, rule := range rs.generic {
+		if accept(rule) && rule.matches(req) {
+			return rule
+		}
+	}
+	return nil
+}
+
+type contentBlocker struct {
+	blocking   filterRuleSet
+	exceptions filterRuleSet
+	hiding     []*hidingRule
+	ruleCount  int
+
+	// allowlist holds sites, as registrable domains, where nothing is blocked
+	allowlist map[string]bool
+	blocked   map[string]int
+	path      string
+	mutex     sync.RWMutex
+}
+
+// NewContentBlocker returns a blocker without any rules. Its allowlist is
+// loaded from and saved to path; an empty path keeps it in memory only.
+func NewContentBlocker(path string) (ContentBlocker, error) {
+	cb := &contentBlocker{
+		blocking:   filterRuleSet{byHost: make(map[string][]*filterRule)},
+		exceptions: filterRuleSet{byHost: make(map[string][]*filterRule)},
+		allowlist:  make(map[string]bool),
+		blocked:    make(map[string]int),
+		path:       path,
+	}
+
+	if path == "" {
+		return cb, nil
+	}
+	return cb, cb.load()
+}
+
+func (cb *contentBlocker) LoadFilterList(path string) error {
+	file, err := os.Open(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return NewBrowserErrorWithContext(ErrFileNotFound, "filter list does not exist", path)
+		}
+		return err
+	}
+	defer file.Close()
+
+	network, hiding, err := parseFilterList(file)
+	if err != nil {
+		return NewBrowserErrorWithContext(ErrParsingFailed, "failed to read filter list: "+err.Error(), path)
+	}
+
+	cb.addRules(network, hiding)
+	return nil
+}
+
+// AddFilters adds the rules of a filter list given as text.
+func (cb *contentBlocker) AddFilters(list string) error {
+	network, hiding, err := parseFilterList(strings.NewReader(list))
+	if err != nil {
+		return NewBrowserError(ErrParsingFailed, "failed to read filters: "+err.Error())
+	}
+
+	cb.addRules(network, hiding)
+	return nil
+}
+
+func (cb *contentBlocker) addRules(network []*filterRule, hiding []*hidingRule) {
+	cb.mutex.Lock()
+	defer cb.mutex.Unlock()
+
+	for _, rule := range network {
+		if rule.exception {
+			cb.exceptions.add(rule)
+		} else {
+			cb.blocking.add(rule)
+		}
+	}
+	cb.hiding = append(cb.hiding, hiding...)
+	cb.ruleCount += len(network) + len(hiding)
+}
+
+func (cb *contentBlocker) RuleCount() int {
+	cb.mutex.RLock()
+	defer cb.mutex.RUnlock()
+	return cb.ruleCount
+}
+
+func (cb *contentBlocker) Intercept(ctx context.Context, req *FetchRequest, next FetchFunc) (*Response, error) {
+	if cb.ShouldBlock(req) {
+		cb.mutex.Lock()
+		cb.blocked[req.TabID]++
+		cb.mutex.Unlock()
+		return nil, NewBrowserErrorWithContext(ErrRequestBlocked, "blocked by a content filter", req.URL)
+	}
+	return next(ctx, req)
+}
+
+func (cb *contentBlocker) ShouldBlock(req *FetchRequest) bool {
+	if scheme := urlScheme(req.URL); scheme != "http" && scheme != "https" {
+		return false
+	}
+
+	pageURL := req.FirstPartyURL
+	if pageURL == "" {
+		pageURL = req.URL
+	}
+
+	cb.mutex.RLock()
+	defer cb.mutex.RUnlock()
+
+	if cb.allowlist[registrableDomain(pageURL)] || cb.pageExceptedLocked(pageURL) {
+		return false
+	}
+
+	filterReq := &filterRequest{
+		url:        req.URL,
+		host:       hostOf(req.URL),
+		typ:        req.Type,
+		pageHost:   hostOf(pageURL),
+		thirdParty: req.FirstPartyURL != "" && registrableDomain(req.URL) != registrableDomain(req.FirstPartyURL),
+	}
+
+	anyRule := func(*filterRule) bool { return true }
+	if cb.blocking.match(filterReq, anyRule) == nil {
+		return false
+	}
+	return cb.exceptions.match(filterReq, anyRule) == nil
+}
+
+// pageExceptedLocked reports whether an @@...$document rule turns off
+// blocking for the whole page.
+func (cb *contentBlocker) pageExceptedLocked(pageURL string) bool {
+	pageReq := &filterRequest{
+		url:      pageURL,
+		host:     hostOf(pageURL),
+		typ:      RequestTypeDocument,
+		pageHost: hostOf(pageURL),
+	}
+	return cb.exceptions.match(pageReq, func(rule *filterRule) bool {
+		return rule.types[RequestTypeDocument]
+	}) != nil
+}
+
+func (cb *contentBlocker) ElementHidingCSS(pageURL string) string {
+	if scheme := urlScheme(pageURL); scheme != "http" && scheme != "https" {
+		return ""
+	}
+
+	cb.mutex.RLock()
+	defer cb.mutex.RUnlock()
+
+	if cb.allowlist[registrableDomain(pageURL)] || cb.pageExceptedLocked(pageURL) {
+		return ""
+	}
+
+	host := hostOf(pageURL)
+	excepted := make(map[string]bool)
+	for _, rule := range cb.hiding {
+		if rule.exception && rule.appliesTo(host) {
+			excepted[rule.selector] = true
+		}
+	}
+
+	var css strings.Builder
+	for _, rule := range cb.hiding {
+		if rule.exception || excepted[rule.selector] || !rule.appliesTo(host) {
+			continue
+		}
+		// Written once per selector so a single bad selector cannot hide
+		// the others
+		excepted[rule.selector] = true
+		css.WriteString(rule.selector)
+		css.WriteString(" { display: none; }\n")
+	}
+	return css.String()
+}
+
+func (cb *contentBlocker) BlockedCount(tabID string) int {
+	cb.mutex.RLock()
+	defer cb.mutex.RUnlock()
+	return cb.blocked[tabID]
+}
+
+func (cb *contentBlocker) ResetBlockedCount(tabID string) {
+	cb.mutex.Lock()
+	defer cb.mutex.Unlock()
+	delete(cb.blocked, tabID)
+}
+
+func (cb *contentBlocker) AllowSite(pageURL string) {
+	site := registrableDomain(pageURL)
+	if site == "" {
+		return
+	}
+
+	cb.mutex.Lock()
+	defer cb.mutex.Unlock()
+	cb.allowlist[site] = true
+}
+
+func (cb *contentBlocker) DisallowSite(pageURL string) {
+	cb.mutex.Lock()
+	defer cb.mutex.Unlock()
+	delete(cb.allowlist, registrableDomain(pageURL))
+}
+
+func (cb *contentBlocker) IsSiteAllowed(pageURL string) bool {
+	cb.mutex.RLock()
+	defer cb.mutex.RUnlock()
+	return cb.allowlist[registrableDomain(pageURL)]
+}
+
+func (cb *contentBlocker) AllowedSites() []string {
+	cb.mutex.RLock()
+	defer cb.mutex.RUnlock()
+
+	sites := make([]string, 0, len(cb.allowlist))
+	for site := range cb.allowlist {
+		sites = append(sites, site)
+	}
+	sort.Strings(sites)
+	return sites
+}
+
+func (cb *contentBlocker) Save() error {
+	if cb.path == "" {
+		return nil
+	}
+
+	data, err := json.MarshalIndent(cb.AllowedSites(), "", "  ")
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(cb.path), 0o700); err != nil {
+		return err
+	}
+
+	tmp := cb.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, cb.path)
+}
+
+func (cb *contentBlocker) load() error {
+	data, err := os.ReadFile(cb.path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+
+	var sites []string
+	if err := json.Unmarshal(data, &sites); err != nil {
+		return NewBrowserErrorWithContext(ErrParsingFailed, "invalid allowlist file: "+err.Error(), cb.path)
+	}
+
+	for _, site := range sites {
+		if site != "" {
+			cb.allowlist[strings.ToLower(site)] = true
+		}
+	}
+	return nil
+}
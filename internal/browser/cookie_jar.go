@@ -0,0 +1,514 @@
+package browser
+
+import (
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/net/publicsuffix"
+)
+
+// Cookie is a cookie as kept by the CookieJar (RFC 6265 section 5.3).
+type Cookie struct {
+	Name       string        `json:"name"`
+	Value      string        `json:"value"`
+	Domain     string        `json:"domain"`
+	Path       string        `json:"path"`
+	Expires    time.Time     `json:"expires"`
+	Persistent bool          `json:"persistent"`
+	HostOnly   bool          `json:"host_only"`
+	Secure     bool          `json:"secure"`
+	HttpOnly   bool          `json:"http_only"`
+	SameSite   http.SameSite `json:"same_site"`
+	Creation   time.Time     `json:"creation"`
+	LastAccess time.Time     `json:"last_access"`
+}
+
+func (c *Cookie) key() string {
+	return c.Name + ";" + c.Path
+}
+
+func (c *Cookie) expired(now time.Time) bool {
+	return c.Persistent && !c.Expires.After(now)
+}
+
+type CookieJar interface {
+	http.CookieJar
+	// ForSite returns a view of the jar for requests made by a document at
+	// firstPartyURL, which withholds SameSite=Lax and SameSite=Strict
+	// cookies from cross-site requests.
+	ForSite(firstPartyURL string) http.CookieJar
+	List(domain string) []*Cookie
+	Domains() []string
+	Delete(domain, path, name string) bool
+	ClearDomain(domain string) int
+	Clear()
+	// Save writes persistent cookies to the jar's file. Jars created without
+	// a path are never saved.
+	Save() error
+}
+
+type cookieJar struct {
+	path    string
+	entries map[string]map[string]*Cookie
+	mutex   sync.Mutex
+}
+
+// NewCookieJar creates a jar persisted at path, loading any cookies already
+// saved there. An empty path gives an in-memory jar.
+func NewCookieJar(path string) (CookieJar, error) {
+	jar := &cookieJar{
+		path:    path,
+		entries: make(map[string]map[string]*Cookie),
+	}
+
+	if path == "" {
+		return jar, nil
+	}
+
+	if err := jar.load(); err != nil {
+		return jar, err
+	}
+	return jar, nil
+}
+
+func (cj *cookieJar) SetCookies(u *url.URL, cookies []*http.Cookie) {
+	cj.setCookies(u, cookies, false)
+}
+
+func (cj *cookieJar) Cookies(u *url.URL) []*http.Cookie {
+	return cj.cookies(u, false)
+}
+
+func (cj *cookieJar) ForSite(firstPartyURL string) http.CookieJar {
+	return &siteCookieJar{jar: cj, site: registrableDomain(firstPartyURL)}
+}
+
+func (cj *cookieJar) setCookies(u *url.URL, cookies []*http.Cookie, crossSite bool) {
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return
+	}
+
+	host := canonicalCookieHost(u.Host)
+	secureOrigin := u.Scheme == "https"
+	now := time.Now()
+
+	cj.mutex.Lock()
+	defer cj.mutex.Unlock()
+
+	for _, httpCookie := range cookies {
+		cookie, remove, ok := cj.newCookie(httpCookie, u, host, secureOrigin, crossSite, now)
+		if !ok {
+			continue
+		}
+
+		domainCookies := cj.entries[cookie.Domain]
+		existing := domainCookies[cookie.key()]
+
+		// An insecure origin may not overwrite or delete a Secure cookie
+		if existing != nil && existing.Secure && !secureOrigin {
+			continue
+		}
+
+		if remove {
+			if existing != nil {
+				delete(domainCookies, cookie.key())
+			}
+			continue
+		}
+
+		if existing != nil {
+			cookie.Creation = existing.Creation
+		}
+		if domainCookies == nil {
+			domainCookies = make(map[string]*Cookie)
+			cj.entries[cookie.Domain] = domainCookies
+		}
+		domainCookies[cookie.key()] = cookie
+	}
+}
+
+// newCookie applies the storage model of RFC 6265 section 5.3 together with
+// the Secure and SameSite restrictions of its successor drafts. remove is set
+// when the cookie deletes an existing one.
+func (cj *cookieJar) newCookie(httpCookie *http.Cookie, u *url.URL, host string, secureOrigin, crossSite bool, now time.Time) (*Cookie, bool, bool) {
+	if httpCookie.Name == "" && httpCookie.Value == "" {
+		return nil, false, false
+	}
+
+	cookie := &Cookie{
+		Name:       httpCookie.Name,
+		Value:      httpCookie.Value,
+		Secure:     httpCookie.Secure,
+		HttpOnly:   httpCookie.HttpOnly,
+		SameSite:   httpCookie.SameSite,
+		Creation:   now,
+		LastAccess: now,
+	}
+
+	if cookie.Secure && !secureOrigin {
+		return nil, false, false
+	}
+	if cookie.SameSite == http.SameSiteNoneMode && !cookie.Secure {
+		return nil, false, false
+	}
+	if crossSite && (cookie.SameSite == http.SameSiteLaxMode || cookie.SameSite == http.SameSiteStrictMode) {
+		return nil, false, false
+	}
+
+	domain, hostOnly, ok := cookieDomain(host, httpCookie.Domain)
+	if !ok {
+		return nil, false, false
+	}
+	cookie.Domain = domain
+	cookie.HostOnly = hostOnly
+
+	cookie.Path = httpCookie.Path
+	if !strings.HasPrefix(cookie.Path, "/") {
+		cookie.Path = defaultCookiePath(u.Path)
+	}
+
+	switch {
+	case httpCookie.MaxAge < 0:
+		return cookie, true, true
+	case httpCookie.MaxAge > 0:
+		cookie.Persistent = true
+		cookie.Expires = now.Add(time.Duration(httpCookie.MaxAge) * time.Second)
+	case !httpCookie.Expires.IsZero():
+		if !httpCookie.Expires.After(now) {
+			return cookie, true, true
+		}
+		cookie.Persistent = true
+		cookie.Expires = httpCookie.Expires
+	}
+
+	return cookie, false, true
+}
+
+func (cj *cookieJar) cookies(u *url.URL, crossSite bool) []*http.Cookie {
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return nil
+	}
+
+	host := canonicalCookieHost(u.Host)
+	path := u.Path
+	if path == "" {
+		path = "/"
+	}
+	secure := u.Scheme == "https"
+	now := time.Now()
+
+	cj.mutex.Lock()
+	defer cj.mutex.Unlock()
+
+	var matched []*Cookie
+	for _, domain := range candidateCookieDomains(host) {
+		for key, cookie := range cj.entries[domain] {
+			if cookie.expired(now) {
+				delete(cj.entries[domain], key)
+				continue
+			}
+			if cookie.HostOnly && domain != host {
+				continue
+			}
+			if !cookiePathMatch(path, cookie.Path) {
+				continue
+			}
+			if cookie.Secure && !secure {
+				continue
+			}
+			if crossSite && (cookie.SameSite == http.SameSiteLaxMode || cookie.SameSite == http.SameSiteStrictMode) {
+				continue
+			}
+			matched = append(matched, cookie)
+		}
+	}
+
+	// Longer paths first, then older cookies (RFC 6265 section 5.4)
+	sort.Slice(matched, func(i, j int) bool {
+		if len(matched[i].Path) != len(matched[j].Path) {
+			return len(matched[i].Path) > len(matched[j].Path)
+		}
+		return matched[i].Creation.Before(matched[j].Creation)
+	})
+
+	result := make([]*http.Cookie, 0, len(matched))
+	for _, cookie := range matched {
+		cookie.LastAccess = now
+		result = append(result, &http.Cookie{Name: cookie.Name, Value: cookie.Value})
+	}
+	return result
+}
+
+// List returns copies of the cookies stored for domain, or of every cookie
+// when domain is empty.
+func (cj *cookieJar) List(domain string) []*Cookie {
+	domain = canonicalCookieHost(domain)
+	now := time.Now()
+
+	cj.mutex.Lock()
+	defer cj.mutex.Unlock()
+
+	var result []*Cookie
+	for cookieDomain, domainCookies := range cj.entries {
+		if domain != "" && cookieDomain != domain {
+			continue
+		}
+		for _, cookie := range domainCookies {
+			if cookie.expired(now) {
+				continue
+			}
+			copied := *cookie
+			result = append(result, &copied)
+		}
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].Domain != result[j].Domain {
+			return result[i].Domain < result[j].Domain
+		}
+		return result[i].key() < result[j].key()
+	})
+	return result
+}
+
+func (cj *cookieJar) Domains() []string {
+	cj.mutex.Lock()
+	defer cj.mutex.Unlock()
+
+	domains := make([]string, 0, len(cj.entries))
+	for domain, domainCookies := range cj.entries {
+		if len(domainCookies) > 0 {
+			domains = append(domains, domain)
+		}
+	}
+	sort.Strings(domains)
+	return domains
+}
+
+func (cj *cookieJar) Delete(domain, path, name string) bool {
+	domain = canonicalCookieHost(domain)
+
+	cj.mutex.Lock()
+	defer cj.mutex.Unlock()
+
+	domainCookies, ok := cj.entries[domain]
+	if !ok {
+		return false
+	}
+
+	key := name + ";" + path
+	if _, ok := domainCookies[key]; !ok {
+		return false
+	}
+	delete(domainCookies, key)
+	return true
+}
+
+// ClearDomain removes the cookies stored for domain and its subdomains and
+// returns how many were removed.
+func (cj *cookieJar) ClearDomain(domain string) int {
+	domain = canonicalCookieHost(domain)
+
+	cj.mutex.Lock()
+	defer cj.mutex.Unlock()
+
+	removed := 0
+	for cookieDomain, domainCookies := range cj.entries {
+		if cookieDomain == domain || strings.HasSuffix(cookieDomain, "."+domain) {
+			removed += len(domainCookies)
+			delete(cj.entries, cookieDomain)
+		}
+	}
+	return removed
+}
+
+func (cj *cookieJar) Clear() {
+	cj.mutex.Lock()
+	defer cj.mutex.Unlock()
+	cj.entries = make(map[string]map[string]*Cookie)
+}
+
+func (cj *cookieJar) Save() error {
+	if cj.path == "" {
+		return nil
+	}
+
+	now := time.Now()
+
+	cj.mutex.Lock()
+	// Session cookies end with the browser session, so only persistent ones are kept
+	stored := make([]*Cookie, 0)
+	for _, domainCookies := range cj.entries {
+		for _, cookie := range domainCookies {
+			if cookie.Persistent && !cookie.expired(now) {
+				stored = append(stored, cookie)
+			}
+		}
+	}
+	data, err := json.MarshalIndent(stored, "", "  ")
+	cj.mutex.Unlock()
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(cj.path), 0o700); err != nil {
+		return err
+	}
+
+	tmp := cj.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, cj.path)
+}
+
+func (cj *cookieJar) load() error {
+	data, err := os.ReadFile(cj.path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+
+	var stored []*Cookie
+	if err := json.Unmarshal(data, &stored); err != nil {
+		return NewBrowserErrorWithContext(ErrParsingFailed, "invalid cookie file: "+err.Error(), cj.path)
+	}
+
+	now := time.Now()
+	for _, cookie := range stored {
+		if cookie.Domain == "" || cookie.expired(now) {
+			continue
+		}
+		if cj.entries[cookie.Domain] == nil {
+			cj.entries[cookie.Domain] = make(map[string]*Cookie)
+		}
+		cj.entries[cookie.Domain][cookie.key()] = cookie
+	}
+	return nil
+}
+
+// siteCookieJar is the view of a cookieJar returned by ForSite.
+type siteCookieJar struct {
+	jar  *cookieJar
+	site string
+}
+
+func (sj *siteCookieJar) SetCookies(u *url.URL, cookies []*http.Cookie) {
+	sj.jar.setCookies(u, cookies, sj.isCrossSite(u))
+}
+
+func (sj *siteCookieJar) Cookies(u *url.URL) []*http.Cookie {
+	return sj.jar.cookies(u, sj.isCrossSite(u))
+}
+
+func (sj *siteCookieJar) isCrossSite(u *url.URL) bool {
+	return sj.site != "" && registrableDomain(u.String()) != sj.site
+}
+
+// registrableDomain returns the eTLD+1 of a URL's host, or the host itself
+// for IP addresses and hosts that are public suffixes.
+func registrableDomain(rawURL string) string {
+	parsed, err := url.Parse(rawURL)
+	if err != nil {
+		return ""
+	}
+
+	host := canonicalCookieHost(parsed.Host)
+	if host == "" || net.ParseIP(host) != nil {
+		return host
+	}
+
+	domain, err := publicsuffix.EffectiveTLDPlusOne(host)
+	if err != nil {
+		return host
+	}
+	return domain
+}
+
+func canonicalCookieHost(host string) string {
+	host = strings.ToLower(strings.TrimSpace(host))
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	host = strings.Trim(host, "[]")
+	return strings.TrimPrefix(host, ".")
+}
+
+// cookieDomain validates a Domain attribute against the request host
+// (RFC 6265 section 5.3 steps 4 to 6).
+func cookieDomain(host, attribute string) (string, bool, bool) {
+	attribute = canonicalCookieHost(attribute)
+	if attribute == "" {
+		return host, true, true
+	}
+
+	if net.ParseIP(host) != nil {
+		return host, true, attribute == host
+	}
+
+	// Cookies may not be set for a whole public suffix such as "com" or "co.uk"
+	if suffix, _ := publicsuffix.PublicSuffix(attribute); suffix == attribute {
+		return host, true, attribute == host
+	}
+
+	if !cookieDomainMatch(host, attribute) {
+		return "", false, false
+	}
+	return attribute, false, true
+}
+
+func cookieDomainMatch(host, domain string) bool {
+	if host == domain {
+		return true
+	}
+	return strings.HasSuffix(host, "."+domain) && net.ParseIP(host) == nil
+}
+
+// candidateCookieDomains lists host and each of its parent domains, which are
+// the only keys a matching cookie can be stored under.
+func candidateCookieDomains(host string) []string {
+	domains := []string{host}
+	if net.ParseIP(host) != nil {
+		return domains
+	}
+
+	for {
+		dot := strings.IndexByte(host, '.')
+		if dot < 0 {
+			return domains
+		}
+		host = host[dot+1:]
+		domains = append(domains, host)
+	}
+}
+
+func defaultCookiePath(requestPath string) string {
+	if !strings.HasPrefix(requestPath, "/") {
+		return "/"
+	}
+	lastSlash := strings.LastIndex(requestPath, "/")
+	if lastSlash == 0 {
+		return "/"
+	}
+	return requestPath[:lastSlash]
+}
+
+func cookiePathMatch(requestPath, cookiePath string) bool {
+	if requestPath == cookiePath {
+		return true
+	}
+	if !strings.HasPrefix(requestPath, cookiePath) {
+		return false
+	}
+	return strings.HasSuffix(cookiePath, "/") || requestPath[len(cookiePath)] == '/'
+}
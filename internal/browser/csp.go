@@ -0,0 +1,276 @@
+package browser
+
+import (
+	"log"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+)
+
+// CSP resource types, named after the directive that governs them.
+const (
+	CSPStyleSrc  = "style-src"
+	CSPScriptSrc = "script-src"
+	CSPImgSrc    = "img-src"
+)
+
+// cspFallbacks lists, for each resource type, the directives consulted in
+// order; the first one a policy has decides (CSP3 section 6.8.3).
+var cspFallbacks = map[string][]string{
+	CSPStyleSrc:  {"style-src-elem", CSPStyleSrc, "default-src"},
+	CSPScriptSrc: {"script-src-elem", CSPScriptSrc, "default-src"},
+	CSPImgSrc:    {CSPImgSrc, "default-src"},
+}
+
+// cspMetaIgnoredDirectives have no effect when delivered by a <meta> tag.
+var cspMetaIgnoredDirectives = map[string]bool{
+	"report-uri":      true,
+	"frame-ancestors": true,
+	"sandbox":         true,
+}
+
+// CSPViolation records a resource a Content-Security-Policy did not allow.
+type CSPViolation struct {
+	// Directive is the directive that was violated, such as default-src.
+	Directive string
+	URL       string
+	// ReportOnly is set when the policy only reports, so the resource was
+	// loaded anyway.
+	ReportOnly bool
+}
+
+type cspPolicy struct {
+	directives map[string][]string
+	reportOnly bool
+}
+
+// ContentSecurityPolicy is the set of policies a document is subject to.
+// Each policy is enforced on its own, so a resource must satisfy all of
+// them. The zero value allows everything.
+type ContentSecurityPolicy struct {
+	policies []cspPolicy
+}
+
+// NewContentSecurityPolicy reads the Content-Security-Policy and
+// Content-Security-Policy-Report-Only headers of a response.
+func NewContentSecurityPolicy(header http.Header) *ContentSecurityPolicy {
+	csp := &ContentSecurityPolicy{}
+	for _, value := range header.Values("Content-Security-Policy") {
+		csp.AddHeader(value, false)
+	}
+	for _, value := range header.Values("Content-Security-Policy-Report-Only") {
+		csp.AddHeader(value, true)
+	}
+	return csp
+}
+
+// AddHeader adds the policies of a header value, which may hold several
+// separated by commas.
+func (csp *ContentSecurityPolicy) AddHeader(value string, reportOnly bool) {
+	for _, serialized := range strings.Split(value, ",") {
+		if policy, ok := parseCSPPolicy(serialized, reportOnly, false); ok {
+			csp.policies = append(csp.policies, policy)
+		}
+	}
+}
+
+// AddMeta adds the policy of a <meta http-equiv="Content-Security-Policy">.
+// Such policies are always enforced.
+func (csp *ContentSecurityPolicy) AddMeta(content string) {
+	if policy, ok := parseCSPPolicy(content, false, true); ok {
+		csp.policies = append(csp.policies, policy)
+	}
+}
+
+func (csp *ContentSecurityPolicy) IsEmpty() bool {
+	return csp == nil || len(csp.policies) == 0
+}
+
+// parseCSPPolicy parses one serialized policy (CSP3 section 2.2.1). Of
+// repeated directives, the first wins.
+func parseCSPPolicy(serialized string, reportOnly, fromMeta bool) (cspPolicy, bool) {
+	policy := cspPolicy{directives: make(map[string][]string), reportOnly: reportOnly}
+	for _, token := range strings.Split(serialized, ";") {
+		fields := strings.Fields(token)
+		if len(fields) == 0 {
+			continue
+		}
+		name := strings.ToLower(fields[0])
+		if _, seen := policy.directives[name]; seen || (fromMeta && cspMetaIgnoredDirectives[name]) {
+			continue
+		}
+		policy.directives[name] = fields[1:]
+	}
+	return policy, len(policy.directives) > 0
+}
+
+// Check reports whether a resource of the given type, such as CSPStyleSrc,
+// may be loaded from resourceURL by the document at pageURL, along with the
+// violations found. Violations of report-only policies are returned but do
+// not block the resource.
+func (csp *ContentSecurityPolicy) Check(resourceType, resourceURL, pageURL string) (bool, []CSPViolation) {
+	if csp.IsEmpty() {
+		return true, nil
+	}
+
+	resource, err := url.Parse(resourceURL)
+	if err != nil {
+		return false, []CSPViolation{{Directive: resourceType, URL: resourceURL}}
+	}
+	self, _ := url.Parse(pageURL)
+
+	allowed := true
+	var violations []CSPViolation
+	for _, policy := range csp.policies {
+		directive, sources, ok := policy.sourcesFor(resourceType)
+		if !ok || matchesCSPSourceList(sources, resource, self) {
+			continue
+		}
+		violations = append(violations, CSPViolation{Directive: directive, URL: resourceURL, ReportOnly: policy.reportOnly})
+		if !policy.reportOnly {
+			allowed = false
+		}
+	}
+	return allowed, violations
+}
+
+func (p cspPolicy) sourcesFor(resourceType string) (string, []string, bool) {
+	for _, directive := range cspFallbacks[resourceType] {
+		if sources, ok := p.directives[directive]; ok {
+			return directive, sources, true
+		}
+	}
+	return "", nil, false
+}
+
+// logCSPViolation tells developers about a resource the page's policy did
+// not allow.
+func logCSPViolation(pageURL string, violation CSPViolation) {
+	if violation.ReportOnly {
+		log.Printf("Content Security Policy (report only): %s would block %s on %s", violation.Directive, violation.URL, pageURL)
+		return
+	}
+	log.Printf("Content Security Policy: %s blocked %s on %s", violation.Directive, violation.URL, pageURL)
+}
+
+// matchesCSPSourceList implements CSP3 section 6.7.2.5. self is the page's
+// URL and may be nil. Nonces, hashes and keywords such as 'unsafe-inline'
+// only apply to inline content, so they never match a URL.
+func matchesCSPSourceList(sources []string, resource, self *url.URL) bool {
+	for _, source := range sources {
+		if matchesCSPSource(strings.TrimSpace(source), resource, self) {
+			return true
+		}
+	}
+	return false
+}
+
+func matchesCSPSource(source string, resource, self *url.URL) bool {
+	lower := strings.ToLower(source)
+	scheme := strings.ToLower(resource.Scheme)
+
+	switch {
+	case lower == "*":
+		// * covers network schemes and the page's own, not data: or blob:
+		switch scheme {
+		case "http", "https", "ws", "wss":
+			return true
+		}
+		return self != nil && scheme == strings.ToLower(self.Scheme)
+	case lower == "'self'":
+		return self != nil && cspSchemeMatches(strings.ToLower(self.Scheme), scheme) &&
+			strings.EqualFold(self.Hostname(), resource.Hostname()) &&
+			(effectivePort(self) == effectivePort(resource) || cspUpgradedPort(effectivePort(self), resource))
+	case strings.HasPrefix(lower, "'"):
+		return false
+	case strings.HasSuffix(lower, ":") && !strings.Contains(lower, "/"):
+		return cspSchemeMatches(strings.TrimSuffix(lower, ":"), scheme)
+	default:
+		return matchesCSPHostSource(lower, resource, self)
+	}
+}
+
+// matchesCSPHostSource matches a host-source such as
+// https://*.example.com:8443/static/.
+func matchesCSPHostSource(source string, resource, self *url.URL) bool {
+	scheme := strings.ToLower(resource.Scheme)
+
+	sourceScheme, rest, hasScheme := strings.Cut(source, "://")
+	if hasScheme {
+		if !cspSchemeMatches(sourceScheme, scheme) {
+			return false
+		}
+	} else {
+		rest = source
+		if self == nil || !cspSchemeMatches(strings.ToLower(self.Scheme), scheme) {
+			return false
+		}
+	}
+
+	hostPort, sourcePath := rest, ""
+	if i := strings.Index(rest, "/"); i >= 0 {
+		hostPort, sourcePath = rest[:i], rest[i:]
+	}
+	host, port := hostPort, ""
+	if i := strings.LastIndex(hostPort, ":"); i >= 0 {
+		host, port = hostPort[:i], hostPort[i+1:]
+	}
+
+	resourceHost := strings.ToLower(resource.Hostname())
+	switch {
+	case host == "*":
+	case strings.HasPrefix(host, "*."):
+		if !strings.HasSuffix(resourceHost, host[1:]) {
+			return false
+		}
+	case host != resourceHost:
+		return false
+	}
+
+	switch port {
+	case "*":
+	case "":
+		if resource.Port() != "" && resource.Port() != effectivePort(&url.URL{Scheme: scheme}) {
+			return false
+		}
+	default:
+		if port != effectivePort(resource) && !cspUpgradedPort(port, resource) {
+			return false
+		}
+	}
+
+	if sourcePath == "" || sourcePath == "/" {
+		return true
+	}
+	if decoded, err := url.PathUnescape(sourcePath); err == nil {
+		sourcePath = decoded
+	}
+	resourcePath := path.Clean("/" + resource.Path)
+	if strings.HasSuffix(sourcePath, "/") {
+		return strings.HasPrefix(resourcePath+"/", sourcePath)
+	}
+	return resourcePath == sourcePath
+}
+
+// cspSchemeMatches reports whether a source's scheme allows resourceScheme.
+// Secure upgrades are allowed: http sources match https, ws match wss.
+func cspSchemeMatches(sourceScheme, resourceScheme string) bool {
+	switch {
+	case sourceScheme == resourceScheme:
+		return true
+	case sourceScheme == "http":
+		return resourceScheme == "https"
+	case sourceScheme == "ws":
+		return resourceScheme == "wss" || resourceScheme == "http" || resourceScheme == "https"
+	case sourceScheme == "wss":
+		return resourceScheme == "https"
+	}
+	return false
+}
+
+// cspUpgradedPort reports whether a source on port 80 should match a
+// resource on the default https port, for pages upgraded to https.
+func cspUpgradedPort(sourcePort string, resource *url.URL) bool {
+	return sourcePort == "80" && strings.EqualFold(resource.Scheme, "https") && effectivePort(resource) == "443"
+}
@@ -12,6 +12,9 @@ type ComputedStyle struct {
 type CSSApplicator interface {
 	ApplyStyles(document Document, css *CSS) error
 	ComputeStyle(node Node, css *CSS) *ComputedStyle
+	// ApplyRules applies only the rules of css that match node, on top of an
+	// already computed style.
+	ApplyRules(style *ComputedStyle, node Node, css *CSS)
 }
 
 type cssApplicator struct {
@@ -84,6 +87,13 @@ func (ca *cssApplicator) ComputeStyle(node Node, css *CSS) *ComputedStyle {
 	return style
 }
 
+func (ca *cssApplicator) ApplyRules(style *ComputedStyle, node Node, css *CSS) {
+	if css == nil {
+		return
+	}
+	ca.applyCSSRules(style, node, css)
+}
+
 func (ca *cssApplicator) applyStylesToNode(node Node, css *CSS) {
 	if node == nil {
 		return
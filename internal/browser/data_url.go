@@ -0,0 +1,149 @@
+package browser
+
+import (
+	"encoding/base64"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// DataURL is a decoded RFC 2397 data: URL.
+type DataURL struct {
+	MediaType string
+	Charset   string
+	Params    map[string]string
+	IsBase64  bool
+	Data      []byte
+}
+
+type DataURLLoader interface {
+	Load(dataURL string) (*Response, error)
+	Parse(dataURL string) (*DataURL, error)
+}
+
+type dataURLLoader struct{}
+
+func NewDataURLLoader() DataURLLoader {
+	return &dataURLLoader{}
+}
+
+func (dl *dataURLLoader) Load(dataURL string) (*Response, error) {
+	parsed, err := dl.Parse(dataURL)
+	if err != nil {
+		return nil, err
+	}
+
+	contentType := parsed.MediaType
+	if parsed.Charset != "" {
+		contentType += "; charset=" + parsed.Charset
+	}
+	header := http.Header{"Content-Type": []string{contentType}}
+
+	return NewResponse(dataURL, "", http.StatusOK, header, parsed.Data), nil
+}
+
+func (dl *dataURLLoader) Parse(dataURL string) (*DataURL, error) {
+	if !strings.HasPrefix(strings.ToLower(dataURL), "data:") {
+		return nil, NewBrowserError(ErrInvalidURL, "not a data URL")
+	}
+
+	header, payload, found := strings.Cut(dataURL[len("data:"):], ",")
+	if !found {
+		return nil, NewBrowserError(ErrInvalidURL, "data URL is missing the ',' separator")
+	}
+
+	result := dl.parseHeader(header)
+
+	decoded := percentDecode(payload)
+
+	if !result.IsBase64 {
+		result.Data = []byte(decoded)
+		return result, nil
+	}
+
+	data, err := dl.decodeBase64(decoded)
+	if err != nil {
+		return nil, NewBrowserError(ErrInvalidURL, "malformed base64 in data URL: "+err.Error())
+	}
+	result.Data = data
+
+	return result, nil
+}
+
+// percentDecode decodes the %XX escapes in s. A % that does not start one is
+// kept as it is (URL Standard section 1.3).
+func percentDecode(s string) string {
+	if !strings.Contains(s, "%") {
+		return s
+	}
+
+	var decoded strings.Builder
+	decoded.Grow(len(s))
+	for i := 0; i < len(s); i++ {
+		if s[i] == '%' && i+2 < len(s) && isHexDigit(s[i+1]) && isHexDigit(s[i+2]) {
+			value, _ := strconv.ParseUint(s[i+1:i+3], 16, 8)
+			decoded.WriteByte(byte(value))
+			i += 2
+			continue
+		}
+		decoded.WriteByte(s[i])
+	}
+	return decoded.String()
+}
+
+func isHexDigit(c byte) bool {
+	return ('0' <= c && c <= '9') || ('a' <= c && c <= 'f') || ('A' <= c && c <= 'F')
+}
+
+func (dl *dataURLLoader) parseHeader(header string) *DataURL {
+	result := &DataURL{
+		MediaType: DefaultDataURLMediaType,
+		Charset:   DefaultDataURLCharset,
+		Params:    make(map[string]string),
+	}
+
+	parts := strings.Split(header, ";")
+
+	if mediaType := strings.TrimSpace(parts[0]); mediaType != "" {
+		result.MediaType = strings.ToLower(mediaType)
+		// An explicit media type without a charset has no implied charset
+		result.Charset = ""
+	}
+
+	for _, part := range parts[1:] {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+
+		if strings.EqualFold(part, "base64") {
+			result.IsBase64 = true
+			continue
+		}
+
+		key, value, _ := strings.Cut(part, "=")
+		key = strings.ToLower(strings.TrimSpace(key))
+		value = strings.Trim(strings.TrimSpace(value), `"`)
+		if unescaped, err := url.PathUnescape(value); err == nil {
+			value = unescaped
+		}
+
+		result.Params[key] = value
+		if key == "charset" {
+			result.Charset = strings.ToLower(value)
+		}
+	}
+
+	return result
+}
+
+func (dl *dataURLLoader) decodeBase64(payload string) ([]byte, error) {
+	// Whitespace is allowed inside base64 payloads
+	payload = strings.Join(strings.Fields(payload), "")
+
+	if data, err := base64.StdEncoding.DecodeString(payload); err == nil {
+		return data, nil
+	}
+	return base64.RawStdEncoding.DecodeString(strings.TrimRight(payload, "="))
+}
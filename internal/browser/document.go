@@ -14,6 +14,13 @@ type Document interface {
 	GetMetadata() map[string]string
 	GetStyleSheet() *CSS
 	GetScripts() []ScriptInfo
+	GetMixedContent() MixedContentReport
+	// GetReferrerPolicy returns the policy for requests the document makes,
+	// from its Referrer-Policy header or <meta name="referrer">.
+	GetReferrerPolicy() ReferrerPolicy
+	// GetCSPViolations lists the resources the page's Content-Security-Policy
+	// did not allow, including those only reported.
+	GetCSPViolations() []CSPViolation
 	GetComputedStyle(node Node) Style
 	SetComputedStyle(node Node, style Style)
 }
@@ -27,6 +34,11 @@ type document struct {
 	stylesheet *CSS
 	scripts    []ScriptInfo
 	styles     map[Node]Style
+
+	mixedContent   MixedContentReport
+	referrerPolicy ReferrerPolicy
+	csp            *ContentSecurityPolicy
+	cspViolations  []CSPViolation
 }
 
 func (d *document) GetRoot() Node                  { return d.root }
@@ -37,6 +49,10 @@ func (d *document) GetMetadata() map[string]string { return d.metadata }
 func (d *document) GetStyleSheet() *CSS            { return d.stylesheet }
 func (d *document) GetScripts() []ScriptInfo       { return d.scripts }
 
+func (d *document) GetMixedContent() MixedContentReport { return d.mixedContent }
+func (d *document) GetReferrerPolicy() ReferrerPolicy   { return d.referrerPolicy }
+func (d *document) GetCSPViolations() []CSPViolation    { return d.cspViolations }
+
 func (d *document) GetComputedStyle(node Node) Style {
 	if style, ok := d.styles[node]; ok {
 		return style
@@ -49,9 +65,17 @@ func (d *document) SetComputedStyle(node Node, style Style) {
 }
 
 type DocumentBuilder interface {
-	Build(content string) (Document, error)
+	Build(ctx context.Context, content string) (Document, error)
 	SetDebugMode(enabled bool)
 	SetBaseURL(baseURL string)
+	SetCharset(charset string)
+	SetCacheMode(mode CacheMode)
+	SetCookieJar(jar CookieJar)
+	SetTabID(tabID string)
+	SetUserStyleSheet(css string)
+	SetMixedContentMode(mode MixedContentMode)
+	SetReferrerPolicy(policy ReferrerPolicy)
+	SetContentSecurityPolicy(csp *ContentSecurityPolicy)
 }
 
 type documentBuilder struct {
@@ -62,14 +86,22 @@ type documentBuilder struct {
 	cssApplicator CSSApplicator
 	debugMode     bool
 	baseURL       string
+	charset       string
+	cacheMode     CacheMode
+	cookieJar     CookieJar
+	tabID         string
+	userCSS       *CSS
+	mixedMode     MixedContentMode
+	referrer      ReferrerPolicy
+	csp           *ContentSecurityPolicy
 }
 
-func NewDocumentBuilder() DocumentBuilder {
+func NewDocumentBuilder(apiHandler APIHandler) DocumentBuilder {
 	return &documentBuilder{
 		cssApplicator: NewCSSApplicator(),
 		debugMode:     false,
-		apiHandler:    NewAPIHandler(),
-		urlHandler:    NewURLHandler(),
+		apiHandler:    apiHandler,
+		urlHandler:    NewURLHandlerWithSchemes(apiHandler.GetSchemeRegistry()),
 		baseURL:       "",
 	}
 }
@@ -82,7 +114,58 @@ func (db *documentBuilder) SetBaseURL(baseURL string) {
 	db.baseURL = baseURL
 }
 
-func (db *documentBuilder) Build(content string) (Document, error) {
+// SetCharset records the encoding the content was decoded from, which takes
+// precedence over any <meta charset> in the markup.
+func (db *documentBuilder) SetCharset(charset string) {
+	db.charset = charset
+}
+
+// SetCacheMode controls how external stylesheets use the HTTP cache.
+func (db *documentBuilder) SetCacheMode(mode CacheMode) {
+	db.cacheMode = mode
+}
+
+// SetCookieJar sets the jar used for stylesheet requests; nil selects the
+// APIHandler's own jar.
+func (db *documentBuilder) SetCookieJar(jar CookieJar) {
+	db.cookieJar = jar
+}
+
+// SetTabID sets the tab stylesheet requests are made for.
+func (db *documentBuilder) SetTabID(tabID string) {
+	db.tabID = tabID
+}
+
+// SetUserStyleSheet sets user-origin styles, such as element hiding rules.
+// They override author styles, as user !important rules do.
+func (db *documentBuilder) SetUserStyleSheet(css string) {
+	db.userCSS = nil
+	if strings.TrimSpace(css) != "" {
+		db.userCSS = NewCSSParser(css).Parse()
+	}
+}
+
+// SetMixedContentMode chooses whether passive http content on https pages is
+// upgraded or only reported.
+func (db *documentBuilder) SetMixedContentMode(mode MixedContentMode) {
+	db.mixedMode = mode
+}
+
+// SetReferrerPolicy sets the policy from the response's Referrer-Policy
+// header. A <meta name="referrer"> in the markup replaces it.
+func (db *documentBuilder) SetReferrerPolicy(policy ReferrerPolicy) {
+	db.referrer = policy
+}
+
+// SetContentSecurityPolicy sets the policies from the response's headers.
+// Policies in <meta http-equiv> tags are added to them.
+func (db *documentBuilder) SetContentSecurityPolicy(csp *ContentSecurityPolicy) {
+	db.csp = csp
+}
+
+// Build parses content and applies its styles. Cancelling ctx abandons any
+// stylesheet fetches still in flight.
+func (db *documentBuilder) Build(ctx context.Context, content string) (Document, error) {
 	if content == "" {
 		return nil, NewBrowserError(ErrInvalidInput, "content cannot be empty")
 	}
@@ -96,7 +179,12 @@ func (db *documentBuilder) Build(content string) (Document, error) {
 		return nil, err
 	}
 
-	if err := db.parseCSS(doc); err != nil {
+	db.checkMixedContent(doc)
+	db.checkContentSecurityPolicy(doc)
+
+	// Preloads start first, so the stylesheet requests can pick them up
+	db.queueResourceHints(doc)
+	if err := db.parseCSS(ctx, doc); err != nil {
 		return nil, err
 	}
 
@@ -125,9 +213,26 @@ func (db *documentBuilder) parseHTML(content string, doc *document) error {
 	if charset, ok := doc.metadata["charset"]; ok {
 		doc.charset = charset
 	}
+	if db.charset != "" {
+		doc.charset = db.charset
+	}
 	if lang, ok := doc.metadata["lang"]; ok {
 		doc.language = lang
 	}
+	doc.referrerPolicy = db.referrer
+	if policy, ok := parseMetaReferrerPolicy(doc.metadata["referrer"]); ok {
+		doc.referrerPolicy = policy
+	}
+
+	doc.csp = &ContentSecurityPolicy{}
+	if db.csp != nil {
+		doc.csp.policies = append(doc.csp.policies, db.csp.policies...)
+	}
+	for name, content := range doc.metadata {
+		if strings.EqualFold(name, "http-equiv-content-security-policy") {
+			doc.csp.AddMeta(content)
+		}
+	}
 
 	if db.debugMode {
 		log.Println("HTML Parser Output:")
@@ -137,11 +242,11 @@ func (db *documentBuilder) parseHTML(content string, doc *document) error {
 	return nil
 }
 
-func (db *documentBuilder) parseCSS(doc *document) error {
+func (db *documentBuilder) parseCSS(ctx context.Context, doc *document) error {
 	styleContent := db.htmlParser.GetStyleTags()
 	stylesheetURLs := db.htmlParser.GetStylesheetLinks()
 
-	externalCSS := db.fetchExternalStylesheets(stylesheetURLs)
+	externalCSS := db.fetchExternalStylesheets(ctx, doc, stylesheetURLs)
 
 	defaultCSS := db.getDefaultCSS()
 	fullCSS := defaultCSS + "\n" + styleContent + "\n" + externalCSS
@@ -160,7 +265,7 @@ func (db *documentBuilder) parseCSS(doc *document) error {
 	return nil
 }
 
-func (db *documentBuilder) fetchExternalStylesheets(urls []string) string {
+func (db *documentBuilder) fetchExternalStylesheets(ctx context.Context, doc *document, urls []string) string {
 	if len(urls) == 0 {
 		return ""
 	}
@@ -168,24 +273,26 @@ func (db *documentBuilder) fetchExternalStylesheets(urls []string) string {
 	var combinedCSS strings.Builder
 	cssChannel := make(chan string, len(urls))
 
-	baseURL := db.baseURL
-	if baseURL == "" && db.htmlParser != nil {
-		if metaURL, ok := db.htmlParser.GetMetadata()["url"]; ok {
-			baseURL = metaURL
-		}
-	}
-
+	fetching := 0
 	for _, link := range urls {
-		resolvedURL := link
-		if baseURL != "" {
-			if absURL, err := db.urlHandler.Resolve(baseURL, link); err == nil {
-				resolvedURL = absURL
+		resolvedURL := db.resolveURL(link)
+		// Stylesheets are active content, so http ones are never loaded
+		// into an https page
+		if db.isMixedContent(resolvedURL) {
+			doc.mixedContent.Blocked = append(doc.mixedContent.Blocked, resolvedURL)
+			if db.debugMode {
+				log.Printf("Blocked mixed content stylesheet %s", resolvedURL)
 			}
+			continue
 		}
-		go db.fetchStylesheetAsync(resolvedURL, cssChannel)
+		if !db.allowedByCSP(doc, CSPStyleSrc, resolvedURL) {
+			continue
+		}
+		go db.fetchStylesheetAsync(ctx, resolvedURL, doc.referrerPolicy, cssChannel)
+		fetching++
 	}
 
-	for i := 0; i < len(urls); i++ {
+	for i := 0; i < fetching; i++ {
 		css := <-cssChannel
 		if css != "" {
 			combinedCSS.WriteString(css)
@@ -196,14 +303,168 @@ func (db *documentBuilder) fetchExternalStylesheets(urls []string) string {
 	return combinedCSS.String()
 }
 
-func (db *documentBuilder) fetchStylesheetAsync(url string, result chan<- string) {
+// pageURL is the URL the document was loaded from, falling back to the one
+// recorded in its metadata.
+func (db *documentBuilder) pageURL() string {
+	if db.baseURL == "" && db.htmlParser != nil {
+		if metaURL, ok := db.htmlParser.GetMetadata()["url"]; ok {
+			return metaURL
+		}
+	}
+	return db.baseURL
+}
+
+func (db *documentBuilder) resolveURL(link string) string {
+	if baseURL := db.pageURL(); baseURL != "" {
+		if absURL, err := db.urlHandler.Resolve(baseURL, link); err == nil {
+			return absURL
+		}
+	}
+	return link
+}
+
+// isMixedContent reports whether resourceURL would be fetched insecurely by
+// an https page. Hosts known to the HSTS store are upgraded before they are
+// fetched, so they are not mixed content.
+func (db *documentBuilder) isMixedContent(resourceURL string) bool {
+	if !isMixedContent(db.pageURL(), resourceURL) {
+		return false
+	}
+	if hsts := db.apiHandler.GetHSTSStore(); hsts != nil {
+		if _, upgraded := hsts.Upgrade(resourceURL); upgraded {
+			return false
+		}
+	}
+	return true
+}
+
+// checkMixedContent drops http scripts from an https page and upgrades, or
+// reports, its passive http content. Stylesheets are checked as they are
+// fetched.
+func (db *documentBuilder) checkMixedContent(doc *document) {
+	scripts := doc.scripts[:0]
+	for _, script := range doc.scripts {
+		if script.Src != "" {
+			if src := db.resolveURL(script.Src); db.isMixedContent(src) {
+				doc.mixedContent.Blocked = append(doc.mixedContent.Blocked, src)
+				continue
+			}
+		}
+		scripts = append(scripts, script)
+	}
+	doc.scripts = scripts
+
+	db.checkPassiveMixedContent(doc, doc.root)
+}
+
+func (db *documentBuilder) checkPassiveMixedContent(doc *document, node Node) {
+	if node == nil {
+		return
+	}
+
+	if node.GetType() == ElementNodeType && passiveMixedContentTags[node.GetTag()] {
+		if src, ok := node.GetAttribute("src"); ok && src != "" {
+			if resolved := db.resolveURL(src); db.isMixedContent(resolved) {
+				if db.mixedMode == MixedContentWarn {
+					doc.mixedContent.Warned = append(doc.mixedContent.Warned, resolved)
+					if db.debugMode {
+						log.Printf("Mixed content: %s loaded insecurely by %s", resolved, db.pageURL())
+					}
+				} else {
+					node.SetAttribute("src", upgradeToHTTPS(resolved))
+					doc.mixedContent.Upgraded = append(doc.mixedContent.Upgraded, resolved)
+				}
+			}
+		}
+	}
+
+	for _, child := range node.GetChildren() {
+		db.checkPassiveMixedContent(doc, child)
+	}
+}
+
+// allowedByCSP checks a subresource against the page's policies, recording
+// any violation and logging it in debug mode.
+func (db *documentBuilder) allowedByCSP(doc *document, resourceType, resourceURL string) bool {
+	allowed, violations := doc.csp.Check(resourceType, resourceURL, db.pageURL())
+	if db.debugMode {
+		for _, violation := range violations {
+			logCSPViolation(db.pageURL(), violation)
+		}
+	}
+	doc.cspViolations = append(doc.cspViolations, violations...)
+	return allowed
+}
+
+// checkContentSecurityPolicy drops scripts and clears image sources the
+// page's policies do not allow. Stylesheets are checked as they are fetched.
+func (db *documentBuilder) checkContentSecurityPolicy(doc *document) {
+	if doc.csp.IsEmpty() {
+		return
+	}
+
+	scripts := doc.scripts[:0]
+	for _, script := range doc.scripts {
+		if script.Src != "" && !db.allowedByCSP(doc, CSPScriptSrc, db.resolveURL(script.Src)) {
+			continue
+		}
+		scripts = append(scripts, script)
+	}
+	doc.scripts = scripts
+
+	for _, img := range findElements(doc.root, "img") {
+		if src, ok := img.GetAttribute("src"); ok && src != "" {
+			if !db.allowedByCSP(doc, CSPImgSrc, db.resolveURL(src)) {
+				img.SetAttribute("src", "")
+			}
+		}
+	}
+}
+
+// queueResourceHints hands the page's resource hints to the network layer's
+// hint queue. Requests for preloaded stylesheets are served the preloaded
+// responses. Private tabs give no hints, as their responses must not be
+// shared with other tabs.
+func (db *documentBuilder) queueResourceHints(doc *document) {
+	hints := db.htmlParser.GetResourceHints()
+	if len(hints) == 0 || db.cookieJar != nil || db.pageURL() == "" {
+		return
+	}
+
+	queue := db.apiHandler.GetHintQueue()
+	for _, hint := range hints {
+		resolvedURL := db.resolveURL(hint.URL)
+		if hint.Type == HintPreload {
+			directive, ok := preloadDestinations[hint.As]
+			if !ok || db.isMixedContent(resolvedURL) || !db.allowedByCSP(doc, directive, resolvedURL) {
+				continue
+			}
+		}
+		// Keyed as the requests that will use them are
+		normalizedURL, err := db.urlHandler.Normalize(resolvedURL)
+		if err != nil {
+			continue
+		}
+
+		hint.URL = normalizedURL
+		hint.Referrer = db.pageURL()
+		hint.ReferrerPolicy = doc.referrerPolicy
+		hint.TabID = db.tabID
+		if db.debugMode {
+			log.Printf("Queueing %s hint for %s", hint.Type, hint.URL)
+		}
+		queue.Add(hint)
+	}
+}
+
+func (db *documentBuilder) fetchStylesheetAsync(ctx context.Context, url string, policy ReferrerPolicy, result chan<- string) {
 	defer func() {
 		if r := recover(); r != nil {
 			result <- ""
 		}
 	}()
 
-	ctx, cancel := context.WithTimeout(context.Background(), DefaultTimeout)
+	ctx, cancel := context.WithTimeout(ctx, DefaultTimeout)
 	defer cancel()
 
 	normalizedURL, err := db.urlHandler.Normalize(url)
@@ -215,7 +476,16 @@ func (db *documentBuilder) fetchStylesheetAsync(url string, result chan<- string
 		return
 	}
 
-	content, err := db.apiHandler.FetchContent(ctx, normalizedURL)
+	resp, err := db.apiHandler.Fetch(ctx, &FetchRequest{
+		URL:            normalizedURL,
+		Type:           RequestTypeStylesheet,
+		CacheMode:      db.cacheMode,
+		CookieJar:      db.cookieJar,
+		FirstPartyURL:  db.baseURL,
+		TabID:          db.tabID,
+		Referrer:       db.pageURL(),
+		ReferrerPolicy: policy,
+	})
 	if err != nil {
 		if db.debugMode {
 			log.Printf("Failed to fetch stylesheet %s: %v", url, err)
@@ -224,7 +494,15 @@ func (db *documentBuilder) fetchStylesheetAsync(url string, result chan<- string
 		return
 	}
 
-	result <- content
+	if !resp.IsSuccess() || resp.IsHTML() || resp.IsImage() {
+		if db.debugMode {
+			log.Printf("Ignoring stylesheet %s (%s, %s)", url, resp.Status, resp.ContentType)
+		}
+		result <- ""
+		return
+	}
+
+	result <- resp.Text()
 }
 
 func (db *documentBuilder) applyStyles(doc *document) error {
@@ -242,6 +520,7 @@ func (db *documentBuilder) applyStylesToTree(doc *document, node Node, css *CSS)
 	}
 
 	computedStyle := db.cssApplicator.ComputeStyle(node, css)
+	db.cssApplicator.ApplyRules(computedStyle, node, db.userCSS)
 
 	style := db.convertComputedStyleToStyle(computedStyle)
 	doc.SetComputedStyle(node, style)
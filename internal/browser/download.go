@@ -0,0 +1,719 @@
+package browser
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+type DownloadState int
+
+const (
+	DownloadInProgress DownloadState = iota
+	DownloadPaused
+	DownloadCompleted
+	DownloadCancelled
+	DownloadFailed
+)
+
+func (s DownloadState) String() string {
+	switch s {
+	case DownloadInProgress:
+		return "downloading"
+	case DownloadPaused:
+		return "paused"
+	case DownloadCompleted:
+		return "completed"
+	case DownloadCancelled:
+		return "cancelled"
+	default:
+		return "failed"
+	}
+}
+
+// Download is a snapshot of a file being saved.
+type Download struct {
+	ID       string `json:"id"`
+	URL      string `json:"url"`
+	Path     string `json:"path"`
+	MimeType string `json:"mime_type,omitempty"`
+	// TotalBytes is -1 while the size is unknown.
+	ReceivedBytes int64         `json:"received_bytes"`
+	TotalBytes    int64         `json:"total_bytes"`
+	State         DownloadState `json:"state"`
+	Error         string        `json:"error,omitempty"`
+	// ETag and LastModified make sure a resumed download continues the same
+	// file, through If-Range.
+	ETag         string    `json:"etag,omitempty"`
+	LastModified string    `json:"last_modified,omitempty"`
+	StartedAt    time.Time `json:"started_at"`
+	FinishedAt   time.Time `json:"finished_at,omitempty"`
+	// Private downloads, started from private tabs, are not saved.
+	Private bool `json:"-"`
+}
+
+func (d Download) FileName() string {
+	return filepath.Base(d.Path)
+}
+
+// Progress returns the share of the file received, or -1 when the size is
+// unknown.
+func (d Download) Progress() float64 {
+	if d.State == DownloadCompleted {
+		return 1
+	}
+	if d.TotalBytes <= 0 {
+		return -1
+	}
+	return float64(d.ReceivedBytes) / float64(d.TotalBytes)
+}
+
+// DownloadManager saves responses that cannot be displayed to disk.
+type DownloadManager interface {
+	// Start saves the response of a navigation. resp supplies the file name
+	// and type. The open body of an http download is streamed to disk in the
+	// background; any other body is written out as it is.
+	Start(req *FetchRequest, resp *Response, private bool) (Download, error)
+	// Pause stops a running download, keeping what was received so far.
+	Pause(id string) error
+	// Resume continues a paused or failed download with a Range request, or
+	// starts it over if the server does not support ranges. Downloads that
+	// answered a form submission cannot be resumed.
+	Resume(id string) error
+	// Cancel stops a download and deletes its partial file.
+	Cancel(id string) error
+	// Remove drops a finished download from the list. The file is kept.
+	Remove(id string) bool
+	Get(id string) (Download, bool)
+	List() []Download
+	Directory() string
+	// Close pauses running downloads, so they can be resumed next time, and
+	// saves the list.
+	Close() error
+}
+
+type downloadTask struct {
+	info Download
+	req  FetchRequest
+	// body is the open body of the response that started the download,
+	// which its first run writes out. Resuming requests the file again.
+	body io.ReadCloser
+	// stopAs is the state a running task ends in when its context is
+	// cancelled: DownloadPaused or DownloadCancelled.
+	stopAs DownloadState
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+type downloadManager struct {
+	apiHandler APIHandler
+	dir        string
+	path       string
+	tasks      map[string]*downloadTask
+	order      []string
+	mutex      sync.Mutex
+	saveMutex  sync.Mutex
+}
+
+// NewDownloadManager saves files to dir and keeps the list of downloads in
+// the file at path, loading any downloads already listed there. An empty path
+// keeps the list in memory only. Downloads that were running when the list
+// was saved come back paused.
+func NewDownloadManager(apiHandler APIHandler, dir, path string) (DownloadManager, error) {
+	dm := &downloadManager{
+		apiHandler: apiHandler,
+		dir:        dir,
+		path:       path,
+		tasks:      make(map[string]*downloadTask),
+	}
+
+	if path == "" {
+		return dm, nil
+	}
+	return dm, dm.load()
+}
+
+func (dm *downloadManager) Directory() string {
+	return dm.dir
+}
+
+func (dm *downloadManager) Start(req *FetchRequest, resp *Response, private bool) (Download, error) {
+	if err := os.MkdirAll(dm.dir, 0o755); err != nil {
+		if resp.stream != nil {
+			resp.stream.Close()
+		}
+		return Download{}, NewBrowserErrorWithContext(ErrAccessDenied, "cannot create download directory: "+err.Error(), dm.dir)
+	}
+
+	dm.mutex.Lock()
+	task := &downloadTask{
+		info: Download{
+			ID:           NewIDGenerator().Generate(),
+			URL:          resp.URL,
+			Path:         dm.reservePathLocked(downloadFileName(resp)),
+			MimeType:     resp.ContentType,
+			TotalBytes:   -1,
+			State:        DownloadInProgress,
+			ETag:         strongETag(resp.Header.Get("ETag")),
+			LastModified: resp.Header.Get("Last-Modified"),
+			StartedAt:    time.Now(),
+			Private:      private,
+		},
+		req: FetchRequest{
+			URL:            resp.URL,
+			Method:         resp.Method,
+			Referrer:       req.Referrer,
+			ReferrerPolicy: req.ReferrerPolicy,
+			CookieJar:      req.CookieJar,
+			FirstPartyURL:  req.FirstPartyURL,
+			TabID:          req.TabID,
+		},
+		body: resp.stream,
+	}
+	// An encoded body is decoded as it is saved, so only an unencoded one
+	// is known to be Content-Length bytes long
+	if task.body != nil && resp.Header.Get("Content-Encoding") == "" {
+		if length, err := strconv.ParseInt(resp.Header.Get("Content-Length"), 10, 64); err == nil && length >= 0 {
+			task.info.TotalBytes = length
+		}
+	}
+	dm.tasks[task.info.ID] = task
+	dm.order = append(dm.order, task.info.ID)
+
+	// Other schemes answer from memory, so their body is already complete
+	if task.body == nil {
+		err := os.WriteFile(task.info.Path, resp.Body, 0o644)
+		task.info.ReceivedBytes = int64(len(resp.Body))
+		task.info.TotalBytes = task.info.ReceivedBytes
+		task.info.FinishedAt = time.Now()
+		task.info.State = DownloadCompleted
+		if err != nil {
+			task.info.State = DownloadFailed
+			task.info.Error = err.Error()
+		}
+		info := task.info
+		dm.mutex.Unlock()
+
+		dm.saveLogged()
+		return info, err
+	}
+
+	dm.startLocked(task)
+	info := task.info
+	dm.mutex.Unlock()
+
+	dm.saveLogged()
+	return info, nil
+}
+
+// startLocked runs task in the background. Downloads outlive navigations, so
+// they get a context of their own.
+func (dm *downloadManager) startLocked(task *downloadTask) {
+	ctx, cancel := context.WithCancel(context.Background())
+	task.info.State = DownloadInProgress
+	task.info.Error = ""
+	task.stopAs = DownloadPaused
+	task.cancel = cancel
+	task.done = make(chan struct{})
+
+	go dm.run(ctx, task)
+}
+
+func (dm *downloadManager) run(ctx context.Context, task *downloadTask) {
+	defer close(task.done)
+	err := dm.transfer(ctx, task)
+
+	dm.mutex.Lock()
+	task.cancel()
+	switch {
+	case err == nil:
+		task.info.State = DownloadCompleted
+		task.info.FinishedAt = time.Now()
+	case ctx.Err() != nil:
+		task.info.State = task.stopAs
+	default:
+		task.info.State = DownloadFailed
+		task.info.Error = err.Error()
+	}
+	state := task.info.State
+	dm.mutex.Unlock()
+
+	if state == DownloadCancelled {
+		os.Remove(task.info.Path + DownloadPartialExtension)
+	}
+	dm.saveLogged()
+}
+
+// transfer streams the file into its partial file and renames it into place
+// once complete. The first run writes out the response the download started
+// with; a resumed one requests the file again, continuing from what was
+// already received when the server supports it.
+func (dm *downloadManager) transfer(ctx context.Context, task *downloadTask) error {
+	partPath := task.info.Path + DownloadPartialExtension
+
+	dm.mutex.Lock()
+	offset := task.info.ReceivedBytes
+	validator := task.info.ETag
+	if validator == "" {
+		validator = task.info.LastModified
+	}
+	req := task.req
+	body := task.body
+	task.body = nil
+	dm.mutex.Unlock()
+
+	if body != nil {
+		defer body.Close()
+		// Reading the body does not follow ctx by itself
+		stop := context.AfterFunc(ctx, func() { body.Close() })
+		defer stop()
+
+		return dm.write(task, body, os.O_CREATE|os.O_WRONLY|os.O_TRUNC)
+	}
+
+	// Content-Encoding would make byte ranges refer to the encoded body
+	req.Header = http.Header{}
+	req.Header.Set("Accept-Encoding", "identity")
+	if offset > 0 {
+		req.Header.Set("Range", fmt.Sprintf("bytes=%d-", offset))
+		if validator != "" {
+			req.Header.Set("If-Range", validator)
+		}
+	}
+
+	resp, err := dm.apiHandler.Stream(ctx, &req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	flags := os.O_CREATE | os.O_WRONLY
+	switch {
+	case resp.StatusCode == http.StatusPartialContent && offset > 0:
+		start, total, ok := parseContentRange(resp.Header.Get("Content-Range"))
+		if !ok || start != offset {
+			return NewBrowserErrorWithContext(ErrHTTPError, "server resumed at the wrong offset", req.URL)
+		}
+		flags |= os.O_APPEND
+		dm.setTotal(task, total)
+	case resp.StatusCode == http.StatusRequestedRangeNotSatisfiable && offset > 0:
+		// Everything had already arrived
+		if _, total, ok := parseContentRange(resp.Header.Get("Content-Range")); ok && total == offset {
+			return os.Rename(partPath, task.info.Path)
+		}
+		return NewBrowserErrorWithContext(ErrHTTPError, "server responded with "+resp.Status, req.URL)
+	case resp.StatusCode >= 200 && resp.StatusCode < 300:
+		// The server sent the whole file, so start over
+		flags |= os.O_TRUNC
+		dm.mutex.Lock()
+		task.info.ReceivedBytes = 0
+		task.info.TotalBytes = resp.ContentLength
+		if task.info.TotalBytes < 0 {
+			task.info.TotalBytes = -1
+		}
+		task.info.ETag = strongETag(resp.Header.Get("ETag"))
+		task.info.LastModified = resp.Header.Get("Last-Modified")
+		dm.mutex.Unlock()
+	default:
+		return NewBrowserErrorWithContext(ErrHTTPError, "server responded with "+resp.Status, req.URL)
+	}
+
+	return dm.write(task, resp.Body, flags)
+}
+
+// write copies body into the partial file of task, opened with flags, and
+// renames it into place once complete.
+func (dm *downloadManager) write(task *downloadTask, body io.Reader, flags int) error {
+	partPath := task.info.Path + DownloadPartialExtension
+	file, err := os.OpenFile(partPath, flags, 0o644)
+	if err != nil {
+		return err
+	}
+
+	buffer := make([]byte, DownloadBufferSize)
+	for {
+		n, readErr := body.Read(buffer)
+		if n > 0 {
+			if _, err := file.Write(buffer[:n]); err != nil {
+				file.Close()
+				return err
+			}
+			dm.mutex.Lock()
+			task.info.ReceivedBytes += int64(n)
+			dm.mutex.Unlock()
+		}
+		if readErr == io.EOF {
+			break
+		}
+		if readErr != nil {
+			file.Close()
+			return readErr
+		}
+	}
+
+	if err := file.Close(); err != nil {
+		return err
+	}
+	return os.Rename(partPath, task.info.Path)
+}
+
+func (dm *downloadManager) setTotal(task *downloadTask, total int64) {
+	dm.mutex.Lock()
+	defer dm.mutex.Unlock()
+	task.info.TotalBytes = total
+}
+
+func (dm *downloadManager) Pause(id string) error {
+	return dm.stop(id, DownloadPaused)
+}
+
+func (dm *downloadManager) Resume(id string) error {
+	dm.mutex.Lock()
+	defer dm.mutex.Unlock()
+
+	task, ok := dm.tasks[id]
+	if !ok {
+		return NewBrowserErrorWithContext(ErrInvalidInput, "unknown download", id)
+	}
+	if task.info.State != DownloadPaused && task.info.State != DownloadFailed {
+		return NewBrowserErrorWithContext(ErrInvalidInput, "download is "+task.info.State.String(), id)
+	}
+	if !isGetRequest(&task.req) {
+		return NewBrowserErrorWithContext(ErrFormResubmission, "resuming would resubmit a form", id)
+	}
+
+	// Trust the partial file over the list, which may be older
+	received := int64(0)
+	if stat, err := os.Stat(task.info.Path + DownloadPartialExtension); err == nil {
+		received = stat.Size()
+	}
+	task.info.ReceivedBytes = received
+
+	dm.startLocked(task)
+	return nil
+}
+
+func (dm *downloadManager) Cancel(id string) error {
+	return dm.stop(id, DownloadCancelled)
+}
+
+// stop ends a running download in state, waiting for it to finish writing.
+// A paused or failed download can still be cancelled.
+func (dm *downloadManager) stop(id string, state DownloadState) error {
+	dm.mutex.Lock()
+	task, ok := dm.tasks[id]
+	if !ok {
+		dm.mutex.Unlock()
+		return NewBrowserErrorWithContext(ErrInvalidInput, "unknown download", id)
+	}
+
+	switch {
+	case task.info.State == DownloadInProgress:
+		task.stopAs = state
+		task.cancel()
+		done := task.done
+		dm.mutex.Unlock()
+		<-done
+		return nil
+	case state == DownloadCancelled && (task.info.State == DownloadPaused || task.info.State == DownloadFailed):
+		task.info.State = DownloadCancelled
+		dm.mutex.Unlock()
+		os.Remove(task.info.Path + DownloadPartialExtension)
+		dm.saveLogged()
+		return nil
+	default:
+		current := task.info.State
+		dm.mutex.Unlock()
+		return NewBrowserErrorWithContext(ErrInvalidInput, "download is "+current.String(), id)
+	}
+}
+
+func (dm *downloadManager) Remove(id string) bool {
+	dm.mutex.Lock()
+	task, ok := dm.tasks[id]
+	if !ok || task.info.State == DownloadInProgress {
+		dm.mutex.Unlock()
+		return false
+	}
+
+	delete(dm.tasks, id)
+	for i, existing := range dm.order {
+		if existing == id {
+			dm.order = append(dm.order[:i], dm.order[i+1:]...)
+			break
+		}
+	}
+	dm.mutex.Unlock()
+
+	dm.saveLogged()
+	return true
+}
+
+func (dm *downloadManager) Get(id string) (Download, bool) {
+	dm.mutex.Lock()
+	defer dm.mutex.Unlock()
+
+	task, ok := dm.tasks[id]
+	if !ok {
+		return Download{}, false
+	}
+	return task.info, true
+}
+
+// List returns the downloads, oldest first.
+func (dm *downloadManager) List() []Download {
+	dm.mutex.Lock()
+	defer dm.mutex.Unlock()
+
+	downloads := make([]Download, 0, len(dm.order))
+	for _, id := range dm.order {
+		downloads = append(downloads, dm.tasks[id].info)
+	}
+	return downloads
+}
+
+func (dm *downloadManager) Close() error {
+	dm.mutex.Lock()
+	var running []chan struct{}
+	for _, task := range dm.tasks {
+		if task.info.State == DownloadInProgress {
+			task.stopAs = DownloadPaused
+			task.cancel()
+			running = append(running, task.done)
+		}
+	}
+	dm.mutex.Unlock()
+
+	for _, done := range running {
+		<-done
+	}
+	return dm.save()
+}
+
+// reservePathLocked returns a path in the download directory for name that
+// no file, partial file or other download uses yet, numbering it if needed.
+func (dm *downloadManager) reservePathLocked(name string) string {
+	ext := filepath.Ext(name)
+	base := strings.TrimSuffix(name, ext)
+
+	for n := 0; ; n++ {
+		candidate := name
+		if n > 0 {
+			candidate = fmt.Sprintf("%s (%d)%s", base, n, ext)
+		}
+		candidatePath := filepath.Join(dm.dir, candidate)
+
+		if _, err := os.Lstat(candidatePath); err == nil {
+			continue
+		}
+		if _, err := os.Lstat(candidatePath + DownloadPartialExtension); err == nil {
+			continue
+		}
+		if dm.pathInUseLocked(candidatePath) {
+			continue
+		}
+		return candidatePath
+	}
+}
+
+func (dm *downloadManager) pathInUseLocked(candidate string) bool {
+	for _, task := range dm.tasks {
+		if task.info.Path == candidate && task.info.State != DownloadCancelled {
+			return true
+		}
+	}
+	return false
+}
+
+func (dm *downloadManager) saveLogged() {
+	if err := dm.save(); err != nil {
+		log.Printf("Failed to save downloads to %s: %v", dm.path, err)
+	}
+}
+
+func (dm *downloadManager) save() error {
+	if dm.path == "" {
+		return nil
+	}
+
+	dm.saveMutex.Lock()
+	defer dm.saveMutex.Unlock()
+
+	var downloads []Download
+	for _, download := range dm.List() {
+		if !download.Private {
+			downloads = append(downloads, download)
+		}
+	}
+
+	data, err := json.MarshalIndent(downloads, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(dm.path), 0o700); err != nil {
+		return err
+	}
+
+	tmp := dm.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, dm.path)
+}
+
+func (dm *downloadManager) load() error {
+	data, err := os.ReadFile(dm.path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+
+	var downloads []Download
+	if err := json.Unmarshal(data, &downloads); err != nil {
+		return NewBrowserErrorWithContext(ErrParsingFailed, "invalid downloads file: "+err.Error(), dm.path)
+	}
+
+	for _, download := range downloads {
+		if download.ID == "" || dm.tasks[download.ID] != nil {
+			continue
+		}
+		// The browser closed while it was running
+		if download.State == DownloadInProgress {
+			download.State = DownloadPaused
+		}
+		dm.tasks[download.ID] = &downloadTask{
+			info: download,
+			req:  FetchRequest{URL: download.URL},
+		}
+		dm.order = append(dm.order, download.ID)
+	}
+	return nil
+}
+
+// isDownloadResponse reports whether a navigation response should be saved
+// rather than shown: it is an attachment, or of a type pages cannot display.
+func isDownloadResponse(header http.Header) bool {
+	if disposition, _, err := mime.ParseMediaType(header.Get("Content-Disposition")); err == nil && disposition == "attachment" {
+		return true
+	}
+
+	contentType := header.Get("Content-Type")
+	if contentType == "" {
+		return false
+	}
+	probe := &Response{}
+	probe.ContentType, _ = parseContentType(contentType)
+	return !probe.IsHTML() && !probe.IsImage() && !probe.IsText()
+}
+
+// downloadFileName picks the name to save resp as: the Content-Disposition
+// filename, or else the last segment of the URL path.
+func downloadFileName(resp *Response) string {
+	name := ""
+	if _, params, err := mime.ParseMediaType(resp.Header.Get("Content-Disposition")); err == nil && params["filename"] != "" {
+		// Only the last element counts; directories in the name are ignored
+		name = path.Base(strings.ReplaceAll(params["filename"], `\`, "/"))
+	}
+	if name == "" {
+		if parsed, err := url.Parse(resp.URL); err == nil {
+			name = path.Base(parsed.Path)
+		}
+	}
+
+	name = sanitizeFileName(name)
+	if name == "" {
+		name = DefaultDownloadName
+	}
+
+	if filepath.Ext(name) == "" && resp.ContentType != "" {
+		if exts, err := mime.ExtensionsByType(resp.ContentType); err == nil && len(exts) > 0 {
+			name += exts[0]
+		}
+	}
+	return name
+}
+
+// sanitizeFileName keeps a server-supplied name inside the download
+// directory and free of characters file systems reject.
+func sanitizeFileName(name string) string {
+	name = strings.Map(func(r rune) rune {
+		switch {
+		case r < 0x20 || r == 0x7f:
+			return -1
+		case strings.ContainsRune(`/\:*?"<>|`, r):
+			return '_'
+		default:
+			return r
+		}
+	}, name)
+
+	name = strings.Trim(strings.TrimSpace(name), ".")
+	if len(name) > MaxDownloadNameLength {
+		ext := filepath.Ext(name)
+		if len(ext) > MaxDownloadNameLength/2 {
+			ext = ""
+		}
+		name = name[:MaxDownloadNameLength-len(ext)] + ext
+	}
+	return name
+}
+
+// strongETag returns etag unless it is weak; If-Range only accepts strong
+// validators.
+func strongETag(etag string) string {
+	if strings.HasPrefix(etag, "W/") {
+		return ""
+	}
+	return etag
+}
+
+// parseContentRange parses "bytes start-end/total" and "bytes */total". The
+// total is -1 when the server gives it as "*".
+func parseContentRange(value string) (start, total int64, ok bool) {
+	value, found := strings.CutPrefix(strings.TrimSpace(value), "bytes ")
+	if !found {
+		return 0, 0, false
+	}
+
+	span, size, found := strings.Cut(value, "/")
+	if !found {
+		return 0, 0, false
+	}
+
+	total = -1
+	if size != "*" {
+		parsed, err := strconv.ParseInt(size, 10, 64)
+		if err != nil || parsed < 0 {
+			return 0, 0, false
+		}
+		total = parsed
+	}
+
+	if span == "*" {
+		return 0, total, true
+	}
+	first, _, found := strings.Cut(span, "-")
+	if !found {
+		return 0, 0, false
+	}
+	start, err := strconv.ParseInt(first, 10, 64)
+	if err != nil || start < 0 {
+		return 0, 0, false
+	}
+	return start, total, true
+}
@@ -2,6 +2,11 @@ package browser
 
 import (
 	"context"
+	"errors"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
 	"sync"
 )
 
@@ -9,36 +14,232 @@ type Engine interface {
 	GetTabCount() int
 	GetTab(idx int) Tab
 	AddTab() Tab
+	AddPrivateTab() Tab
 	CloseTab(idx int) error
-	RefreshTab(idx int) error
+	// SetActiveTab gives the requests of the tab at idx precedence over
+	// those of background tabs.
+	SetActiveTab(idx int)
+	RefreshTab(idx int, reloadType ReloadType) error
+	StopLoading(tabIdx int) error
 	Navigate(ctx context.Context, tabIdx int, url string) error
+	FollowLink(ctx context.Context, tabIdx int, node Node) error
+	// HoverLink tells the engine the pointer is resting on node. When hover
+	// prefetching is enabled, the page its link points to is prefetched.
+	HoverLink(tabIdx int, node Node)
+	// SubmitForm submits form in the tab, as if submitter, which may be nil,
+	// had been clicked.
+	SubmitForm(ctx context.Context, tabIdx int, form, submitter Node) error
+	// ResubmitForm reloads a page that was the result of a form POST by
+	// sending the form again. RefreshTab refuses to, so the user can be
+	// asked first.
+	ResubmitForm(ctx context.Context, tabIdx int) error
+	// GetPendingRefresh returns the navigation or reload the tab's page asked
+	// for with a Refresh header or <meta http-equiv="refresh">, or nil.
+	GetPendingRefresh(tabIdx int) *Refresh
+	// CancelRefresh keeps the tab on its page instead of refreshing it.
+	CancelRefresh(tabIdx int)
 	GetURLHandler() URLHandler
+	GetSchemeRegistry() SchemeRegistry
+	GetHistory() History
+	GetCookieJar() CookieJar
+	GetContentBlocker() ContentBlocker
+	GetHSTSStore() HSTSStore
+	GetDownloadManager() DownloadManager
+	Shutdown() error
 	SetDebugMode(enabled bool)
 	GetDebugMode() bool
 }
 
+// ReloadType selects how RefreshTab treats cached responses.
+type ReloadType int
+
+const (
+	// ReloadNormal revalidates the page with the server before reusing the cache.
+	ReloadNormal ReloadType = iota
+	// ReloadBypassCache fetches the page and its stylesheets from the network.
+	ReloadBypassCache
+)
+
+// navigation is the in-flight load of a tab's main document.
+type navigation struct {
+	cancel context.CancelFunc
+}
+
 type engine struct {
 	tabs  []Tab
 	mutex sync.RWMutex
 
-	apiHandler      APIHandler
-	documentBuilder DocumentBuilder
-	urlHandler      URLHandler
+	apiHandler     APIHandler
+	urlHandler     URLHandler
+	history        History
+	contentBlocker ContentBlocker
+	downloads      DownloadManager
+
+	navigations     map[string]*navigation
+	refreshes       map[string]*scheduledRefresh
+	navigationMutex sync.Mutex
+
+	appName     string
+	appVersion  string
+	profileDir  string
+	harRecorder HARRecorder
+	harPath     string
+
+	mixedContentMode MixedContentMode
+	autoRefresh      bool
+	hoverPrefetch    bool
 
 	debugMode      bool
 	isShuttingDown bool
 }
 
-func NewEngine() Engine {
-	return &engine{
-		tabs:            make([]Tab, 0),
-		apiHandler:      NewAPIHandler(),
-		documentBuilder: NewDocumentBuilder(),
-		urlHandler:      NewURLHandler(),
-		debugMode:       false,
-		isShuttingDown:  false,
+func NewEngine(opts ...EngineOption) Engine {
+	cfg := &engineConfig{
+		appName:    DefaultAppName,
+		appVersion: DefaultAppVersion,
+	}
+	for _, opt := range opts {
+		opt(cfg)
+	}
+
+	apiHandlerOptions := cfg.apiHandlerOptions
+	if cfg.profileDir != "" {
+		cookiePath := filepath.Join(cfg.profileDir, CookieFileName)
+		jar, err := NewCookieJar(cookiePath)
+		if err != nil {
+			log.Printf("Failed to load cookies from %s: %v", cookiePath, err)
+		}
+		// Explicit handler options still win over the profile's jar
+		apiHandlerOptions = append([]APIHandlerOption{WithCookieJar(jar)}, apiHandlerOptions...)
+	}
+
+	hsts := newProfileHSTSStore(cfg)
+	// Like the cookie jar, an explicit WithHSTSStore replaces the profile's
+	apiHandlerOptions = append([]APIHandlerOption{WithHSTSStore(hsts)}, apiHandlerOptions...)
+
+	contentBlocker := newProfileContentBlocker(cfg)
+	// The blocker runs first so blocked requests never reach other interceptors
+	apiHandlerOptions = append([]APIHandlerOption{WithRequestInterceptors(contentBlocker)}, apiHandlerOptions...)
+
+	var harRecorder HARRecorder
+	if cfg.harPath != "" {
+		harRecorder = NewHARRecorder(cfg.appName, cfg.appVersion)
+		apiHandlerOptions = append(apiHandlerOptions, WithHARRecorder(harRecorder))
+	}
+
+	apiHandler := NewAPIHandler(apiHandlerOptions...)
+
+	downloads := newProfileDownloadManager(cfg, apiHandler)
+
+	e := &engine{
+		tabs:             make([]Tab, 0),
+		apiHandler:       apiHandler,
+		urlHandler:       NewURLHandlerWithSchemes(apiHandler.GetSchemeRegistry()),
+		history:          NewHistory(),
+		contentBlocker:   contentBlocker,
+		downloads:        downloads,
+		navigations:      make(map[string]*navigation),
+		refreshes:        make(map[string]*scheduledRefresh),
+		appName:          cfg.appName,
+		appVersion:       cfg.appVersion,
+		profileDir:       cfg.profileDir,
+		harRecorder:      harRecorder,
+		harPath:          cfg.harPath,
+		mixedContentMode: cfg.mixedContentMode,
+		autoRefresh:      !cfg.autoRefreshDisabled,
+		hoverPrefetch:    cfg.hoverPrefetch,
+		debugMode:        false,
+		isShuttingDown:   false,
+	}
+
+	// Embedders may have registered their own handlers for these already
+	schemes := apiHandler.GetSchemeRegistry()
+	if !schemes.IsRegistered("about") {
+		schemes.Register("about", newAboutHandler(e))
 	}
+	if !schemes.IsRegistered(viewSourceScheme) {
+		schemes.Register(viewSourceScheme, newViewSourceHandler(apiHandler, e.urlHandler))
+	}
+
+	return e
 }
+
+// newProfileContentBlocker loads the allowlist and filter lists kept in the
+// profile, along with any lists given explicitly.
+func newProfileContentBlocker(cfg *engineConfig) ContentBlocker {
+	allowlistPath := ""
+	filterLists := cfg.filterLists
+	if cfg.profileDir != "" {
+		allowlistPath = filepath.Join(cfg.profileDir, AllowlistFileName)
+		profileLists, _ := filepath.Glob(filepath.Join(cfg.profileDir, FilterListDirName, "*"+FilterListExtension))
+		filterLists = append(profileLists, filterLists...)
+	}
+
+	blocker, err := NewContentBlocker(allowlistPath)
+	if err != nil {
+		log.Printf("Failed to load content blocking allowlist from %s: %v", allowlistPath, err)
+	}
+	for _, path := range filterLists {
+		if err := blocker.LoadFilterList(path); err != nil {
+			log.Printf("Failed to load filter list %s: %v", path, err)
+		}
+	}
+	return blocker
+}
+
+// newProfileHSTSStore loads the HSTS entries saved in the profile and the
+// preload lists, from the profile and given explicitly.
+func newProfileHSTSStore(cfg *engineConfig) HSTSStore {
+	storePath := ""
+	preloadLists := cfg.hstsPreloadLists
+	if cfg.profileDir != "" {
+		storePath = filepath.Join(cfg.profileDir, HSTSFileName)
+		profileList := filepath.Join(cfg.profileDir, HSTSPreloadFileName)
+		if _, err := os.Stat(profileList); err == nil {
+			preloadLists = append([]string{profileList}, preloadLists...)
+		}
+	}
+
+	store, err := NewHSTSStore(storePath)
+	if err != nil {
+		log.Printf("Failed to load HSTS entries from %s: %v", storePath, err)
+	}
+	for _, path := range preloadLists {
+		if err := store.LoadPreloadList(path); err != nil {
+			log.Printf("Failed to load HSTS preload list %s: %v", path, err)
+		}
+	}
+	return store
+}
+
+// newProfileDownloadManager saves files to the configured directory, or the
+// user's Downloads folder, and keeps the list of downloads in the profile.
+func newProfileDownloadManager(cfg *engineConfig, apiHandler APIHandler) DownloadManager {
+	dir := cfg.downloadDir
+	if dir == "" {
+		dir = defaultDownloadDir()
+	}
+
+	listPath := ""
+	if cfg.profileDir != "" {
+		listPath = filepath.Join(cfg.profileDir, DownloadsFileName)
+	}
+
+	downloads, err := NewDownloadManager(apiHandler, dir, listPath)
+	if err != nil {
+		log.Printf("Failed to load downloads from %s: %v", listPath, err)
+	}
+	return downloads
+}
+
+func defaultDownloadDir() string {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return filepath.Join(os.TempDir(), DefaultDownloadDirName)
+	}
+	return filepath.Join(home, DefaultDownloadDirName)
+}
+
 func (e *engine) GetTabCount() int {
 	e.mutex.RLock()
 	defer e.mutex.RUnlock()
@@ -66,6 +267,16 @@ func (e *engine) AddTab() Tab {
 	return tab
 }
 
+func (e *engine) AddPrivateTab() Tab {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+
+	tab := NewPrivateTab()
+	e.tabs = append(e.tabs, tab)
+
+	return tab
+}
+
 func (e *engine) CloseTab(idx int) error {
 	e.mutex.Lock()
 	defer e.mutex.Unlock()
@@ -74,67 +285,518 @@ func (e *engine) CloseTab(idx int) error {
 		return NewBrowserError(ErrInvalidInput, "invalid tab index")
 	}
 
+	e.stopNavigation(e.tabs[idx])
+	e.apiHandler.GetScheduler().CancelTab(e.tabs[idx].GetID())
+	e.apiHandler.GetHintQueue().CancelTab(e.tabs[idx].GetID())
+	e.contentBlocker.ResetBlockedCount(e.tabs[idx].GetID())
 	e.tabs = append(e.tabs[:idx], e.tabs[idx+1:]...)
 	return nil
 }
 
-func (e *engine) RefreshTab(idx int) error {
+// tabIndex returns where tab is in the tab strip, or -1 once it is closed.
+func (e *engine) tabIndex(tab Tab) int {
+	e.mutex.RLock()
+	defer e.mutex.RUnlock()
+
+	for idx, t := range e.tabs {
+		if t == tab {
+			return idx
+		}
+	}
+	return -1
+}
+
+func (e *engine) SetActiveTab(idx int) {
+	if tab := e.GetTab(idx); tab != nil {
+		e.apiHandler.GetScheduler().SetActiveTab(tab.GetID())
+	}
+}
+
+func (e *engine) RefreshTab(idx int, reloadType ReloadType) error {
 	tab := e.GetTab(idx)
 	if tab == nil {
 		return NewBrowserError(ErrInvalidInput, "invalid tab index")
 	}
 
-	return e.fetchContentForTab(context.Background(), idx, tab.GetURL())
+	if tab.GetFormSubmission() != nil {
+		return NewBrowserErrorWithContext(ErrFormResubmission, "the page was the result of a form submission", tab.GetURL())
+	}
+
+	mode := CacheModeRevalidate
+	if reloadType == ReloadBypassCache {
+		mode = CacheModeReload
+	}
+
+	err := e.fetchContentForTab(context.Background(), idx, &FetchRequest{URL: tab.GetURL(), CacheMode: mode})
+	if errors.Is(err, ErrDownloadStarted) {
+		return nil
+	}
+	return err
 }
 
 func (e *engine) Navigate(ctx context.Context, tabIdx int, rawURL string) error {
+	return e.navigate(ctx, tabIdx, &FetchRequest{URL: rawURL})
+}
+
+// navigate loads req.URL, which may still need normalizing, as a new
+// history entry of the tab.
+func (e *engine) navigate(ctx context.Context, tabIdx int, req *FetchRequest) error {
 	tab := e.GetTab(tabIdx)
 	if tab == nil {
 		return NewBrowserError(ErrInvalidInput, "invalid tab index")
 	}
 
+	rawURL := req.URL
 	normalizedURL, err := e.urlHandler.Normalize(rawURL)
 	if err != nil {
+		// The error page gets no history entry, which back and forward
+		// would otherwise load the invalid input from
+		e.stopNavigation(tab)
+		e.showErrorPage(tab, rawURL, err)
 		return err
 	}
 
 	tab.Navigate(normalizedURL)
-	return e.fetchContentForTab(ctx, tabIdx, normalizedURL)
+	normalized := *req
+	normalized.URL = normalizedURL
+	err = e.fetchContentForTab(ctx, tabIdx, &normalized)
+	if errors.Is(err, ErrDownloadStarted) {
+		// The tab keeps showing the page the download was started from
+		tab.AbandonNavigation(normalizedURL)
+		return nil
+	}
+	return err
+}
+
+func (e *engine) FollowLink(ctx context.Context, tabIdx int, node Node) error {
+	tab := e.GetTab(tabIdx)
+	if tab == nil {
+		return NewBrowserError(ErrInvalidInput, "invalid tab index")
+	}
+
+	link := FindEnclosingLink(node)
+	if link == nil {
+		return NewBrowserError(ErrInvalidInput, "node is not inside a link")
+	}
+
+	target, err := e.linkTarget(tab, link)
+	if err != nil || target == "" {
+		return err
+	}
+
+	referrer, policy := e.referrerFor(tab, link)
+	return e.navigate(ctx, tabIdx, &FetchRequest{URL: target, Referrer: referrer, ReferrerPolicy: policy})
+}
+
+// linkTarget returns the absolute URL link points to, or "" when it has no
+// href or only points within the page.
+func (e *engine) linkTarget(tab Tab, link Node) (string, error) {
+	href, _ := link.GetAttribute("href")
+	href = strings.TrimSpace(href)
+	if href == "" || strings.HasPrefix(href, "#") {
+		return "", nil
+	}
+
+	if baseURL := tab.GetURL(); baseURL != "" && !e.urlHandler.IsAbsoluteURL(href) {
+		return e.urlHandler.Resolve(baseURL, href)
+	}
+	return href, nil
+}
+
+func (e *engine) HoverLink(tabIdx int, node Node) {
+	if !e.hoverPrefetch {
+		return
+	}
+	// Prefetched pages are shared with every tab, so private ones give none
+	tab := e.GetTab(tabIdx)
+	if tab == nil || tab.IsPrivate() {
+		return
+	}
+	link := FindEnclosingLink(node)
+	if link == nil {
+		return
+	}
+
+	target, err := e.linkTarget(tab, link)
+	if err != nil || target == "" {
+		return
+	}
+	normalizedURL, err := e.urlHandler.Normalize(target)
+	if err != nil {
+		return
+	}
+	if scheme := urlScheme(normalizedURL); scheme != "http" && scheme != "https" {
+		return
+	}
+
+	referrer, policy := e.referrerFor(tab, link)
+	e.apiHandler.GetHintQueue().Add(ResourceHint{
+		Type:           HintPrefetch,
+		URL:            normalizedURL,
+		Referrer:       referrer,
+		ReferrerPolicy: policy,
+		TabID:          tab.GetID(),
+	})
+}
+
+// referrerFor returns the referrer of a navigation started from element, a
+// link or form in the tab's page. rel=noreferrer sends none, and a
+// referrerpolicy attribute overrides the page's policy.
+func (e *engine) referrerFor(tab Tab, element Node) (string, ReferrerPolicy) {
+	if hasLinkType(element, "noreferrer") {
+		return "", ""
+	}
+
+	var policy ReferrerPolicy
+	if doc := tab.GetDocument(); doc != nil {
+		policy = doc.GetReferrerPolicy()
+	}
+	if value, ok := element.GetAttribute("referrerpolicy"); ok {
+		if parsed, ok := ParseReferrerPolicy(value); ok {
+			policy = parsed
+		}
+	}
+	return tab.GetURL(), policy
+}
+
+func (e *engine) SubmitForm(ctx context.Context, tabIdx int, form, submitter Node) error {
+	tab := e.GetTab(tabIdx)
+	if tab == nil {
+		return NewBrowserError(ErrInvalidInput, "invalid tab index")
+	}
+	if form == nil {
+		form = FindFormOwner(submitter)
+	}
+
+	submission, err := BuildFormSubmission(form, submitter, tab.GetURL())
+	if err != nil || submission == nil {
+		return err
+	}
+	submission.Referrer, submission.ReferrerPolicy = e.referrerFor(tab, form)
+	if !submission.IsPost() {
+		return e.navigate(ctx, tabIdx, submission.request())
+	}
+
+	tab.NavigateForm(submission)
+	return e.postForm(ctx, tabIdx, tab, submission)
 }
 
-func (e *engine) fetchContentForTab(ctx context.Context, tabIdx int, normalizedURL string) error {
+func (e *engine) ResubmitForm(ctx context.Context, tabIdx int) error {
 	tab := e.GetTab(tabIdx)
 	if tab == nil {
 		return NewBrowserError(ErrInvalidInput, "invalid tab index")
 	}
 
-	content, err := e.apiHandler.FetchContent(ctx, normalizedURL)
+	submission := tab.GetFormSubmission()
+	if submission == nil {
+		return e.RefreshTab(tabIdx, ReloadNormal)
+	}
+	return e.postForm(ctx, tabIdx, tab, submission)
+}
+
+// postForm loads the response to a form POST into the tab, whose current
+// history entry is the submission's.
+func (e *engine) postForm(ctx context.Context, tabIdx int, tab Tab, submission *FormSubmission) error {
+	err := e.fetchContentForTab(ctx, tabIdx, submission.request())
+	if errors.Is(err, ErrDownloadStarted) {
+		tab.AbandonNavigation(submission.URL)
+		return nil
+	}
+	return err
+}
+
+// fetchContentForTab loads the response to req, whose URL is normalized, into
+// the tab.
+func (e *engine) fetchContentForTab(ctx context.Context, tabIdx int, req *FetchRequest) error {
+	normalizedURL := req.URL
+	tab := e.GetTab(tabIdx)
+	if tab == nil {
+		return NewBrowserError(ErrInvalidInput, "invalid tab index")
+	}
+
+	navCtx, nav := e.beginNavigation(ctx, tab)
+	defer e.endNavigation(tab, nav)
+	e.contentBlocker.ResetBlockedCount(tab.GetID())
+
+	doc, resp, err := e.loadDocument(navCtx, tab, req)
+	if errors.Is(err, ErrDownloadStarted) {
+		return err
+	}
 	if err != nil {
-		return NewBrowserError(ErrNetworkTimeout, err.Error())
+		// Built outside the commit so no engine locks are taken while the
+		// navigation lock is held
+		errorPage := e.buildErrorPage(normalizedURL, err)
+		committed := e.commitNavigation(tab, nav, func() {
+			if errorPage != nil {
+				tab.SetDocument(errorPage)
+			}
+			tab.SetSecurityInfo(nil)
+		})
+		if !committed {
+			return NewBrowserErrorWithContext(ErrRequestCancelled, "navigation was superseded", normalizedURL)
+		}
+		return err
+	}
+
+	refresh := e.newRefresh(resp, doc)
+	committed := e.commitNavigation(tab, nav, func() {
+		tab.SetURL(resp.URL)
+		// After a 303 or similar redirect, reloading fetches the new page
+		// with a GET and needs no confirmation
+		if !isGetRequest(req) && resp.Method != req.Method {
+			tab.SetFormSubmission(nil)
+		}
+		tab.SetDocument(doc)
+		tab.SetSecurityInfo(resp.Security)
+		e.scheduleRefresh(tab, refresh)
+	})
+	if !committed {
+		return NewBrowserErrorWithContext(ErrRequestCancelled, "navigation was superseded", normalizedURL)
 	}
 
-	e.documentBuilder.SetBaseURL(normalizedURL)
+	if urlScheme(resp.URL) != "about" && !tab.IsPrivate() {
+		e.history.Add(resp.URL, doc.GetTitle())
+	}
+
+	return nil
+}
+
+// loadDocument fetches and builds the page navReq asks for. The response is
+// returned for where the page ended up and how it was secured.
+func (e *engine) loadDocument(ctx context.Context, tab Tab, navReq *FetchRequest) (Document, *Response, error) {
+	req := *navReq
+	req.Type = RequestTypeDocument
+	req.CookieJar = tab.GetCookieJar()
+	req.TabID = tab.GetID()
+	req.OnRetry = tab.SetLoadAttempt
 
-	doc, err := e.documentBuilder.Build(content)
+	resp, err := e.apiHandler.Fetch(ctx, &req)
 	if err != nil {
-		return NewBrowserError(ErrParsingFailed, "failed to build document: "+err.Error())
+		return nil, nil, NewNetworkError(err, req.URL)
+	}
+
+	if !resp.IsSuccess() {
+		return nil, nil, NewHTTPError(resp)
+	}
+
+	if resp.IsDownload() {
+		downloadReq := &FetchRequest{
+			Referrer:       req.Referrer,
+			ReferrerPolicy: req.ReferrerPolicy,
+			CookieJar:      tab.GetCookieJar(),
+			TabID:          tab.GetID(),
+			FirstPartyURL:  resp.URL,
+		}
+		if _, err := e.downloads.Start(downloadReq, resp, tab.IsPrivate()); err != nil {
+			return nil, nil, err
+		}
+		return nil, resp, NewBrowserErrorWithContext(ErrDownloadStarted, "saving to "+e.downloads.Directory(), resp.URL)
+	}
+
+	content, err := e.renderableContent(resp)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	builder := e.newDocumentBuilder()
+	// Relative URLs resolve against where the page ended up, not what was typed
+	builder.SetBaseURL(resp.URL)
+	builder.SetCharset(resp.Encoding)
+	builder.SetCookieJar(tab.GetCookieJar())
+	builder.SetTabID(tab.GetID())
+	builder.SetUserStyleSheet(e.contentBlocker.ElementHidingCSS(resp.URL))
+	if policy, ok := ParseReferrerPolicy(strings.Join(resp.Header.Values("Referrer-Policy"), ",")); ok {
+		builder.SetReferrerPolicy(policy)
+	}
+	builder.SetContentSecurityPolicy(NewContentSecurityPolicy(resp.Header))
+	// A hard reload must not pick up stale stylesheets either; a normal
+	// reload leaves their freshness to the cache
+	if req.CacheMode == CacheModeReload {
+		builder.SetCacheMode(CacheModeReload)
+	}
+
+	doc, err := builder.Build(ctx, content)
+	if err != nil {
+		return nil, nil, NewBrowserError(ErrParsingFailed, "failed to build document: "+err.Error())
+	}
+
+	return doc, resp, nil
+}
+
+// newDocumentBuilder returns a builder for a single navigation, so concurrent
+// loads in different tabs never share parser or base URL state.
+func (e *engine) newDocumentBuilder() DocumentBuilder {
+	builder := NewDocumentBuilder(e.apiHandler)
+	builder.SetDebugMode(e.GetDebugMode())
+	builder.SetMixedContentMode(e.mixedContentMode)
+	return builder
+}
+
+// showErrorPage replaces the tab's document with a generated page describing
+// err. The error itself is still returned to the caller by the navigation.
+func (e *engine) showErrorPage(tab Tab, failedURL string, err error) {
+	if doc := e.buildErrorPage(failedURL, err); doc != nil {
+		tab.SetDocument(doc)
+	}
+}
+
+func (e *engine) buildErrorPage(failedURL string, err error) Document {
+	doc, buildErr := e.newDocumentBuilder().Build(context.Background(), renderErrorPage(failedURL, err))
+	if buildErr != nil {
+		return nil
+	}
+	return doc
+}
+
+// beginNavigation makes nav the tab's current navigation, cancelling the
+// main fetch and stylesheet fetches of whichever navigation it replaces, and
+// any refresh the page asked for.
+func (e *engine) beginNavigation(ctx context.Context, tab Tab) (context.Context, *navigation) {
+	navCtx, cancel := context.WithCancel(ctx)
+	nav := &navigation{cancel: cancel}
+
+	e.navigationMutex.Lock()
+	defer e.navigationMutex.Unlock()
+
+	if previous, ok := e.navigations[tab.GetID()]; ok {
+		previous.cancel()
+	}
+	e.cancelRefreshLocked(tab)
+	e.navigations[tab.GetID()] = nav
+	tab.SetLoading(true)
+
+	return navCtx, nav
+}
+
+// commitNavigation runs commit only if nav is still the tab's current
+// navigation, so a stale result never replaces a newer document.
+func (e *engine) commitNavigation(tab Tab, nav *navigation, commit func()) bool {
+	e.navigationMutex.Lock()
+	defer e.navigationMutex.Unlock()
+
+	if e.navigations[tab.GetID()] != nav {
+		return false
 	}
+	commit()
+	return true
+}
+
+func (e *engine) endNavigation(tab Tab, nav *navigation) {
+	nav.cancel()
+
+	e.navigationMutex.Lock()
+	defer e.navigationMutex.Unlock()
+
+	if e.navigations[tab.GetID()] == nav {
+		delete(e.navigations, tab.GetID())
+		tab.SetLoading(false)
+	}
+}
 
-	tab.SetURL(normalizedURL)
-	tab.SetDocument(doc)
+func (e *engine) StopLoading(tabIdx int) error {
+	tab := e.GetTab(tabIdx)
+	if tab == nil {
+		return NewBrowserError(ErrInvalidInput, "invalid tab index")
+	}
 
+	e.stopNavigation(tab)
 	return nil
 }
 
+func (e *engine) stopNavigation(tab Tab) {
+	e.navigationMutex.Lock()
+	defer e.navigationMutex.Unlock()
+
+	if nav, ok := e.navigations[tab.GetID()]; ok {
+		nav.cancel()
+		delete(e.navigations, tab.GetID())
+	}
+	e.cancelRefreshLocked(tab)
+	tab.SetLoading(false)
+}
+
+// renderableContent returns HTML for the response, wrapping non-HTML text and
+// images in generated pages so they are never parsed as markup.
+func (e *engine) renderableContent(resp *Response) (string, error) {
+	switch {
+	case resp.IsHTML() || resp.ContentType == "":
+		return resp.Text(), nil
+	case resp.IsImage():
+		return renderImagePage(resp), nil
+	case resp.IsText():
+		return renderTextPage(resp), nil
+	default:
+		return "", NewBrowserErrorWithContext(ErrUnsupportedContent, "cannot display "+resp.ContentType, resp.URL)
+	}
+}
+
 func (e *engine) GetURLHandler() URLHandler {
 	return e.urlHandler
 }
 
+func (e *engine) GetSchemeRegistry() SchemeRegistry {
+	return e.apiHandler.GetSchemeRegistry()
+}
+
+func (e *engine) GetHistory() History {
+	return e.history
+}
+
+func (e *engine) GetCookieJar() CookieJar {
+	return e.apiHandler.GetCookieJar()
+}
+
+func (e *engine) GetContentBlocker() ContentBlocker {
+	return e.contentBlocker
+}
+
+func (e *engine) GetHSTSStore() HSTSStore {
+	return e.apiHandler.GetHSTSStore()
+}
+
+func (e *engine) GetDownloadManager() DownloadManager {
+	return e.downloads
+}
+
+// Shutdown pauses running downloads and saves persistent state such as
+// cookies, HSTS entries, the download list, the content blocking allowlist
+// and any HAR recording. The engine should not be used afterwards.
+func (e *engine) Shutdown() error {
+	e.mutex.Lock()
+	if e.isShuttingDown {
+		e.mutex.Unlock()
+		return nil
+	}
+	e.isShuttingDown = true
+	e.mutex.Unlock()
+
+	e.apiHandler.CancelAll()
+	e.navigationMutex.Lock()
+	for id, scheduled := range e.refreshes {
+		scheduled.timer.Stop()
+		delete(e.refreshes, id)
+	}
+	e.navigationMutex.Unlock()
+
+	var errs []error
+	errs = append(errs, e.downloads.Close())
+	if jar := e.apiHandler.GetCookieJar(); jar != nil {
+		errs = append(errs, jar.Save())
+	}
+	if hsts := e.apiHandler.GetHSTSStore(); hsts != nil {
+		errs = append(errs, hsts.Save())
+	}
+	errs = append(errs, e.contentBlocker.Save())
+	if e.harRecorder != nil {
+		errs = append(errs, e.harRecorder.Save(e.harPath))
+	}
+	return errors.Join(errs...)
+}
+
 func (e *engine) SetDebugMode(enabled bool) {
 	e.mutex.Lock()
 	defer e.mutex.Unlock()
 	e.debugMode = enabled
-	e.documentBuilder.SetDebugMode(enabled)
 }
 
 func (e *engine) GetDebugMode() bool {
@@ -1,24 +1,35 @@
 package browser
 
 import (
+	"context"
 	"errors"
 	"fmt"
+	"net"
 )
 
 // Error types for document building
 var (
-	ErrInvalidURL     = errors.New("invalid URL provided")
-	ErrNetworkTimeout = errors.New("network request timed out")
-	ErrHTTPError      = errors.New("HTTP error occurred")
-	ErrInvalidInput   = errors.New("invalid input provided")
-	ErrParsingFailed  = errors.New("parsing failed")
+	ErrInvalidURL         = errors.New("invalid URL provided")
+	ErrNetworkTimeout     = errors.New("network request timed out")
+	ErrHTTPError          = errors.New("HTTP error occurred")
+	ErrInvalidInput       = errors.New("invalid input provided")
+	ErrParsingFailed      = errors.New("parsing failed")
+	ErrAccessDenied       = errors.New("access denied")
+	ErrFileNotFound       = errors.New("file not found")
+	ErrUnsupportedContent = errors.New("unsupported content type")
+	ErrConnectionFailed   = errors.New("connection failed")
+	ErrRequestCancelled   = errors.New("request cancelled")
+	ErrRequestBlocked     = errors.New("request blocked")
+	ErrDownloadStarted    = errors.New("response is being downloaded")
+	ErrFormResubmission   = errors.New("reloading would resubmit a form")
 )
 
 // BrowserError represents a browser-specific error with context
 type BrowserError struct {
-	Type    error
-	Message string
-	Context string
+	Type       error
+	Message    string
+	Context    string
+	StatusCode int
 }
 
 func (e *BrowserError) Error() string {
@@ -28,6 +39,11 @@ func (e *BrowserError) Error() string {
 	return fmt.Sprintf("%v: %s", e.Type, e.Message)
 }
 
+// Unwrap exposes the error type so errors.Is(err, ErrHTTPError) works.
+func (e *BrowserError) Unwrap() error {
+	return e.Type
+}
+
 func NewBrowserError(errType error, message string) error {
 	return &BrowserError{
 		Type:    errType,
@@ -42,3 +58,33 @@ func NewBrowserErrorWithContext(errType error, message, context string) error {
 		Context: context,
 	}
 }
+
+// NewHTTPError reports a response whose status code is not a success.
+func NewHTTPError(resp *Response) error {
+	return &BrowserError{
+		Type:       ErrHTTPError,
+		Message:    "server responded with " + resp.Status,
+		Context:    resp.URL,
+		StatusCode: resp.StatusCode,
+	}
+}
+
+// NewNetworkError classifies a transport failure as a timeout or a connection
+// failure. Errors that are already a BrowserError are returned unchanged.
+func NewNetworkError(err error, requestURL string) error {
+	var browserErr *BrowserError
+	if errors.As(err, &browserErr) {
+		return err
+	}
+
+	if errors.Is(err, context.Canceled) {
+		return NewBrowserErrorWithContext(ErrRequestCancelled, err.Error(), requestURL)
+	}
+
+	var netErr net.Error
+	if errors.Is(err, context.DeadlineExceeded) || (errors.As(err, &netErr) && netErr.Timeout()) {
+		return NewBrowserErrorWithContext(ErrNetworkTimeout, err.Error(), requestURL)
+	}
+
+	return NewBrowserErrorWithContext(ErrConnectionFailed, err.Error(), requestURL)
+}
@@ -0,0 +1,228 @@
+package browser
+
+import (
+	"errors"
+	"fmt"
+	"html"
+	"io/fs"
+	"mime"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
+)
+
+type FileLoader interface {
+	Load(fileURL string) (*Response, error)
+	SetAllowedRoots(roots []string)
+	GetAllowedRoots() []string
+}
+
+type fileLoader struct {
+	roots []string
+	mutex sync.RWMutex
+}
+
+func NewFileLoader(roots ...string) FileLoader {
+	loader := &fileLoader{}
+	loader.SetAllowedRoots(roots)
+	return loader
+}
+
+func (fl *fileLoader) SetAllowedRoots(roots []string) {
+	resolved := make([]string, 0, len(roots))
+	for _, root := range roots {
+		if strings.TrimSpace(root) == "" {
+			continue
+		}
+		path, err := fl.resolvePath(root)
+		if err != nil {
+			continue
+		}
+		resolved = append(resolved, path)
+	}
+
+	fl.mutex.Lock()
+	defer fl.mutex.Unlock()
+	fl.roots = resolved
+}
+
+func (fl *fileLoader) GetAllowedRoots() []string {
+	fl.mutex.RLock()
+	defer fl.mutex.RUnlock()
+
+	roots := make([]string, len(fl.roots))
+	copy(roots, fl.roots)
+	return roots
+}
+
+func (fl *fileLoader) Load(fileURL string) (*Response, error) {
+	path, err := fl.pathFromURL(fileURL)
+	if err != nil {
+		return nil, err
+	}
+
+	resolvedPath, err := fl.resolvePath(path)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil, NewBrowserErrorWithContext(ErrFileNotFound, "no such file or directory", path)
+		}
+		return nil, NewBrowserErrorWithContext(ErrInvalidInput, err.Error(), path)
+	}
+
+	if !fl.isAllowed(resolvedPath) {
+		return nil, NewBrowserErrorWithContext(ErrAccessDenied, "path is outside the allowed file roots", path)
+	}
+
+	info, err := os.Stat(resolvedPath)
+	if err != nil {
+		return nil, NewBrowserErrorWithContext(ErrFileNotFound, err.Error(), path)
+	}
+
+	if info.IsDir() {
+		listing, err := fl.renderDirectoryListing(path, resolvedPath)
+		if err != nil {
+			return nil, err
+		}
+		header := http.Header{"Content-Type": []string{"text/html; charset=utf-8"}}
+		return NewResponse(fileURL, "", http.StatusOK, header, []byte(listing)), nil
+	}
+
+	if info.Size() > MaxFileSize {
+		return nil, NewBrowserErrorWithContext(ErrInvalidInput, "file is too large to display", path)
+	}
+
+	content, err := os.ReadFile(resolvedPath)
+	if err != nil {
+		return nil, NewBrowserErrorWithContext(ErrAccessDenied, err.Error(), path)
+	}
+
+	// Only the media type is taken from the extension; the charset of a local
+	// file is unknown and left to detection
+	header := make(http.Header)
+	if mediaType, _ := parseContentType(mime.TypeByExtension(filepath.Ext(resolvedPath))); mediaType != "" {
+		header.Set("Content-Type", mediaType)
+	}
+	header.Set("Last-Modified", info.ModTime().UTC().Format(http.TimeFormat))
+
+	return NewResponse(fileURL, "", http.StatusOK, header, content), nil
+}
+
+func (fl *fileLoader) pathFromURL(fileURL string) (string, error) {
+	parsed, err := url.Parse(fileURL)
+	if err != nil {
+		return "", NewBrowserError(ErrInvalidURL, "malformed file URL: "+err.Error())
+	}
+
+	if parsed.Scheme != "file" {
+		return "", NewBrowserError(ErrInvalidURL, "not a file URL: "+fileURL)
+	}
+
+	if parsed.Host != "" && parsed.Host != "localhost" {
+		return "", NewBrowserError(ErrInvalidURL, "remote file hosts are not supported: "+parsed.Host)
+	}
+
+	path := parsed.Path
+	if path == "" {
+		path = parsed.Opaque
+	}
+	if path == "" {
+		return "", NewBrowserError(ErrInvalidURL, "file URL has no path")
+	}
+
+	// file:///C:/dir on Windows carries a leading slash before the drive letter
+	if runtime.GOOS == "windows" && len(path) > 2 && path[0] == '/' && path[2] == ':' {
+		path = path[1:]
+	}
+
+	return filepath.FromSlash(path), nil
+}
+
+func (fl *fileLoader) resolvePath(path string) (string, error) {
+	absPath, err := filepath.Abs(path)
+	if err != nil {
+		return "", err
+	}
+
+	// Follow symlinks so a link inside a root cannot escape it
+	return filepath.EvalSymlinks(absPath)
+}
+
+func (fl *fileLoader) isAllowed(path string) bool {
+	fl.mutex.RLock()
+	defer fl.mutex.RUnlock()
+
+	for _, root := range fl.roots {
+		rel, err := filepath.Rel(root, path)
+		if err != nil {
+			continue
+		}
+		if rel == "." || (rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))) {
+			return true
+		}
+	}
+	return false
+}
+
+func (fl *fileLoader) renderDirectoryListing(displayPath, resolvedPath string) (string, error) {
+	entries, err := os.ReadDir(resolvedPath)
+	if err != nil {
+		return "", NewBrowserErrorWithContext(ErrAccessDenied, err.Error(), displayPath)
+	}
+
+	// Directories first, then files, each group alphabetically
+	sort.SliceStable(entries, func(i, j int) bool {
+		if entries[i].IsDir() != entries[j].IsDir() {
+			return entries[i].IsDir()
+		}
+		return entries[i].Name() < entries[j].Name()
+	})
+
+	title := html.EscapeString("Index of " + filepath.ToSlash(displayPath))
+
+	var page strings.Builder
+	page.WriteString("<!DOCTYPE html>\n<html>\n<head>\n")
+	fmt.Fprintf(&page, "<title>%s</title>\n", title)
+	page.WriteString("</head>\n<body>\n")
+	fmt.Fprintf(&page, "<h1>%s</h1>\n", title)
+	page.WriteString("<ul>\n")
+
+	parentPath := filepath.Dir(displayPath)
+	if parentPath != displayPath && fl.isAllowed(filepath.Dir(resolvedPath)) {
+		fmt.Fprintf(&page, "<li><a href=\"%s\">../</a></li>\n", html.EscapeString(fl.fileURL(parentPath)))
+	}
+
+	for _, entry := range entries {
+		name := entry.Name()
+		label := name
+		if entry.IsDir() {
+			label += "/"
+		}
+
+		details := ""
+		if info, err := entry.Info(); err == nil && !entry.IsDir() {
+			details = fmt.Sprintf(" <small>%d bytes, modified %s</small>",
+				info.Size(), info.ModTime().Format(DirectoryListingTimeFormat))
+		}
+
+		fmt.Fprintf(&page, "<li><a href=\"%s\">%s</a>%s</li>\n",
+			html.EscapeString(fl.fileURL(filepath.Join(displayPath, name))),
+			html.EscapeString(label),
+			details)
+	}
+
+	page.WriteString("</ul>\n</body>\n</html>\n")
+	return page.String(), nil
+}
+
+func (fl *fileLoader) fileURL(path string) string {
+	slashed := filepath.ToSlash(path)
+	if !strings.HasPrefix(slashed, "/") {
+		slashed = "/" + slashed
+	}
+	return (&url.URL{Scheme: "file", Path: slashed}).String()
+}
@@ -0,0 +1,341 @@
+package browser
+
+import (
+	"bufio"
+	"io"
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+// filterRule is a network rule from an Adblock Plus filter list.
+type filterRule struct {
+	text      string
+	exception bool
+	pattern   *regexp.Regexp
+	// anchorHost is the host of a ||host^ rule, used to index it
+	anchorHost string
+	// types limits the rule to these request types; empty means all but documents
+	types        map[RequestType]bool
+	excludeTypes map[RequestType]bool
+	// thirdParty is 1 for $third-party, -1 for ~third-party and 0 for either
+	thirdParty     int
+	includeDomains []string
+	excludeDomains []string
+}
+
+// hidingRule is an element-hiding rule (domains##selector).
+type hidingRule struct {
+	selector       string
+	exception      bool
+	includeDomains []string
+	excludeDomains []string
+}
+
+// filterRequest is what network rules are matched against.
+type filterRequest struct {
+	url        string
+	host       string
+	typ        RequestType
+	pageHost   string
+	thirdParty bool
+}
+
+// filterRequestTypes maps filter options to the request types the engine
+// makes. Options for other types are recognised so their rules are skipped
+// instead of being applied too broadly.
+var filterRequestTypes = map[string]RequestType{
+	"document":   RequestTypeDocument,
+	"stylesheet": RequestTypeStylesheet,
+	"image":      RequestTypeImage,
+	"other":      RequestTypeOther,
+}
+
+var unsupportedFilterTypes = map[string]bool{
+	"script": true, "object": true, "xmlhttprequest": true,
+	"subdocument": true, "ping": true, "media": true, "font": true,
+	"websocket": true, "webrtc": true, "popup": true,
+}
+
+// parseFilterList reads Adblock Plus syntax and returns the network and
+// element-hiding rules it understands. Other lines are skipped.
+func parseFilterList(r io.Reader) ([]*filterRule, []*hidingRule, error) {
+	var network []*filterRule
+	var hiding []*hidingRule
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1<<20)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "!") || strings.HasPrefix(line, "[") {
+			continue
+		}
+
+		if rule, ok := parseHidingRule(line); ok {
+			if rule != nil {
+				hiding = append(hiding, rule)
+			}
+			continue
+		}
+
+		if rule := parseNetworkRule(line); rule != nil {
+			network = append(network, rule)
+		}
+	}
+
+	return network, hiding, scanner.Err()
+}
+
+// parseHidingRule reports whether line is an element-hiding rule. Extended
+// syntaxes (#?#, #$#, :-abp-*) return a nil rule since they cannot be applied.
+func parseHidingRule(line string) (*hidingRule, bool) {
+	idx := strings.Index(line, "#")
+	for idx >= 0 {
+		rest := line[idx:]
+		switch {
+		case strings.HasPrefix(rest, "##"):
+			return newHidingRule(line[:idx], rest[2:], false), true
+		case strings.HasPrefix(rest, "#@#"):
+			return newHidingRule(line[:idx], rest[3:], true), true
+		case strings.HasPrefix(rest, "#?#"), strings.HasPrefix(rest, "#$#"), strings.HasPrefix(rest, "#@$#"), strings.HasPrefix(rest, "#@?#"):
+			return nil, true
+		}
+
+		next := strings.Index(line[idx+1:], "#")
+		if next < 0 {
+			break
+		}
+		idx += next + 1
+	}
+	return nil, false
+}
+
+func newHidingRule(domains, selector string, exception bool) *hidingRule {
+	selector = strings.TrimSpace(selector)
+	if selector == "" || strings.Contains(selector, ":-abp-") || strings.ContainsAny(selector, "{}") {
+		return nil
+	}
+
+	rule := &hidingRule{selector: selector, exception: exception}
+	rule.includeDomains, rule.excludeDomains = parseFilterDomains(domains, ",")
+	return rule
+}
+
+func parseNetworkRule(line string) *filterRule {
+	rule := &filterRule{text: line}
+
+	if strings.HasPrefix(line, "@@") {
+		rule.exception = true
+		line = line[2:]
+	}
+
+	pattern := line
+	options := ""
+	// A pattern in slashes is a regular expression and may contain $ itself
+	isRegexp := strings.HasPrefix(line, "/") && len(line) > 1
+	if dollar := strings.LastIndex(line, "$"); dollar >= 0 && (!isRegexp || dollar > strings.LastIndex(line, "/")) {
+		pattern, options = line[:dollar], line[dollar+1:]
+	}
+
+	if options != "" && !rule.parseOptions(options) {
+		return nil
+	}
+
+	var expr string
+	if len(pattern) > 1 && strings.HasPrefix(pattern, "/") && strings.HasSuffix(pattern, "/") {
+		expr = pattern[1 : len(pattern)-1]
+	} else {
+		expr = filterPatternToRegexp(pattern)
+		rule.anchorHost = filterAnchorHost(pattern)
+	}
+
+	compiled, err := regexp.Compile("(?i)" + expr)
+	if err != nil {
+		return nil
+	}
+	rule.pattern = compiled
+	return rule
+}
+
+// parseOptions applies the $options of a rule. It returns false when the rule
+// only targets request types the engine never makes.
+func (fr *filterRule) parseOptions(options string) bool {
+	hadTypes := false
+	for _, option := range strings.Split(options, ",") {
+		option = strings.ToLower(strings.TrimSpace(option))
+		negated := strings.HasPrefix(option, "~")
+		name := strings.TrimPrefix(option, "~")
+		typ, isType := filterRequestTypes[name]
+
+		switch {
+		case name == "third-party" || name == "3p":
+			fr.thirdParty = 1
+			if negated {
+				fr.thirdParty = -1
+			}
+		case name == "first-party" || name == "1p":
+			fr.thirdParty = -1
+			if negated {
+				fr.thirdParty = 1
+			}
+		case strings.HasPrefix(name, "domain="):
+			fr.includeDomains, fr.excludeDomains = parseFilterDomains(strings.TrimPrefix(name, "domain="), "|")
+		case isType:
+			if negated {
+				if fr.excludeTypes == nil {
+					fr.excludeTypes = make(map[RequestType]bool)
+				}
+				fr.excludeTypes[typ] = true
+			} else {
+				if fr.types == nil {
+					fr.types = make(map[RequestType]bool)
+				}
+				fr.types[typ] = true
+			}
+		case unsupportedFilterTypes[name]:
+			if !negated {
+				hadTypes = true
+			}
+		case name == "match-case", name == "important", name == "elemhide", name == "generichide":
+			// Accepted but have no effect here
+		default:
+			// Unknown options change the meaning of the rule, so skip it
+			return false
+		}
+	}
+
+	// A rule that only lists types we never load never matches
+	return len(fr.types) > 0 || !hadTypes
+}
+
+func parseFilterDomains(list, separator string) (include, exclude []string) {
+	for _, domain := range strings.Split(list, separator) {
+		domain = strings.ToLower(strings.TrimSpace(domain))
+		if domain == "" {
+			continue
+		}
+		if strings.HasPrefix(domain, "~") {
+			exclude = append(exclude, domain[1:])
+		} else {
+			include = append(include, domain)
+		}
+	}
+	return include, exclude
+}
+
+// filterPatternToRegexp converts the wildcard syntax of a network rule into
+// a regular expression.
+func filterPatternToRegexp(pattern string) string {
+	var expr strings.Builder
+
+	switch {
+	case strings.HasPrefix(pattern, "||"):
+		// Matches the scheme and any subdomains before the given domain
+		expr.WriteString(`^[a-z][a-z0-9+.-]*://([^/?#]*\.)?`)
+		pattern = pattern[2:]
+	case strings.HasPrefix(pattern, "|"):
+		expr.WriteString("^")
+		pattern = pattern[1:]
+	}
+
+	endAnchor := false
+	if strings.HasSuffix(pattern, "|") {
+		endAnchor = true
+		pattern = pattern[:len(pattern)-1]
+	}
+
+	for _, r := range pattern {
+		switch r {
+		case '*':
+			expr.WriteString(".*")
+		case '^':
+			// A separator is anything but a letter, digit or _-.%, or the end
+			expr.WriteString(`(?:[^a-z0-9_.%-]|$)`)
+		default:
+			expr.WriteString(regexp.QuoteMeta(string(r)))
+		}
+	}
+
+	if endAnchor {
+		expr.WriteString("$")
+	}
+	return expr.String()
+}
+
+// filterAnchorHost returns the host of a rule of the form ||host^... or
+// ||host/..., or "" when the rule cannot be indexed by host.
+func filterAnchorHost(pattern string) string {
+	if !strings.HasPrefix(pattern, "||") {
+		return ""
+	}
+
+	host := pattern[2:]
+	if end := strings.IndexAny(host, "^/:|"); end >= 0 {
+		host = host[:end]
+	} else {
+		return ""
+	}
+	if host == "" || strings.ContainsAny(host, "*") {
+		return ""
+	}
+	return strings.ToLower(host)
+}
+
+func (fr *filterRule) matches(req *filterRequest) bool {
+	if fr.excludeTypes[req.typ] {
+		return false
+	}
+	if len(fr.types) > 0 {
+		if !fr.types[req.typ] {
+			return false
+		}
+	} else if req.typ == RequestTypeDocument && !fr.exception {
+		// Like Adblock Plus, a rule blocks whole pages only with $document
+		return false
+	}
+
+	if fr.thirdParty == 1 && !req.thirdParty || fr.thirdParty == -1 && req.thirdParty {
+		return false
+	}
+
+	if !filterDomainsMatch(req.pageHost, fr.includeDomains, fr.excludeDomains) {
+		return false
+	}
+
+	return fr.pattern.MatchString(req.url)
+}
+
+func (hr *hidingRule) appliesTo(host string) bool {
+	return filterDomainsMatch(host, hr.includeDomains, hr.excludeDomains)
+}
+
+// filterDomainsMatch checks host against a rule's domain lists. A host
+// matches a listed domain when it is that domain or a subdomain of it.
+func filterDomainsMatch(host string, include, exclude []string) bool {
+	for _, domain := range exclude {
+		if domainMatches(host, domain) {
+			return false
+		}
+	}
+	if len(include) == 0 {
+		return true
+	}
+	for _, domain := range include {
+		if domainMatches(host, domain) {
+			return true
+		}
+	}
+	return false
+}
+
+func domainMatches(host, domain string) bool {
+	return host == domain || strings.HasSuffix(host, "."+domain)
+}
+
+func hostOf(rawURL string) string {
+	parsed, err := url.Parse(rawURL)
+	if err != nil {
+		return ""
+	}
+	return strings.ToLower(parsed.Hostname())
+}
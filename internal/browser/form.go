@@ -0,0 +1,494 @@
+package browser
+
+import (
+	"bytes"
+	"mime/multipart"
+	"net/http"
+	"net/textproto"
+	"net/url"
+	"strings"
+)
+
+// Form encodings accepted in enctype and formenctype.
+const (
+	FormEncodingURLEncoded = "application/x-www-form-urlencoded"
+	FormEncodingMultipart  = "multipart/form-data"
+	FormEncodingTextPlain  = "text/plain"
+)
+
+// FormField is one name/value pair of a form's data set. File controls
+// produce a field with IsFile set and Value holding the file name.
+type FormField struct {
+	Name   string
+	Value  string
+	IsFile bool
+}
+
+// FormSubmission is the request a submitted form navigates with. GET
+// submissions carry their data in URL and have no Body.
+type FormSubmission struct {
+	URL         string
+	Method      string
+	ContentType string
+	Body        []byte
+	// Referrer and ReferrerPolicy are kept so a resubmission sends the same
+	// Referer as the original.
+	Referrer       string
+	ReferrerPolicy ReferrerPolicy
+}
+
+// IsPost reports whether the submission sends its data in a request body,
+// which must not be repeated without asking the user.
+func (s *FormSubmission) IsPost() bool {
+	return s != nil && s.Method == http.MethodPost
+}
+
+// request returns the navigation request that sends the submission. POSTs
+// always go to the network.
+func (s *FormSubmission) request() *FetchRequest {
+	req := &FetchRequest{URL: s.URL, Referrer: s.Referrer, ReferrerPolicy: s.ReferrerPolicy}
+	if s.IsPost() {
+		req.Method = s.Method
+		req.Body = s.Body
+		req.Header = http.Header{"Content-Type": {s.ContentType}}
+		req.CacheMode = CacheModeReload
+	}
+	return req
+}
+
+// FindFormOwner returns the form node belongs to: the form its form
+// attribute names, or else its nearest <form> ancestor.
+func FindFormOwner(node Node) Node {
+	if node == nil {
+		return nil
+	}
+	if id, ok := node.GetAttribute("form"); ok {
+		owner := findElementByID(rootOf(node), id)
+		if owner == nil || owner.GetTag() != "form" {
+			return nil
+		}
+		return owner
+	}
+
+	for current := node.GetParent(); current != nil; current = current.GetParent() {
+		if current.GetType() == ElementNodeType && current.GetTag() == "form" {
+			return current
+		}
+	}
+	return nil
+}
+
+// FindEnclosingSubmitButton returns node itself or its nearest ancestor that
+// submits a form when activated, or nil if there is none.
+func FindEnclosingSubmitButton(node Node) Node {
+	for current := node; current != nil; current = current.GetParent() {
+		if current.GetType() == ElementNodeType && isSubmitButton(current) {
+			if FindFormOwner(current) == nil || isDisabledControl(current) {
+				return nil
+			}
+			return current
+		}
+	}
+	return nil
+}
+
+func isSubmitButton(node Node) bool {
+	switch node.GetTag() {
+	case "button":
+		buttonType, ok := node.GetAttribute("type")
+		return !ok || strings.EqualFold(strings.TrimSpace(buttonType), "submit")
+	case "input":
+		switch inputType(node) {
+		case "submit", "image":
+			return true
+		}
+	}
+	return false
+}
+
+// BuildFormSubmission encodes form's data set and works out where and how
+// it is sent. submitter is the button that submitted the form, or nil; its
+// formaction, formmethod and formenctype attributes override the form's.
+// baseURL is the URL of the document the form is in. A nil submission
+// without an error means the form does not navigate, as for method=dialog.
+func BuildFormSubmission(form, submitter Node, baseURL string) (*FormSubmission, error) {
+	if form == nil || form.GetTag() != "form" {
+		return nil, NewBrowserError(ErrInvalidInput, "node is not a form")
+	}
+
+	method := strings.ToLower(formAttribute(form, submitter, "method", "formmethod"))
+	switch method {
+	case "dialog":
+		return nil, nil
+	case "post":
+		method = http.MethodPost
+	default:
+		method = http.MethodGet
+	}
+
+	action, err := resolveFormAction(formAttribute(form, submitter, "action", "formaction"), baseURL)
+	if err != nil {
+		return nil, err
+	}
+
+	fields := CollectFormData(form, submitter)
+
+	if method == http.MethodGet {
+		action.RawQuery = encodeURLEncodedForm(fields)
+		return &FormSubmission{URL: action.String(), Method: method}, nil
+	}
+
+	// Only http(s) can carry a request body; other schemes just navigate
+	if action.Scheme != "http" && action.Scheme != "https" {
+		return &FormSubmission{URL: action.String(), Method: http.MethodGet}, nil
+	}
+
+	submission := &FormSubmission{URL: action.String(), Method: method}
+	switch strings.ToLower(formAttribute(form, submitter, "enctype", "formenctype")) {
+	case FormEncodingMultipart:
+		submission.Body, submission.ContentType, err = encodeMultipartForm(fields)
+		if err != nil {
+			return nil, err
+		}
+	case FormEncodingTextPlain:
+		submission.Body = encodeTextPlainForm(fields)
+		submission.ContentType = FormEncodingTextPlain + "; charset=utf-8"
+	default:
+		submission.Body = []byte(encodeURLEncodedForm(fields))
+		submission.ContentType = FormEncodingURLEncoded
+	}
+	return submission, nil
+}
+
+// formAttribute returns the submitter's override of a form attribute if it
+// has one, otherwise the form's own value.
+func formAttribute(form, submitter Node, name, override string) string {
+	if submitter != nil {
+		if value, ok := submitter.GetAttribute(override); ok {
+			return strings.TrimSpace(value)
+		}
+	}
+	value, _ := form.GetAttribute(name)
+	return strings.TrimSpace(value)
+}
+
+// resolveFormAction resolves action against the document URL. An empty
+// action submits to the document itself.
+func resolveFormAction(action, baseURL string) (*url.URL, error) {
+	base, err := url.Parse(baseURL)
+	if err != nil {
+		return nil, NewBrowserErrorWithContext(ErrInvalidURL, "invalid document URL", baseURL)
+	}
+	if action == "" {
+		resolved := *base
+		return &resolved, nil
+	}
+
+	ref, err := url.Parse(action)
+	if err != nil {
+		return nil, NewBrowserErrorWithContext(ErrInvalidURL, "invalid form action", action)
+	}
+	return base.ResolveReference(ref), nil
+}
+
+// CollectFormData returns the form's data set: the name and value of each
+// successful control, in tree order. Of the buttons, only submitter is
+// included.
+func CollectFormData(form, submitter Node) []FormField {
+	var fields []FormField
+	for _, control := range formControls(form) {
+		name, _ := control.GetAttribute("name")
+		if name == "" || isDisabledControl(control) {
+			continue
+		}
+
+		switch control.GetTag() {
+		case "input":
+			fields = appendInputFields(fields, control, name, control == submitter)
+		case "button":
+			if control == submitter {
+				value, _ := control.GetAttribute("value")
+				fields = append(fields, FormField{Name: name, Value: value})
+			}
+		case "select":
+			for _, option := range selectedOptions(control) {
+				fields = append(fields, FormField{Name: name, Value: optionValue(option)})
+			}
+		case "textarea":
+			fields = append(fields, FormField{Name: name, Value: nodeText(control)})
+		}
+	}
+	return fields
+}
+
+func appendInputFields(fields []FormField, input Node, name string, isSubmitter bool) []FormField {
+	value, hasValue := input.GetAttribute("value")
+
+	switch inputType(input) {
+	case "checkbox", "radio":
+		if _, checked := input.GetAttribute("checked"); !checked {
+			return fields
+		}
+		if !hasValue {
+			value = "on"
+		}
+	case "submit":
+		if !isSubmitter {
+			return fields
+		}
+	case "image":
+		// No click position is tracked, so the origin is submitted
+		if !isSubmitter {
+			return fields
+		}
+		return append(fields, FormField{Name: name + ".x", Value: "0"}, FormField{Name: name + ".y", Value: "0"})
+	case "button", "reset":
+		return fields
+	case "file":
+		// Files cannot be picked yet, so the control is submitted empty
+		return append(fields, FormField{Name: name, IsFile: true})
+	case "hidden":
+		if strings.EqualFold(name, "_charset_") {
+			value = "UTF-8"
+		}
+	}
+	return append(fields, FormField{Name: name, Value: value})
+}
+
+// formControls returns the form-associated elements owned by form in tree
+// order, including those elsewhere in the document that name it in their
+// form attribute.
+func formControls(form Node) []Node {
+	formID := form.GetID()
+	root := form
+	if formID != "" {
+		root = rootOf(form)
+	}
+
+	var controls []Node
+	var walk func(node Node)
+	walk = func(node Node) {
+		for _, child := range node.GetChildren() {
+			if child.GetType() != ElementNodeType {
+				continue
+			}
+			switch child.GetTag() {
+			case "input", "button", "select", "textarea":
+				if FindFormOwner(child) == form {
+					controls = append(controls, child)
+				}
+			}
+			walk(child)
+		}
+	}
+	walk(root)
+	return controls
+}
+
+func inputType(input Node) string {
+	inputType, _ := input.GetAttribute("type")
+	inputType = strings.ToLower(strings.TrimSpace(inputType))
+	if inputType == "" {
+		return "text"
+	}
+	return inputType
+}
+
+// isDisabledControl reports whether control is disabled itself or by a
+// disabled fieldset around it, other than through that fieldset's first
+// legend.
+func isDisabledControl(control Node) bool {
+	if _, disabled := control.GetAttribute("disabled"); disabled {
+		return true
+	}
+
+	child := control
+	for current := control.GetParent(); current != nil; current = current.GetParent() {
+		if current.GetTag() == "fieldset" {
+			if _, disabled := current.GetAttribute("disabled"); disabled && child != firstLegend(current) {
+				return true
+			}
+		}
+		child = current
+	}
+	return false
+}
+
+func firstLegend(fieldset Node) Node {
+	for _, child := range fieldset.GetChildren() {
+		if child.GetType() == ElementNodeType && child.GetTag() == "legend" {
+			return child
+		}
+	}
+	return nil
+}
+
+// selectedOptions returns the options of a select that are submitted. A
+// single-choice select with nothing selected submits its first enabled
+// option, as it would display.
+func selectedOptions(sel Node) []Node {
+	var options []Node
+	var walk func(node Node)
+	walk = func(node Node) {
+		for _, child := range node.GetChildren() {
+			if child.GetType() != ElementNodeType {
+				continue
+			}
+			if child.GetTag() == "option" {
+				options = append(options, child)
+			}
+			walk(child)
+		}
+	}
+	walk(sel)
+
+	_, multiple := sel.GetAttribute("multiple")
+	var selected []Node
+	for _, option := range options {
+		if _, ok := option.GetAttribute("selected"); ok && !isDisabledOption(option) {
+			selected = append(selected, option)
+		}
+	}
+	if multiple {
+		return selected
+	}
+	// Like a browser's display, the last selected option wins
+	if len(selected) > 0 {
+		return selected[len(selected)-1:]
+	}
+
+	for _, option := range options {
+		if !isDisabledOption(option) {
+			return []Node{option}
+		}
+	}
+	return nil
+}
+
+func isDisabledOption(option Node) bool {
+	if _, disabled := option.GetAttribute("disabled"); disabled {
+		return true
+	}
+	if parent := option.GetParent(); parent != nil && parent.GetTag() == "optgroup" {
+		_, disabled := parent.GetAttribute("disabled")
+		return disabled
+	}
+	return false
+}
+
+func optionValue(option Node) string {
+	if value, ok := option.GetAttribute("value"); ok {
+		return value
+	}
+	return strings.Join(strings.Fields(nodeText(option)), " ")
+}
+
+// nodeText concatenates the text of node's descendants.
+func nodeText(node Node) string {
+	var text strings.Builder
+	var walk func(node Node)
+	walk = func(node Node) {
+		for _, child := range node.GetChildren() {
+			switch child.GetType() {
+			case TextNodeType:
+				text.WriteString(child.GetText())
+			case ElementNodeType:
+				walk(child)
+			}
+		}
+	}
+	walk(node)
+	return text.String()
+}
+
+func rootOf(node Node) Node {
+	for node.GetParent() != nil {
+		node = node.GetParent()
+	}
+	return node
+}
+
+func findElementByID(node Node, id string) Node {
+	if node.GetType() != ElementNodeType {
+		return nil
+	}
+	if node.GetID() == id {
+		return node
+	}
+	for _, child := range node.GetChildren() {
+		if found := findElementByID(child, id); found != nil {
+			return found
+		}
+	}
+	return nil
+}
+
+// normalizeFormNewlines converts bare CR and LF to CRLF, as every form
+// encoding requires.
+func normalizeFormNewlines(value string) string {
+	if !strings.ContainsAny(value, "\r\n") {
+		return value
+	}
+	value = strings.ReplaceAll(value, "\r\n", "\n")
+	value = strings.ReplaceAll(value, "\r", "\n")
+	return strings.ReplaceAll(value, "\n", "\r\n")
+}
+
+// encodeURLEncodedForm serializes fields in order, unlike url.Values, which
+// sorts them. File fields submit their file name.
+func encodeURLEncodedForm(fields []FormField) string {
+	pairs := make([]string, 0, len(fields))
+	for _, field := range fields {
+		pairs = append(pairs, url.QueryEscape(normalizeFormNewlines(field.Name))+"="+url.QueryEscape(normalizeFormNewlines(field.Value)))
+	}
+	return strings.Join(pairs, "&")
+}
+
+func encodeTextPlainForm(fields []FormField) []byte {
+	var body bytes.Buffer
+	for _, field := range fields {
+		body.WriteString(normalizeFormNewlines(field.Name))
+		body.WriteString("=")
+		body.WriteString(normalizeFormNewlines(field.Value))
+		body.WriteString("\r\n")
+	}
+	return body.Bytes()
+}
+
+// encodeMultipartForm returns the multipart/form-data body for fields and
+// the Content-Type header naming its boundary.
+func encodeMultipartForm(fields []FormField) ([]byte, string, error) {
+	var body bytes.Buffer
+	writer := multipart.NewWriter(&body)
+
+	for _, field := range fields {
+		disposition := `form-data; name="` + escapeMultipartName(normalizeFormNewlines(field.Name)) + `"`
+		header := make(textproto.MIMEHeader)
+		if field.IsFile {
+			disposition += `; filename="` + escapeMultipartName(field.Value) + `"`
+			header.Set("Content-Type", "application/octet-stream")
+		}
+		header.Set("Content-Disposition", disposition)
+
+		part, err := writer.CreatePart(header)
+		if err != nil {
+			return nil, "", err
+		}
+		if !field.IsFile {
+			if _, err := part.Write([]byte(normalizeFormNewlines(field.Value))); err != nil {
+				return nil, "", err
+			}
+		}
+	}
+
+	if err := writer.Close(); err != nil {
+		return nil, "", err
+	}
+	return body.Bytes(), writer.FormDataContentType(), nil
+}
+
+// escapeMultipartName percent-encodes the characters that would end a quoted
+// name or filename, as the HTML standard does rather than backslashing them.
+func escapeMultipartName(name string) string {
+	return strings.NewReplacer("\n", "%0A", "\r", "%0D", `"`, "%22").Replace(name)
+}
@@ -0,0 +1,564 @@
+package browser
+
+import (
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"crypto/tls"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptrace"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+// HAR is an HTTP Archive 1.2 document (http://www.softwareishard.com/blog/har-12-spec/).
+type HAR struct {
+	Log HARLog `json:"log"`
+}
+
+type HARLog struct {
+	Version string     `json:"version"`
+	Creator HARCreator `json:"creator"`
+	Entries []HAREntry `json:"entries"`
+}
+
+type HARCreator struct {
+	Name    string `json:"name"`
+	Version string `json:"version"`
+}
+
+type HAREntry struct {
+	StartedDateTime time.Time   `json:"startedDateTime"`
+	Time            float64     `json:"time"`
+	Request         HARRequest  `json:"request"`
+	Response        HARResponse `json:"response"`
+	Cache           struct{}    `json:"cache"`
+	Timings         HARTimings  `json:"timings"`
+}
+
+type HARRequest struct {
+	Method      string         `json:"method"`
+	URL         string         `json:"url"`
+	HTTPVersion string         `json:"httpVersion"`
+	Cookies     []HARCookie    `json:"cookies"`
+	Headers     []HARNameValue `json:"headers"`
+	QueryString []HARNameValue `json:"queryString"`
+	PostData    *HARPostData   `json:"postData,omitempty"`
+	HeadersSize int            `json:"headersSize"`
+	BodySize    int            `json:"bodySize"`
+}
+
+type HARResponse struct {
+	Status      int            `json:"status"`
+	StatusText  string         `json:"statusText"`
+	HTTPVersion string         `json:"httpVersion"`
+	Cookies     []HARCookie    `json:"cookies"`
+	Headers     []HARNameValue `json:"headers"`
+	Content     HARContent     `json:"content"`
+	RedirectURL string         `json:"redirectURL"`
+	HeadersSize int            `json:"headersSize"`
+	BodySize    int            `json:"bodySize"`
+}
+
+type HARNameValue struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+type HARCookie struct {
+	Name     string     `json:"name"`
+	Value    string     `json:"value"`
+	Path     string     `json:"path,omitempty"`
+	Domain   string     `json:"domain,omitempty"`
+	Expires  *time.Time `json:"expires,omitempty"`
+	HTTPOnly bool       `json:"httpOnly,omitempty"`
+	Secure   bool       `json:"secure,omitempty"`
+}
+
+type HARPostData struct {
+	MimeType string `json:"mimeType"`
+	Text     string `json:"text"`
+}
+
+// HARContent holds the decoded response body. Bodies that are not valid
+// UTF-8 text are stored base64 encoded.
+type HARContent struct {
+	Size        int    `json:"size"`
+	Compression int    `json:"compression,omitempty"`
+	MimeType    string `json:"mimeType"`
+	Text        string `json:"text,omitempty"`
+	Encoding    string `json:"encoding,omitempty"`
+}
+
+// HARTimings are in milliseconds; -1 marks a phase that did not happen.
+type HARTimings struct {
+	Blocked float64 `json:"blocked"`
+	DNS     float64 `json:"dns"`
+	Connect float64 `json:"connect"`
+	Send    float64 `json:"send"`
+	Wait    float64 `json:"wait"`
+	Receive float64 `json:"receive"`
+	SSL     float64 `json:"ssl"`
+}
+
+// Body returns the decoded response body of the entry.
+func (c *HARContent) Body() ([]byte, error) {
+	if c.Encoding == "base64" {
+		return base64.StdEncoding.DecodeString(c.Text)
+	}
+	return []byte(c.Text), nil
+}
+
+// LoadHAR reads a HAR file written by a HARRecorder or another browser.
+func LoadHAR(path string) (*HAR, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, NewBrowserErrorWithContext(ErrFileNotFound, "HAR file does not exist", path)
+		}
+		return nil, err
+	}
+
+	var archive HAR
+	if err := json.Unmarshal(data, &archive); err != nil {
+		return nil, NewBrowserErrorWithContext(ErrParsingFailed, "invalid HAR file: "+err.Error(), path)
+	}
+	return &archive, nil
+}
+
+// Save writes the archive to path as indented JSON.
+func (h *HAR) Save(path string) error {
+	data, err := json.MarshalIndent(h, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	if dir := filepath.Dir(path); dir != "" {
+		if err := os.MkdirAll(dir, 0o755); err != nil {
+			return err
+		}
+	}
+
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+type HARRecorder interface {
+	// Wrap returns a RoundTripper that records every exchange made through next.
+	Wrap(next http.RoundTripper) http.RoundTripper
+	Archive() *HAR
+	Save(path string) error
+	Reset()
+}
+
+type harRecorder struct {
+	creator HARCreator
+	entries []HAREntry
+	mutex   sync.Mutex
+}
+
+func NewHARRecorder(appName, appVersion string) HARRecorder {
+	return &harRecorder{
+		creator: HARCreator{Name: appName, Version: appVersion},
+		entries: make([]HAREntry, 0),
+	}
+}
+
+func (hr *harRecorder) Wrap(next http.RoundTripper) http.RoundTripper {
+	if next == nil {
+		next = http.DefaultTransport
+	}
+	return &harRecordingTransport{recorder: hr, next: next}
+}
+
+// Archive returns a snapshot of the recorded entries ordered by start time.
+func (hr *harRecorder) Archive() *HAR {
+	hr.mutex.Lock()
+	entries := make([]HAREntry, len(hr.entries))
+	copy(entries, hr.entries)
+	hr.mutex.Unlock()
+
+	sort.SliceStable(entries, func(i, j int) bool {
+		return entries[i].StartedDateTime.Before(entries[j].StartedDateTime)
+	})
+
+	return &HAR{Log: HARLog{Version: "1.2", Creator: hr.creator, Entries: entries}}
+}
+
+func (hr *harRecorder) Save(path string) error {
+	return hr.Archive().Save(path)
+}
+
+func (hr *harRecorder) Reset() {
+	hr.mutex.Lock()
+	defer hr.mutex.Unlock()
+	hr.entries = hr.entries[:0]
+}
+
+func (hr *harRecorder) add(entry HAREntry) {
+	hr.mutex.Lock()
+	defer hr.mutex.Unlock()
+	hr.entries = append(hr.entries, entry)
+}
+
+type harRecordingTransport struct {
+	recorder *harRecorder
+	next     http.RoundTripper
+}
+
+func (rt *harRecordingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	timing := &harTiming{start: time.Now()}
+	req = req.WithContext(httptrace.WithClientTrace(req.Context(), timing.trace()))
+
+	postData, err := harPostData(req)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := rt.next.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+
+	request := HARRequest{
+		Method:      req.Method,
+		URL:         req.URL.String(),
+		HTTPVersion: req.Proto,
+		Cookies:     harRequestCookies(req),
+		Headers:     harHeaders(req.Header),
+		QueryString: harQueryString(req),
+		PostData:    postData,
+		HeadersSize: -1,
+		BodySize:    int(req.ContentLength),
+	}
+
+	// The entry is added once the caller is done with the body, which is
+	// recorded as it reads it rather than buffered up front, so streamed
+	// downloads are not held in memory
+	resp.Body = &harBody{body: resp.Body, done: func(body *harBody) {
+		timing.finish()
+		response := HARResponse{
+			Status:      resp.StatusCode,
+			StatusText:  http.StatusText(resp.StatusCode),
+			HTTPVersion: resp.Proto,
+			Cookies:     harResponseCookies(resp),
+			Headers:     harHeaders(resp.Header),
+			Content:     HARContent{Size: body.size, MimeType: resp.Header.Get("Content-Type")},
+			RedirectURL: resp.Header.Get("Location"),
+			HeadersSize: -1,
+			BodySize:    body.size,
+		}
+		if !body.truncated {
+			response.Content = harContent(resp.Header, body.buffer.Bytes())
+		}
+
+		entry := HAREntry{StartedDateTime: timing.start, Request: request, Response: response}
+		entry.Timings, entry.Time = timing.timings()
+		rt.recorder.add(entry)
+	}}
+
+	return resp, nil
+}
+
+// harBody passes a response body through to the caller, keeping the first
+// MaxHARBodySize bytes of it. Content larger than that is left out of the
+// recording.
+type harBody struct {
+	body      io.ReadCloser
+	buffer    bytes.Buffer
+	size      int
+	truncated bool
+	done      func(body *harBody)
+	once      sync.Once
+}
+
+func (b *harBody) Read(p []byte) (int, error) {
+	n, err := b.body.Read(p)
+	b.size += n
+	if !b.truncated {
+		if b.buffer.Len()+n > MaxHARBodySize {
+			b.truncated = true
+			b.buffer = bytes.Buffer{}
+		} else {
+			b.buffer.Write(p[:n])
+		}
+	}
+	if err == io.EOF {
+		b.finish()
+	}
+	return n, err
+}
+
+func (b *harBody) Close() error {
+	err := b.body.Close()
+	b.finish()
+	return err
+}
+
+func (b *harBody) finish() {
+	b.once.Do(func() { b.done(b) })
+}
+
+// harTiming collects httptrace events for one round trip.
+type harTiming struct {
+	start, dnsStart, dnsDone, connectStart, connectDone time.Time
+	tlsStart, tlsDone, gotConn, wroteRequest, firstByte time.Time
+	end                                                 time.Time
+	mutex                                               sync.Mutex
+}
+
+func (t *harTiming) mark(target *time.Time, onlyFirst bool) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	if onlyFirst && !target.IsZero() {
+		return
+	}
+	*target = time.Now()
+}
+
+func (t *harTiming) trace() *httptrace.ClientTrace {
+	return &httptrace.ClientTrace{
+		DNSStart:             func(httptrace.DNSStartInfo) { t.mark(&t.dnsStart, true) },
+		DNSDone:              func(httptrace.DNSDoneInfo) { t.mark(&t.dnsDone, false) },
+		ConnectStart:         func(string, string) { t.mark(&t.connectStart, true) },
+		ConnectDone:          func(string, string, error) { t.mark(&t.connectDone, false) },
+		TLSHandshakeStart:    func() { t.mark(&t.tlsStart, true) },
+		TLSHandshakeDone:     func(tls.ConnectionState, error) { t.mark(&t.tlsDone, false) },
+		GotConn:              func(httptrace.GotConnInfo) { t.mark(&t.gotConn, false) },
+		WroteRequest:         func(httptrace.WroteRequestInfo) { t.mark(&t.wroteRequest, false) },
+		GotFirstResponseByte: func() { t.mark(&t.firstByte, false) },
+	}
+}
+
+func (t *harTiming) finish() {
+	t.mark(&t.end, false)
+}
+
+func (t *harTiming) timings() (HARTimings, float64) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	span := func(from, to time.Time) float64 {
+		if from.IsZero() || to.IsZero() || to.Before(from) {
+			return -1
+		}
+		return float64(to.Sub(from).Microseconds()) / 1000
+	}
+
+	timings := HARTimings{
+		DNS:     span(t.dnsStart, t.dnsDone),
+		Connect: span(t.connectStart, t.connectDone),
+		SSL:     span(t.tlsStart, t.tlsDone),
+		Send:    span(t.gotConn, t.wroteRequest),
+		Wait:    span(t.wroteRequest, t.firstByte),
+		Receive: span(t.firstByte, t.end),
+	}
+	// Per the spec, connect includes the TLS handshake
+	if timings.SSL >= 0 {
+		timings.Connect = span(t.connectStart, t.tlsDone)
+	}
+
+	blocked := span(t.start, t.gotConn)
+	for _, phase := range []float64{timings.DNS, timings.Connect} {
+		if phase > 0 {
+			blocked -= phase
+		}
+	}
+	if blocked < 0 {
+		blocked = 0
+	}
+	timings.Blocked = blocked
+
+	total := span(t.start, t.end)
+	if total < 0 {
+		total = 0
+	}
+	return timings, total
+}
+
+func harHeaders(header http.Header) []HARNameValue {
+	values := make([]HARNameValue, 0, len(header))
+	for name, headerValues := range header {
+		for _, value := range headerValues {
+			values = append(values, HARNameValue{Name: name, Value: value})
+		}
+	}
+	sort.SliceStable(values, func(i, j int) bool { return values[i].Name < values[j].Name })
+	return values
+}
+
+func harQueryString(req *http.Request) []HARNameValue {
+	values := make([]HARNameValue, 0)
+	for name, queryValues := range req.URL.Query() {
+		for _, value := range queryValues {
+			values = append(values, HARNameValue{Name: name, Value: value})
+		}
+	}
+	sort.SliceStable(values, func(i, j int) bool { return values[i].Name < values[j].Name })
+	return values
+}
+
+func harRequestCookies(req *http.Request) []HARCookie {
+	cookies := make([]HARCookie, 0)
+	for _, cookie := range req.Cookies() {
+		cookies = append(cookies, HARCookie{Name: cookie.Name, Value: cookie.Value})
+	}
+	return cookies
+}
+
+func harResponseCookies(resp *http.Response) []HARCookie {
+	cookies := make([]HARCookie, 0)
+	for _, cookie := range resp.Cookies() {
+		harCookie := HARCookie{
+			Name:     cookie.Name,
+			Value:    cookie.Value,
+			Path:     cookie.Path,
+			Domain:   cookie.Domain,
+			HTTPOnly: cookie.HttpOnly,
+			Secure:   cookie.Secure,
+		}
+		if !cookie.Expires.IsZero() {
+			expires := cookie.Expires
+			harCookie.Expires = &expires
+		}
+		cookies = append(cookies, harCookie)
+	}
+	return cookies
+}
+
+// harPostData captures a request body without consuming it.
+func harPostData(req *http.Request) (*HARPostData, error) {
+	if req.Body == nil || req.Body == http.NoBody {
+		return nil, nil
+	}
+
+	body, err := io.ReadAll(req.Body)
+	req.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	req.Body = io.NopCloser(bytes.NewReader(body))
+
+	return &HARPostData{MimeType: req.Header.Get("Content-Type"), Text: string(body)}, nil
+}
+
+// harContent decodes a transfer-compressed body, since HAR stores content as
+// the page received it.
+func harContent(header http.Header, rawBody []byte) HARContent {
+	body := rawBody
+	switch strings.ToLower(header.Get("Content-Encoding")) {
+	case "gzip":
+		if reader, err := gzip.NewReader(bytes.NewReader(rawBody)); err == nil {
+			if decoded, err := io.ReadAll(reader); err == nil {
+				body = decoded
+			}
+		}
+	case "deflate":
+		if decoded, err := io.ReadAll(flate.NewReader(bytes.NewReader(rawBody))); err == nil {
+			body = decoded
+		}
+	}
+
+	content := HARContent{
+		Size:        len(body),
+		Compression: len(body) - len(rawBody),
+		MimeType:    header.Get("Content-Type"),
+	}
+	if utf8.Valid(body) {
+		content.Text = string(body)
+	} else {
+		content.Text = base64.StdEncoding.EncodeToString(body)
+		content.Encoding = "base64"
+	}
+	return content
+}
+
+// harReplayTransport answers requests from a HAR archive and never touches
+// the network. Repeated requests for a URL are served the recorded responses
+// in order, repeating the last one once they run out.
+type harReplayTransport struct {
+	entries map[string][]*HAREntry
+	served  map[string]int
+	mutex   sync.Mutex
+}
+
+func NewHARReplayTransport(archive *HAR) http.RoundTripper {
+	rt := &harReplayTransport{
+		entries: make(map[string][]*HAREntry),
+		served:  make(map[string]int),
+	}
+
+	for i := range archive.Log.Entries {
+		entry := &archive.Log.Entries[i]
+		key := harReplayKey(entry.Request.Method, entry.Request.URL)
+		rt.entries[key] = append(rt.entries[key], entry)
+	}
+	return rt
+}
+
+func harReplayKey(method, url string) string {
+	if method == "" {
+		method = http.MethodGet
+	}
+	return strings.ToUpper(method) + " " + url
+}
+
+func (rt *harReplayTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.Body != nil {
+		req.Body.Close()
+	}
+
+	key := harReplayKey(req.Method, req.URL.String())
+
+	rt.mutex.Lock()
+	candidates := rt.entries[key]
+	if len(candidates) == 0 {
+		rt.mutex.Unlock()
+		return nil, NewBrowserErrorWithContext(ErrConnectionFailed, "request is not in the HAR archive", req.URL.String())
+	}
+	index := rt.served[key]
+	if index >= len(candidates) {
+		index = len(candidates) - 1
+	}
+	rt.served[key] = index + 1
+	entry := candidates[index]
+	rt.mutex.Unlock()
+
+	body, err := entry.Response.Content.Body()
+	if err != nil {
+		return nil, NewBrowserErrorWithContext(ErrParsingFailed, "invalid HAR content: "+err.Error(), req.URL.String())
+	}
+
+	header := http.Header{}
+	for _, field := range entry.Response.Headers {
+		header.Add(field.Name, field.Value)
+	}
+	// The archive holds the decoded body, so its original framing no longer applies
+	header.Del("Content-Encoding")
+	header.Del("Content-Length")
+	header.Del("Transfer-Encoding")
+
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", entry.Response.Status, entry.Response.StatusText),
+		StatusCode:    entry.Response.Status,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        header,
+		Body:          io.NopCloser(bytes.NewReader(body)),
+		ContentLength: int64(len(body)),
+		Request:       req,
+	}, nil
+}
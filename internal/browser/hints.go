@@ -0,0 +1,435 @@
+package browser
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ResourceHintType is the work a <link> resource hint asks for ahead of
+// time (Resource Hints and HTML section 4.6.6).
+type ResourceHintType int
+
+const (
+	// HintDNSPrefetch resolves the host of the URL.
+	HintDNSPrefetch ResourceHintType = iota
+	// HintPreconnect also opens a connection to it.
+	HintPreconnect
+	// HintPrefetch fetches a resource a later navigation is likely to need.
+	HintPrefetch
+	// HintPreload fetches a resource the current page needs.
+	HintPreload
+)
+
+var resourceHintTypes = map[string]ResourceHintType{
+	"dns-prefetch": HintDNSPrefetch,
+	"preconnect":   HintPreconnect,
+	"prefetch":     HintPrefetch,
+	"preload":      HintPreload,
+}
+
+func (t ResourceHintType) String() string {
+	switch t {
+	case HintDNSPrefetch:
+		return "dns-prefetch"
+	case HintPreconnect:
+		return "preconnect"
+	case HintPrefetch:
+		return "prefetch"
+	case HintPreload:
+		return "preload"
+	default:
+		return "unknown"
+	}
+}
+
+// preloadDestinations maps the as= values of preloads worth fetching, those
+// for resources the engine goes on to load, to the CSP directive that
+// governs them.
+var preloadDestinations = map[string]string{
+	"style": CSPStyleSrc,
+}
+
+// ResourceHint is a <link rel=dns-prefetch>, preconnect, prefetch or
+// preload.
+type ResourceHint struct {
+	Type ResourceHintType
+	URL  string
+	// As is the destination of a preload, such as style.
+	As string
+	// Referrer, ReferrerPolicy and TabID describe the page that gave the
+	// hint.
+	Referrer       string
+	ReferrerPolicy ReferrerPolicy
+	TabID          string
+}
+
+// parseResourceHints returns a hint for each hint type listed in a <link>
+// rel attribute.
+func parseResourceHints(rel, href, as string) []ResourceHint {
+	var hints []ResourceHint
+	for _, token := range strings.Fields(rel) {
+		if hintType, ok := resourceHintTypes[strings.ToLower(token)]; ok {
+			hints = append(hints, ResourceHint{Type: hintType, URL: href, As: strings.ToLower(strings.TrimSpace(as))})
+		}
+	}
+	return hints
+}
+
+func (h ResourceHint) key() string {
+	return h.Type.String() + " " + h.URL
+}
+
+// HintQueue carries out resource hints in the background, a few at a time
+// and behind every request a page actually makes.
+type HintQueue interface {
+	// Add queues hint unless the same hint was queued recently or the queue
+	// is full; hints are only ever worth doing when it is cheap to.
+	Add(hint ResourceHint)
+	// CancelTab drops the queued hints of tabID.
+	CancelTab(tabID string)
+	// CancelAll drops every queued hint and aborts those in progress.
+	CancelAll()
+	Len() int
+}
+
+type hintQueue struct {
+	apiHandler *apiHandler
+	pending    []ResourceHint
+	// added records when each hint was last queued, to ignore repeats
+	added   map[string]time.Time
+	running int
+	ctx     context.Context
+	cancel  context.CancelFunc
+	mutex   sync.Mutex
+}
+
+func newHintQueue(apiHandler *apiHandler) *hintQueue {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &hintQueue{
+		apiHandler: apiHandler,
+		added:      make(map[string]time.Time),
+		ctx:        ctx,
+		cancel:     cancel,
+	}
+}
+
+func (hq *hintQueue) Add(hint ResourceHint) {
+	hq.mutex.Lock()
+	defer hq.mutex.Unlock()
+
+	now := time.Now()
+	if added, ok := hq.added[hint.key()]; ok && now.Sub(added) < PreloadLifetime {
+		return
+	}
+	if hint.Type != HintPreload && len(hq.pending) >= MaxQueuedHints {
+		return
+	}
+	if len(hq.added) >= MaxQueuedHints*4 {
+		for key, added := range hq.added {
+			if now.Sub(added) >= PreloadLifetime {
+				delete(hq.added, key)
+			}
+		}
+	}
+
+	hq.added[hint.key()] = now
+	// The page being loaded waits for its preloads, so they start straight
+	// away instead of queueing behind other hints
+	if hint.Type == HintPreload {
+		done := hq.apiHandler.preloads.begin(hint.URL)
+		go func(ctx context.Context) {
+			defer done()
+			hq.finish(hint, hq.run(ctx, hint))
+		}(hq.ctx)
+		return
+	}
+	hq.pending = append(hq.pending, hint)
+	if hq.running < MaxConcurrentHints {
+		hq.running++
+		go hq.work()
+	}
+}
+
+// work carries out queued hints until there are none left. Each runs under
+// the queue's context at the time, so CancelAll aborts it.
+func (hq *hintQueue) work() {
+	for {
+		hq.mutex.Lock()
+		if len(hq.pending) == 0 {
+			hq.running--
+			hq.mutex.Unlock()
+			return
+		}
+		hint := hq.pending[0]
+		hq.pending = hq.pending[1:]
+		ctx := hq.ctx
+		hq.mutex.Unlock()
+
+		hq.finish(hint, hq.run(ctx, hint))
+	}
+}
+
+func (hq *hintQueue) finish(hint ResourceHint, err error) {
+	if err != nil {
+		// Let the page hint at it again next time
+		hq.mutex.Lock()
+		delete(hq.added, hint.key())
+		hq.mutex.Unlock()
+	}
+}
+
+func (hq *hintQueue) run(ctx context.Context, hint ResourceHint) error {
+	ctx, cancel := context.WithTimeout(ctx, DefaultTimeout)
+	defer cancel()
+
+	switch hint.Type {
+	case HintDNSPrefetch:
+		return hq.apiHandler.resolveHost(ctx, hint.URL)
+	case HintPreconnect:
+		return hq.apiHandler.preconnect(ctx, hint.URL)
+	default:
+		return hq.apiHandler.preload(ctx, hint)
+	}
+}
+
+func (hq *hintQueue) CancelTab(tabID string) {
+	if tabID == "" {
+		return
+	}
+
+	hq.mutex.Lock()
+	defer hq.mutex.Unlock()
+
+	kept := hq.pending[:0]
+	for _, hint := range hq.pending {
+		if hint.TabID != tabID {
+			kept = append(kept, hint)
+		}
+	}
+	hq.pending = kept
+}
+
+func (hq *hintQueue) CancelAll() {
+	hq.mutex.Lock()
+	defer hq.mutex.Unlock()
+
+	hq.cancel()
+	hq.pending = nil
+	// Hints added from now on run under a fresh context
+	hq.ctx, hq.cancel = context.WithCancel(context.Background())
+}
+
+func (hq *hintQueue) Len() int {
+	hq.mutex.Lock()
+	defer hq.mutex.Unlock()
+	return len(hq.pending)
+}
+
+// preloadCache holds responses fetched for prefetch and preload hints until
+// a request uses them, for at most PreloadLifetime. Each is used once;
+// after that only the HTTP cache can serve it again.
+type preloadCache struct {
+	entries map[string]*preloadEntry
+	size    int
+	// loading has the preloads in progress, each closed once done
+	loading map[string]chan struct{}
+	mutex   sync.Mutex
+}
+
+type preloadEntry struct {
+	resp    *Response
+	expires time.Time
+}
+
+func newPreloadCache() *preloadCache {
+	return &preloadCache{
+		entries: make(map[string]*preloadEntry),
+		loading: make(map[string]chan struct{}),
+	}
+}
+
+// begin marks url as being preloaded until the returned func is called.
+func (pc *preloadCache) begin(url string) func() {
+	pc.mutex.Lock()
+	defer pc.mutex.Unlock()
+
+	loading := make(chan struct{})
+	pc.loading[url] = loading
+	return func() {
+		pc.mutex.Lock()
+		if pc.loading[url] == loading {
+			delete(pc.loading, url)
+		}
+		pc.mutex.Unlock()
+		close(loading)
+	}
+}
+
+// wait returns once a preload of url in progress is done, if there is one.
+func (pc *preloadCache) wait(ctx context.Context, url string) {
+	pc.mutex.Lock()
+	loading := pc.loading[url]
+	pc.mutex.Unlock()
+
+	if loading == nil {
+		return
+	}
+	select {
+	case <-loading:
+	case <-ctx.Done():
+	}
+}
+
+// put keeps resp for requests of its request URL, unless that would go
+// over MaxPreloadCacheSize.
+func (pc *preloadCache) put(resp *Response) {
+	pc.mutex.Lock()
+	defer pc.mutex.Unlock()
+
+	now := time.Now()
+	for key, entry := range pc.entries {
+		if now.After(entry.expires) {
+			pc.removeLocked(key)
+		}
+	}
+	pc.removeLocked(resp.RequestURL)
+	if pc.size+len(resp.Body) > MaxPreloadCacheSize {
+		return
+	}
+
+	pc.entries[resp.RequestURL] = &preloadEntry{resp: resp, expires: now.Add(PreloadLifetime)}
+	pc.size += len(resp.Body)
+}
+
+func (pc *preloadCache) take(url string) *Response {
+	pc.mutex.Lock()
+	defer pc.mutex.Unlock()
+
+	entry, ok := pc.entries[url]
+	if !ok {
+		return nil
+	}
+	pc.removeLocked(url)
+	if time.Now().After(entry.expires) {
+		return nil
+	}
+	return entry.resp
+}
+
+func (pc *preloadCache) removeLocked(url string) {
+	if entry, ok := pc.entries[url]; ok {
+		pc.size -= len(entry.resp.Body)
+		delete(pc.entries, url)
+	}
+}
+
+// takePreload returns the response a hint fetched for the request, if it
+// can stand in for one from the network, waiting for it if it is still
+// being fetched. Private tabs, which have their own cookie jar, never share
+// them.
+func (ah *apiHandler) takePreload(ctx context.Context, fetchReq *FetchRequest) *Response {
+	if fetchReq.Type == RequestTypePrefetch || fetchReq.CacheMode != CacheModeDefault ||
+		fetchReq.CookieJar != nil || !isGetRequest(fetchReq) {
+		return nil
+	}
+	ah.preloads.wait(ctx, fetchReq.URL)
+	return ah.preloads.take(fetchReq.URL)
+}
+
+// preload fetches the resource of a prefetch or preload hint into the
+// preload cache.
+func (ah *apiHandler) preload(ctx context.Context, hint ResourceHint) error {
+	req := &FetchRequest{
+		URL:            hint.URL,
+		Type:           RequestTypePrefetch,
+		Referrer:       hint.Referrer,
+		ReferrerPolicy: hint.ReferrerPolicy,
+		TabID:          hint.TabID,
+	}
+	if hint.Type == HintPreload {
+		req.FirstPartyURL = hint.Referrer
+	} else {
+		// A prefetch is for a later navigation, so it is made as a top-level
+		// request that servers can tell apart by its Sec-Purpose
+		req.Header = http.Header{"Sec-Purpose": {"prefetch"}}
+	}
+
+	resp, err := ah.Fetch(ctx, req)
+	if err != nil {
+		return err
+	}
+	if !resp.IsSuccess() {
+		return NewHTTPError(resp)
+	}
+	// Downloads and large responses come back without a body
+	if resp.Body != nil && !resp.IsDownload() {
+		ah.preloads.put(resp)
+	}
+	return nil
+}
+
+// resolveHost looks up the host of rawURL so the system resolver has it
+// cached by the time it is needed. Requests sent through a proxy or
+// replayed from a HAR file never resolve it themselves.
+func (ah *apiHandler) resolveHost(ctx context.Context, rawURL string) error {
+	addr, err := ah.dialAddress(rawURL)
+	if err != nil || addr == "" {
+		return err
+	}
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return err
+	}
+	_, err = net.DefaultResolver.LookupHost(ctx, host)
+	return err
+}
+
+// preconnect opens a connection to the host of rawURL, or its proxy, for
+// the transport to use for its next request there.
+func (ah *apiHandler) preconnect(ctx context.Context, rawURL string) error {
+	if ah.connections == nil {
+		return nil
+	}
+	addr, err := ah.dialAddress(rawURL)
+	if err != nil || addr == "" {
+		return err
+	}
+	return ah.connections.Preconnect(ctx, addr)
+}
+
+// dialAddress returns the host:port the transport would dial for a request
+// to rawURL, which is the proxy's when one applies. It is "" when requests
+// do not reach the network.
+func (ah *apiHandler) dialAddress(rawURL string) (string, error) {
+	if ah.harReplay != nil {
+		return "", nil
+	}
+	if ah.hsts != nil {
+		rawURL, _ = ah.hsts.Upgrade(rawURL)
+	}
+	target, err := url.Parse(rawURL)
+	if err != nil {
+		return "", NewBrowserError(ErrInvalidURL, "failed to parse hint URL: "+err.Error())
+	}
+	if target.Scheme != "http" && target.Scheme != "https" {
+		return "", nil
+	}
+
+	proxy := ah.proxy
+	if proxy == nil {
+		proxy = http.ProxyFromEnvironment
+	}
+	if proxyURL, err := proxy(&http.Request{URL: target, Header: make(http.Header)}); err == nil && proxyURL != nil {
+		target = proxyURL
+	}
+	port := effectivePort(target)
+	if port == "" {
+		return "", nil
+	}
+	return net.JoinHostPort(target.Hostname(), port), nil
+}
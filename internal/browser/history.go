@@ -0,0 +1,56 @@
+package browser
+
+import (
+	"sync"
+	"time"
+)
+
+// HistoryEntry is a single visit to a page.
+type HistoryEntry struct {
+	URL       string
+	Title     string
+	VisitedAt time.Time
+}
+
+// History records the pages visited in any tab, newest last.
+type History interface {
+	Add(url, title string)
+	Entries() []HistoryEntry
+	Clear()
+}
+
+type history struct {
+	entries []HistoryEntry
+	mutex   sync.RWMutex
+}
+
+func NewHistory() History {
+	return &history{
+		entries: make([]HistoryEntry, 0),
+	}
+}
+
+func (h *history) Add(url, title string) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	h.entries = append(h.entries, HistoryEntry{URL: url, Title: title, VisitedAt: time.Now()})
+	if len(h.entries) > MaxHistoryEntries {
+		h.entries = h.entries[len(h.entries)-MaxHistoryEntries:]
+	}
+}
+
+func (h *history) Entries() []HistoryEntry {
+	h.mutex.RLock()
+	defer h.mutex.RUnlock()
+
+	entries := make([]HistoryEntry, len(h.entries))
+	copy(entries, h.entries)
+	return entries
+}
+
+func (h *history) Clear() {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	h.entries = h.entries[:0]
+}
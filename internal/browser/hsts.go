@@ -0,0 +1,406 @@
+package browser
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// HSTSEntry is a host that must only be reached over https (RFC 6797).
+type HSTSEntry struct {
+	Host              string    `json:"host"`
+	IncludeSubDomains bool      `json:"include_subdomains"`
+	Expires           time.Time `json:"expires"`
+	// Preloaded entries come from a preload list. They never expire and are
+	// not saved.
+	Preloaded bool `json:"-"`
+}
+
+// HSTSStore remembers hosts that sent Strict-Transport-Security and upgrades
+// http URLs for them to https.
+type HSTSStore interface {
+	// ProcessHeader records a Strict-Transport-Security header received from
+	// host over a verified https connection.
+	ProcessHeader(host, value string)
+	// Upgrade returns rawURL with an https scheme when its host is a known
+	// HSTS host, and whether it was changed.
+	Upgrade(rawURL string) (string, bool)
+	IsKnownHost(host string) bool
+	// AddPreload adds an entry that does not expire and cannot be removed by
+	// a header.
+	AddPreload(host string, includeSubDomains bool)
+	// LoadPreloadList reads a preload list in Chromium's
+	// transport_security_state_static.json format.
+	LoadPreloadList(path string) error
+	Entries() []HSTSEntry
+	Delete(host string) bool
+	// Save writes the entries learnt from headers to the store's file.
+	// Stores created without a path are never saved.
+	Save() error
+}
+
+type hstsStore struct {
+	dynamic map[string]*HSTSEntry
+	preload map[string]*HSTSEntry
+	path    string
+	mutex   sync.RWMutex
+}
+
+// NewHSTSStore creates a store persisted at path, loading any entries already
+// saved there. An empty path keeps the store in memory only.
+func NewHSTSStore(path string) (HSTSStore, error) {
+	hs := &hstsStore{
+		dynamic: make(map[string]*HSTSEntry),
+		preload: make(map[string]*HSTSEntry),
+		path:    path,
+	}
+
+	if path == "" {
+		return hs, nil
+	}
+	return hs, hs.load()
+}
+
+func (hs *hstsStore) ProcessHeader(host, value string) {
+	host = canonicalHSTSHost(host)
+	if host == "" {
+		return
+	}
+
+	maxAge, includeSubDomains, ok := parseStrictTransportSecurity(value)
+	if !ok {
+		return
+	}
+
+	hs.mutex.Lock()
+	defer hs.mutex.Unlock()
+
+	if maxAge == 0 {
+		delete(hs.dynamic, host)
+		return
+	}
+
+	hs.dynamic[host] = &HSTSEntry{
+		Host:              host,
+		IncludeSubDomains: includeSubDomains,
+		Expires:           time.Now().Add(time.Duration(maxAge) * time.Second),
+	}
+}
+
+func (hs *hstsStore) Upgrade(rawURL string) (string, bool) {
+	parsed, err := url.Parse(rawURL)
+	if err != nil || !strings.EqualFold(parsed.Scheme, "http") {
+		return rawURL, false
+	}
+	if !hs.IsKnownHost(parsed.Hostname()) {
+		return rawURL, false
+	}
+
+	// The default http port becomes the default https port (RFC 6797
+	// section 8.3); any other port is kept
+	return upgradeToHTTPS(rawURL), true
+}
+
+// IsKnownHost reports whether host or, with includeSubDomains, one of its
+// parent domains has an unexpired entry.
+func (hs *hstsStore) IsKnownHost(host string) bool {
+	host = canonicalHSTSHost(host)
+	if host == "" {
+		return false
+	}
+
+	hs.mutex.RLock()
+	defer hs.mutex.RUnlock()
+
+	now := time.Now()
+	for domain, exact := host, true; ; exact = false {
+		if entry := hs.lookupLocked(domain, now); entry != nil && (exact || entry.IncludeSubDomains) {
+			return true
+		}
+
+		dot := strings.IndexByte(domain, '.')
+		if dot < 0 {
+			return false
+		}
+		domain = domain[dot+1:]
+	}
+}
+
+// lookupLocked returns the entry for exactly domain. A preloaded entry wins
+// over one learnt from a header.
+func (hs *hstsStore) lookupLocked(domain string, now time.Time) *HSTSEntry {
+	if entry, ok := hs.preload[domain]; ok {
+		return entry
+	}
+	if entry, ok := hs.dynamic[domain]; ok && entry.Expires.After(now) {
+		return entry
+	}
+	return nil
+}
+
+func (hs *hstsStore) AddPreload(host string, includeSubDomains bool) {
+	host = canonicalHSTSHost(host)
+	if host == "" {
+		return
+	}
+
+	hs.mutex.Lock()
+	defer hs.mutex.Unlock()
+
+	hs.preload[host] = &HSTSEntry{
+		Host:              host,
+		IncludeSubDomains: includeSubDomains,
+		Preloaded:         true,
+	}
+}
+
+type hstsPreloadList struct {
+	Entries []struct {
+		Name              string `json:"name"`
+		Mode              string `json:"mode"`
+		IncludeSubDomains bool   `json:"include_subdomains"`
+	} `json:"entries"`
+}
+
+func (hs *hstsStore) LoadPreloadList(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return NewBrowserErrorWithContext(ErrFileNotFound, "HSTS preload list does not exist", path)
+		}
+		return err
+	}
+
+	var list hstsPreloadList
+	if err := json.Unmarshal(stripLineComments(data), &list); err != nil {
+		return NewBrowserErrorWithContext(ErrParsingFailed, "invalid HSTS preload list: "+err.Error(), path)
+	}
+
+	for _, entry := range list.Entries {
+		// Entries without force-https only pin keys, which is not supported
+		if entry.Mode == "force-https" {
+			hs.AddPreload(entry.Name, entry.IncludeSubDomains)
+		}
+	}
+	return nil
+}
+
+// stripLineComments drops the whole-line // comments Chromium's preload list
+// carries, which JSON does not allow.
+func stripLineComments(data []byte) []byte {
+	var out bytes.Buffer
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	scanner.Buffer(make([]byte, 0, 64*1024), len(data)+1)
+	for scanner.Scan() {
+		line := scanner.Bytes()
+		if bytes.HasPrefix(bytes.TrimSpace(line), []byte("//")) {
+			continue
+		}
+		out.Write(line)
+		out.WriteByte('\n')
+	}
+	return out.Bytes()
+}
+
+func (hs *hstsStore) Entries() []HSTSEntry {
+	hs.mutex.RLock()
+	defer hs.mutex.RUnlock()
+
+	now := time.Now()
+	entries := make([]HSTSEntry, 0, len(hs.dynamic)+len(hs.preload))
+	for _, entry := range hs.preload {
+		entries = append(entries, *entry)
+	}
+	for host, entry := range hs.dynamic {
+		if _, preloaded := hs.preload[host]; !preloaded && entry.Expires.After(now) {
+			entries = append(entries, *entry)
+		}
+	}
+
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].Host < entries[j].Host
+	})
+	return entries
+}
+
+// Delete removes the entry learnt for host. Preloaded entries stay.
+func (hs *hstsStore) Delete(host string) bool {
+	host = canonicalHSTSHost(host)
+
+	hs.mutex.Lock()
+	defer hs.mutex.Unlock()
+
+	if _, ok := hs.dynamic[host]; !ok {
+		return false
+	}
+	delete(hs.dynamic, host)
+	return true
+}
+
+func (hs *hstsStore) Save() error {
+	if hs.path == "" {
+		return nil
+	}
+
+	hs.mutex.RLock()
+	now := time.Now()
+	entries := make([]*HSTSEntry, 0, len(hs.dynamic))
+	for _, entry := range hs.dynamic {
+		if entry.Expires.After(now) {
+			entries = append(entries, entry)
+		}
+	}
+	hs.mutex.RUnlock()
+
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].Host < entries[j].Host
+	})
+
+	data, err := json.MarshalIndent(entries, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(hs.path), 0o700); err != nil {
+		return err
+	}
+
+	tmp := hs.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, hs.path)
+}
+
+func (hs *hstsStore) load() error {
+	data, err := os.ReadFile(hs.path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+
+	var entries []*HSTSEntry
+	if err := json.Unmarshal(data, &entries); err != nil {
+		return NewBrowserErrorWithContext(ErrParsingFailed, "invalid HSTS file: "+err.Error(), hs.path)
+	}
+
+	now := time.Now()
+	for _, entry := range entries {
+		entry.Host = canonicalHSTSHost(entry.Host)
+		if entry.Host != "" && entry.Expires.After(now) {
+			hs.dynamic[entry.Host] = entry
+		}
+	}
+	return nil
+}
+
+// canonicalHSTSHost lower-cases host and drops a trailing dot. IP addresses
+// are never HSTS hosts, so they give "".
+func canonicalHSTSHost(host string) string {
+	host = strings.TrimSuffix(strings.ToLower(strings.TrimSpace(host)), ".")
+	if host == "" || net.ParseIP(strings.Trim(host, "[]")) != nil {
+		return ""
+	}
+	return host
+}
+
+// parseStrictTransportSecurity parses a Strict-Transport-Security header
+// value (RFC 6797 section 6.1). Headers without a valid max-age, or with a
+// directive given twice, are ignored.
+func parseStrictTransportSecurity(value string) (maxAge int64, includeSubDomains bool, ok bool) {
+	seen := make(map[string]bool)
+	for _, directive := range strings.Split(value, ";") {
+		name, val, _ := strings.Cut(strings.TrimSpace(directive), "=")
+		name = strings.ToLower(strings.TrimSpace(name))
+		if name == "" {
+			continue
+		}
+		if seen[name] {
+			return 0, false, false
+		}
+		seen[name] = true
+
+		switch name {
+		case "max-age":
+			val = strings.Trim(strings.TrimSpace(val), `"`)
+			age, err := strconv.ParseInt(val, 10, 64)
+			if err != nil || age < 0 {
+				return 0, false, false
+			}
+			maxAge = min(age, int64(MaxHSTSMaxAge/time.Second))
+		case "includesubdomains":
+			includeSubDomains = true
+		}
+	}
+	return maxAge, includeSubDomains, seen["max-age"]
+}
+
+// privateRequestKey marks the context of a request from a private tab, whose
+// Strict-Transport-Security headers must not outlive it in the profile.
+type privateRequestKey struct{}
+
+func withPrivateRequest(ctx context.Context, fetchReq *FetchRequest) context.Context {
+	if fetchReq.CookieJar == nil {
+		return ctx
+	}
+	return context.WithValue(ctx, privateRequestKey{}, true)
+}
+
+func isPrivateRequest(req *http.Request) bool {
+	private, _ := req.Context().Value(privateRequestKey{}).(bool)
+	return private
+}
+
+// hstsTransport records Strict-Transport-Security headers and turns http
+// requests to known HSTS hosts into internal redirects to https, so redirects
+// followed by the client are upgraded too. Known hosts are upgraded for
+// private tabs as well, but what they learn is not recorded.
+type hstsTransport struct {
+	store     HSTSStore
+	transport http.RoundTripper
+}
+
+func (t *hstsTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if upgraded, ok := t.store.Upgrade(req.URL.String()); ok {
+		header := make(http.Header)
+		header.Set("Location", upgraded)
+		header.Set("Non-Authoritative-Reason", "HSTS")
+		return &http.Response{
+			Status:     "307 Internal Redirect",
+			StatusCode: http.StatusTemporaryRedirect,
+			Proto:      "HTTP/1.1",
+			ProtoMajor: 1,
+			ProtoMinor: 1,
+			Header:     header,
+			Body:       http.NoBody,
+			Request:    req,
+		}, nil
+	}
+
+	resp, err := t.transport.RoundTrip(req)
+	if err != nil {
+		return resp, err
+	}
+
+	// Headers over http or over a connection with certificate errors, such
+	// as an excepted host, are ignored (RFC 6797 section 8.1)
+	if resp.TLS != nil && len(resp.TLS.VerifiedChains) > 0 && !isPrivateRequest(req) {
+		if value := resp.Header.Get("Strict-Transport-Security"); value != "" {
+			t.store.ProcessHeader(req.URL.Hostname(), value)
+		}
+	}
+	return resp, nil
+}
@@ -59,6 +59,9 @@ type HTMLParser interface {
 	GetStyleTags() string
 	GetScripts() []ScriptInfo
 	GetStylesheetLinks() []string
+	// GetResourceHints returns the <link> resource hints in the markup, with
+	// their URLs as written.
+	GetResourceHints() []ResourceHint
 	PrintTree() string
 }
 
@@ -70,6 +73,7 @@ type htmlParser struct {
 	metadata       map[string]string
 	scripts        []ScriptInfo
 	stylesheetURLs []string
+	resourceHints  []ResourceHint
 	stack          []Node
 }
 
@@ -175,6 +179,9 @@ func (p *htmlParser) handleSelfClosingTag(token *Token) {
 	if token.Tag == "meta" {
 		p.extractMetadata(node)
 	}
+	if token.Tag == "link" {
+		p.processLinkTag(token)
+	}
 }
 
 func (p *htmlParser) handleTextToken(token *Token) {
@@ -302,6 +309,10 @@ func (p *htmlParser) GetStylesheetLinks() []string {
 	return p.stylesheetURLs
 }
 
+func (p *htmlParser) GetResourceHints() []ResourceHint {
+	return p.resourceHints
+}
+
 func (p *htmlParser) PrintTree() string {
 	if p.root == nil {
 		return "No DOM tree available\n"
@@ -332,4 +343,7 @@ func (p *htmlParser) processLinkTag(token *Token) {
 	if hasRel && hasHref && rel == "stylesheet" {
 		p.stylesheetURLs = append(p.stylesheetURLs, href)
 	}
+	if hasRel && hasHref {
+		p.resourceHints = append(p.resourceHints, parseResourceHints(rel, href, attrs["as"])...)
+	}
 }
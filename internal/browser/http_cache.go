@@ -0,0 +1,485 @@
+package browser
+
+import (
+	"container/list"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// CacheMode controls how a fetch interacts with the HTTP cache.
+type CacheMode int
+
+const (
+	// CacheModeDefault serves fresh entries and revalidates stale ones.
+	CacheModeDefault CacheMode = iota
+	// CacheModeRevalidate always checks with the server, sending validators.
+	CacheModeRevalidate
+	// CacheModeReload skips the cache entirely but stores the new response.
+	CacheModeReload
+)
+
+// CacheEntry is a stored response together with the timing data needed to
+// compute its age (RFC 9111 section 4.2.3).
+type CacheEntry struct {
+	URL          string        `json:"url"`
+	StatusCode   int           `json:"status_code"`
+	Header       http.Header   `json:"header"`
+	Body         []byte        `json:"body"`
+	RequestTime  time.Time     `json:"request_time"`
+	ResponseTime time.Time     `json:"response_time"`
+	Security     *SecurityInfo `json:"security,omitempty"`
+}
+
+type HTTPCache interface {
+	Get(url string) (*CacheEntry, bool)
+	Put(entry *CacheEntry)
+	Delete(url string)
+	Clear() error
+	// Entries returns every stored entry, most recently used first.
+	Entries() []*CacheEntry
+}
+
+// cacheableStatusCodes are the statuses that are heuristically cacheable.
+var cacheableStatusCodes = map[int]bool{
+	http.StatusOK: true, http.StatusNonAuthoritativeInfo: true, http.StatusNoContent: true,
+	http.StatusMultipleChoices: true, http.StatusMovedPermanently: true, http.StatusPermanentRedirect: true,
+	http.StatusNotFound: true, http.StatusMethodNotAllowed: true, http.StatusGone: true,
+	http.StatusRequestURITooLong: true, http.StatusNotImplemented: true,
+}
+
+func parseCacheControl(value string) map[string]string {
+	directives := make(map[string]string)
+	for _, part := range strings.Split(value, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		name, arg, _ := strings.Cut(part, "=")
+		directives[strings.ToLower(strings.TrimSpace(name))] = strings.Trim(strings.TrimSpace(arg), `"`)
+	}
+	return directives
+}
+
+// isStorable reports whether a response may be kept in a private cache.
+func isStorable(statusCode int, reqHeader, respHeader http.Header, bodySize int) bool {
+	if !cacheableStatusCodes[statusCode] || bodySize > MaxCacheEntrySize {
+		return false
+	}
+
+	if _, noStore := parseCacheControl(reqHeader.Get("Cache-Control"))["no-store"]; noStore {
+		return false
+	}
+	if _, noStore := parseCacheControl(respHeader.Get("Cache-Control"))["no-store"]; noStore {
+		return false
+	}
+
+	// Every request from this browser carries the same headers, so only
+	// Vary: * makes a response unusable for later requests
+	if strings.TrimSpace(respHeader.Get("Vary")) == "*" {
+		return false
+	}
+
+	return true
+}
+
+// freshnessLifetime follows RFC 9111 section 4.2.1: max-age, then Expires,
+// then a heuristic of 10% of the time since Last-Modified.
+func (e *CacheEntry) freshnessLifetime() time.Duration {
+	directives := parseCacheControl(e.Header.Get("Cache-Control"))
+
+	if maxAge, ok := directives["max-age"]; ok {
+		if seconds, err := strconv.ParseInt(maxAge, 10, 64); err == nil && seconds >= 0 {
+			return time.Duration(seconds) * time.Second
+		}
+		return 0
+	}
+
+	date := e.dateValue()
+
+	if expires := e.Header.Get("Expires"); expires != "" {
+		expiresAt, err := http.ParseTime(expires)
+		if err != nil {
+			return 0
+		}
+		return expiresAt.Sub(date)
+	}
+
+	if lastModified, err := http.ParseTime(e.Header.Get("Last-Modified")); err == nil {
+		heuristic := date.Sub(lastModified) / HeuristicFreshnessDivisor
+		if heuristic > MaxHeuristicFreshness {
+			heuristic = MaxHeuristicFreshness
+		}
+		if heuristic > 0 {
+			return heuristic
+		}
+	}
+
+	// Permanent redirects are meant to last, so they get the longest
+	// heuristic lifetime
+	if _, ok := e.redirectLocation(); ok {
+		return MaxHeuristicFreshness
+	}
+
+	return 0
+}
+
+func (e *CacheEntry) dateValue() time.Time {
+	if date, err := http.ParseTime(e.Header.Get("Date")); err == nil {
+		return date
+	}
+	return e.ResponseTime
+}
+
+// currentAge follows RFC 9111 section 4.2.3.
+func (e *CacheEntry) currentAge(now time.Time) time.Duration {
+	apparentAge := e.ResponseTime.Sub(e.dateValue())
+	if apparentAge < 0 {
+		apparentAge = 0
+	}
+
+	ageValue := time.Duration(0)
+	if seconds, err := strconv.ParseInt(e.Header.Get("Age"), 10, 64); err == nil && seconds > 0 {
+		ageValue = time.Duration(seconds) * time.Second
+	}
+
+	responseDelay := e.ResponseTime.Sub(e.RequestTime)
+	correctedAge := ageValue + responseDelay
+	if apparentAge > correctedAge {
+		correctedAge = apparentAge
+	}
+
+	return correctedAge + now.Sub(e.ResponseTime)
+}
+
+// IsFresh reports whether the entry may be served without contacting the server.
+func (e *CacheEntry) IsFresh(now time.Time) bool {
+	if _, noCache := parseCacheControl(e.Header.Get("Cache-Control"))["no-cache"]; noCache {
+		return false
+	}
+	return e.freshnessLifetime() > e.currentAge(now)
+}
+
+func (e *CacheEntry) HasValidators() bool {
+	return e.Header.Get("ETag") != "" || e.Header.Get("Last-Modified") != ""
+}
+
+// ApplyValidators adds conditional request headers for revalidation.
+func (e *CacheEntry) ApplyValidators(req *http.Request) {
+	if etag := e.Header.Get("ETag"); etag != "" {
+		req.Header.Set("If-None-Match", etag)
+	}
+	if lastModified := e.Header.Get("Last-Modified"); lastModified != "" {
+		req.Header.Set("If-Modified-Since", lastModified)
+	}
+}
+
+// Refresh merges the headers of a 304 Not Modified response into the entry
+// (RFC 9111 section 4.3.4) and restarts its age.
+func (e *CacheEntry) Refresh(notModified http.Header, requestTime, responseTime time.Time) {
+	for name, values := range notModified {
+		if strings.EqualFold(name, "Content-Length") {
+			continue
+		}
+		e.Header[name] = append([]string(nil), values...)
+	}
+	e.RequestTime = requestTime
+	e.ResponseTime = responseTime
+}
+
+// ToResponse builds a Response for requestURL from the stored entry.
+func (e *CacheEntry) ToResponse(requestURL string) *Response {
+	resp := NewResponse(requestURL, e.URL, e.StatusCode, e.Header.Clone(), e.Body)
+	resp.FromCache = true
+	resp.Security = e.Security
+	return resp
+}
+
+// redirectLocation returns the URL a stored permanent redirect points to.
+func (e *CacheEntry) redirectLocation() (string, bool) {
+	if e.StatusCode != http.StatusMovedPermanently && e.StatusCode != http.StatusPermanentRedirect {
+		return "", false
+	}
+	base, err := url.Parse(e.URL)
+	if err != nil {
+		return "", false
+	}
+	location, err := base.Parse(e.Header.Get("Location"))
+	if err != nil || e.Header.Get("Location") == "" || (location.Scheme != "http" && location.Scheme != "https") {
+		return "", false
+	}
+	return location.String(), true
+}
+
+func (e *CacheEntry) clone() *CacheEntry {
+	copied := *e
+	copied.Header = e.Header.Clone()
+	return &copied
+}
+
+func (e *CacheEntry) size() int {
+	return len(e.Body) + len(e.URL)
+}
+
+type memoryCache struct {
+	entries  map[string]*list.Element
+	order    *list.List
+	size     int
+	maxBytes int
+	mutex    sync.Mutex
+}
+
+func newMemoryCache(maxBytes int) *memoryCache {
+	return &memoryCache{
+		entries:  make(map[string]*list.Element),
+		order:    list.New(),
+		maxBytes: maxBytes,
+	}
+}
+
+func (mc *memoryCache) Get(url string) (*CacheEntry, bool) {
+	mc.mutex.Lock()
+	defer mc.mutex.Unlock()
+
+	element, ok := mc.entries[url]
+	if !ok {
+		return nil, false
+	}
+	mc.order.MoveToFront(element)
+	return element.Value.(*CacheEntry), true
+}
+
+func (mc *memoryCache) Put(entry *CacheEntry) {
+	mc.mutex.Lock()
+	defer mc.mutex.Unlock()
+
+	if element, ok := mc.entries[entry.URL]; ok {
+		mc.size -= element.Value.(*CacheEntry).size()
+		mc.order.Remove(element)
+	}
+
+	mc.entries[entry.URL] = mc.order.PushFront(entry)
+	mc.size += entry.size()
+
+	// Evict least recently used entries until we fit
+	for mc.size > mc.maxBytes && mc.order.Len() > 1 {
+		oldest := mc.order.Back()
+		evicted := oldest.Value.(*CacheEntry)
+		mc.order.Remove(oldest)
+		delete(mc.entries, evicted.URL)
+		mc.size -= evicted.size()
+	}
+}
+
+func (mc *memoryCache) Delete(url string) {
+	mc.mutex.Lock()
+	defer mc.mutex.Unlock()
+
+	if element, ok := mc.entries[url]; ok {
+		mc.size -= element.Value.(*CacheEntry).size()
+		mc.order.Remove(element)
+		delete(mc.entries, url)
+	}
+}
+
+func (mc *memoryCache) Clear() error {
+	mc.mutex.Lock()
+	defer mc.mutex.Unlock()
+
+	mc.entries = make(map[string]*list.Element)
+	mc.order.Init()
+	mc.size = 0
+	return nil
+}
+
+func (mc *memoryCache) Entries() []*CacheEntry {
+	mc.mutex.Lock()
+	defer mc.mutex.Unlock()
+
+	entries := make([]*CacheEntry, 0, mc.order.Len())
+	for element := mc.order.Front(); element != nil; element = element.Next() {
+		entries = append(entries, element.Value.(*CacheEntry))
+	}
+	return entries
+}
+
+type diskCache struct {
+	dir   string
+	mutex sync.Mutex
+}
+
+func newDiskCache(dir string) *diskCache {
+	return &diskCache{dir: dir}
+}
+
+func (dc *diskCache) path(url string) string {
+	sum := sha256.Sum256([]byte(url))
+	return filepath.Join(dc.dir, hex.EncodeToString(sum[:])+".json")
+}
+
+func (dc *diskCache) Get(url string) (*CacheEntry, bool) {
+	dc.mutex.Lock()
+	defer dc.mutex.Unlock()
+
+	data, err := os.ReadFile(dc.path(url))
+	if err != nil {
+		return nil, false
+	}
+
+	var entry CacheEntry
+	if err := json.Unmarshal(data, &entry); err != nil || entry.URL != url {
+		return nil, false
+	}
+	return &entry, true
+}
+
+func (dc *diskCache) Put(entry *CacheEntry) {
+	dc.mutex.Lock()
+	defer dc.mutex.Unlock()
+
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return
+	}
+	if err := os.MkdirAll(dc.dir, 0o700); err != nil {
+		return
+	}
+
+	// Write through a temp file so a crash never leaves a torn entry behind
+	tmp := dc.path(entry.URL) + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o600); err != nil {
+		return
+	}
+	_ = os.Rename(tmp, dc.path(entry.URL))
+}
+
+func (dc *diskCache) Delete(url string) {
+	dc.mutex.Lock()
+	defer dc.mutex.Unlock()
+	_ = os.Remove(dc.path(url))
+}
+
+func (dc *diskCache) Clear() error {
+	dc.mutex.Lock()
+	defer dc.mutex.Unlock()
+
+	entries, err := os.ReadDir(dc.dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	for _, entry := range entries {
+		if strings.HasSuffix(entry.Name(), ".json") {
+			_ = os.Remove(filepath.Join(dc.dir, entry.Name()))
+		}
+	}
+	return nil
+}
+
+func (dc *diskCache) Entries() []*CacheEntry {
+	dc.mutex.Lock()
+	defer dc.mutex.Unlock()
+
+	files, err := os.ReadDir(dc.dir)
+	if err != nil {
+		return nil
+	}
+
+	entries := make([]*CacheEntry, 0, len(files))
+	for _, file := range files {
+		if !strings.HasSuffix(file.Name(), ".json") {
+			continue
+		}
+		data, err := os.ReadFile(filepath.Join(dc.dir, file.Name()))
+		if err != nil {
+			continue
+		}
+		var entry CacheEntry
+		if err := json.Unmarshal(data, &entry); err == nil {
+			entries = append(entries, &entry)
+		}
+	}
+	return entries
+}
+
+// tieredCache keeps recently used entries in memory and, when a directory
+// is configured, persists every entry to disk.
+type tieredCache struct {
+	memory *memoryCache
+	disk   *diskCache
+}
+
+// NewHTTPCache returns an in-memory cache, backed by diskDir when it is not empty.
+func NewHTTPCache(diskDir string) HTTPCache {
+	cache := &tieredCache{memory: newMemoryCache(MaxMemoryCacheSize)}
+	if diskDir != "" {
+		cache.disk = newDiskCache(diskDir)
+	}
+	return cache
+}
+
+func (tc *tieredCache) Get(url string) (*CacheEntry, bool) {
+	if entry, ok := tc.memory.Get(url); ok {
+		return entry, true
+	}
+
+	if tc.disk == nil {
+		return nil, false
+	}
+
+	entry, ok := tc.disk.Get(url)
+	if ok {
+		tc.memory.Put(entry)
+	}
+	return entry, ok
+}
+
+func (tc *tieredCache) Put(entry *CacheEntry) {
+	tc.memory.Put(entry)
+	if tc.disk != nil {
+		tc.disk.Put(entry)
+	}
+}
+
+func (tc *tieredCache) Delete(url string) {
+	tc.memory.Delete(url)
+	if tc.disk != nil {
+		tc.disk.Delete(url)
+	}
+}
+
+func (tc *tieredCache) Clear() error {
+	_ = tc.memory.Clear()
+	if tc.disk != nil {
+		return tc.disk.Clear()
+	}
+	return nil
+}
+
+func (tc *tieredCache) Entries() []*CacheEntry {
+	entries := tc.memory.Entries()
+	if tc.disk == nil {
+		return entries
+	}
+
+	seen := make(map[string]bool, len(entries))
+	for _, entry := range entries {
+		seen[entry.URL] = true
+	}
+	for _, entry := range tc.disk.Entries() {
+		if !seen[entry.URL] {
+			entries = append(entries, entry)
+		}
+	}
+	return entries
+}
@@ -0,0 +1,84 @@
+package browser
+
+import (
+	"context"
+	"net/http"
+)
+
+// FetchFunc performs a fetch. Interceptors receive the rest of the chain as a
+// FetchFunc.
+type FetchFunc func(ctx context.Context, req *FetchRequest) (*Response, error)
+
+// RequestInterceptor sees every request before it is fetched. It may change
+// req (to redirect it or rewrite its headers) and pass it on with next, return
+// its own Response without calling next, or return an error to block it.
+type RequestInterceptor interface {
+	Intercept(ctx context.Context, req *FetchRequest, next FetchFunc) (*Response, error)
+}
+
+// RequestInterceptorFunc adapts an ordinary function to a RequestInterceptor.
+type RequestInterceptorFunc func(ctx context.Context, req *FetchRequest, next FetchFunc) (*Response, error)
+
+func (f RequestInterceptorFunc) Intercept(ctx context.Context, req *FetchRequest, next FetchFunc) (*Response, error) {
+	return f(ctx, req, next)
+}
+
+// chainInterceptors returns a FetchFunc that runs interceptors in order and
+// ends with fetch.
+func chainInterceptors(interceptors []RequestInterceptor, fetch FetchFunc) FetchFunc {
+	for i := len(interceptors) - 1; i >= 0; i-- {
+		interceptor, next := interceptors[i], fetch
+		fetch = func(ctx context.Context, req *FetchRequest) (*Response, error) {
+			return interceptor.Intercept(ctx, req, next)
+		}
+	}
+	return fetch
+}
+
+// BlockRequests fails every request matched by match with ErrRequestBlocked.
+func BlockRequests(match func(req *FetchRequest) bool) RequestInterceptor {
+	return RequestInterceptorFunc(func(ctx context.Context, req *FetchRequest, next FetchFunc) (*Response, error) {
+		if match(req) {
+			return nil, NewBrowserErrorWithContext(ErrRequestBlocked, "request was blocked", req.URL)
+		}
+		return next(ctx, req)
+	})
+}
+
+// RedirectRequests fetches the URL returned by rewrite instead of the
+// requested one. Returning "" leaves the request unchanged.
+func RedirectRequests(rewrite func(req *FetchRequest) string) RequestInterceptor {
+	return RequestInterceptorFunc(func(ctx context.Context, req *FetchRequest, next FetchFunc) (*Response, error) {
+		if target := rewrite(req); target != "" {
+			req.URL = target
+		}
+		return next(ctx, req)
+	})
+}
+
+// SetRequestHeaders sends header with every request matched by match,
+// replacing any default value of the same name. A nil match matches all.
+func SetRequestHeaders(header http.Header, match func(req *FetchRequest) bool) RequestInterceptor {
+	return RequestInterceptorFunc(func(ctx context.Context, req *FetchRequest, next FetchFunc) (*Response, error) {
+		if match == nil || match(req) {
+			if req.Header == nil {
+				req.Header = make(http.Header)
+			}
+			for name, values := range header {
+				req.Header[http.CanonicalHeaderKey(name)] = append([]string(nil), values...)
+			}
+		}
+		return next(ctx, req)
+	})
+}
+
+// RespondWith answers requests for which respond returns a Response without
+// touching the network. Returning nil passes the request on.
+func RespondWith(respond func(req *FetchRequest) *Response) RequestInterceptor {
+	return RequestInterceptorFunc(func(ctx context.Context, req *FetchRequest, next FetchFunc) (*Response, error) {
+		if resp := respond(req); resp != nil {
+			return resp, nil
+		}
+		return next(ctx, req)
+	})
+}
@@ -0,0 +1,89 @@
+package browser
+
+import (
+	"net/url"
+	"strings"
+)
+
+// MixedContentMode chooses what happens to passive mixed content, such as
+// images, on https pages. Active mixed content is always blocked.
+type MixedContentMode int
+
+const (
+	// MixedContentUpgrade rewrites passive http resources to https.
+	MixedContentUpgrade MixedContentMode = iota
+	// MixedContentWarn keeps passive http resources and reports them.
+	MixedContentWarn
+)
+
+func (m MixedContentMode) String() string {
+	switch m {
+	case MixedContentWarn:
+		return "warn"
+	default:
+		return "upgrade"
+	}
+}
+
+// ParseMixedContentMode parses the names returned by MixedContentMode.String.
+func ParseMixedContentMode(name string) (MixedContentMode, error) {
+	switch strings.ToLower(strings.TrimSpace(name)) {
+	case "upgrade":
+		return MixedContentUpgrade, nil
+	case "warn":
+		return MixedContentWarn, nil
+	default:
+		return MixedContentUpgrade, NewBrowserErrorWithContext(ErrInvalidInput, "mixed content mode must be upgrade or warn", name)
+	}
+}
+
+// MixedContentReport lists the insecure resources an https page referred to.
+type MixedContentReport struct {
+	// Blocked holds active content, such as stylesheets and scripts, that was
+	// not loaded.
+	Blocked []string
+	// Upgraded holds passive content that is loaded over https instead.
+	Upgraded []string
+	// Warned holds passive content that is loaded over http.
+	Warned []string
+}
+
+func (r MixedContentReport) IsEmpty() bool {
+	return len(r.Blocked) == 0 && len(r.Upgraded) == 0 && len(r.Warned) == 0
+}
+
+// passiveMixedContentTags are the elements whose src is passive content
+// (Mixed Content section 3.1): it cannot change the rest of the page.
+var passiveMixedContentTags = map[string]bool{
+	"img":    true,
+	"audio":  true,
+	"video":  true,
+	"source": true,
+}
+
+// isMixedContent reports whether loading resourceURL from a document at
+// pageURL is mixed content: an https page fetching over plain http.
+func isMixedContent(pageURL, resourceURL string) bool {
+	page, err := url.Parse(pageURL)
+	if err != nil || !strings.EqualFold(page.Scheme, "https") {
+		return false
+	}
+
+	resource, err := url.Parse(resourceURL)
+	return err == nil && strings.EqualFold(resource.Scheme, "http")
+}
+
+// upgradeToHTTPS rewrites an http URL to https, as for an
+// upgrade-insecure-requests policy.
+func upgradeToHTTPS(rawURL string) string {
+	parsed, err := url.Parse(rawURL)
+	if err != nil || !strings.EqualFold(parsed.Scheme, "http") {
+		return rawURL
+	}
+
+	parsed.Scheme = "https"
+	if parsed.Port() == "80" {
+		parsed.Host = strings.TrimSuffix(parsed.Host, ":80")
+	}
+	return parsed.String()
+}
@@ -39,6 +39,37 @@ type Node interface {
 	String() string
 }
 
+// FindEnclosingLink returns node itself or its nearest ancestor that is an
+// <a> element with an href, or nil if there is none.
+func FindEnclosingLink(node Node) Node {
+	for current := node; current != nil; current = current.GetParent() {
+		if current.GetType() != ElementNodeType || current.GetTag() != "a" {
+			continue
+		}
+		if _, ok := current.GetAttribute("href"); ok {
+			return current
+		}
+	}
+	return nil
+}
+
+// findElements returns the elements under node, node included, with the
+// given tag in tree order.
+func findElements(node Node, tag string) []Node {
+	if node == nil {
+		return nil
+	}
+
+	var elements []Node
+	if node.GetType() == ElementNodeType && node.GetTag() == tag {
+		elements = append(elements, node)
+	}
+	for _, child := range node.GetChildren() {
+		elements = append(elements, findElements(child, tag)...)
+	}
+	return elements
+}
+
 type elementNode struct {
 	tag        string
 	attributes map[string]string
@@ -0,0 +1,243 @@
+package browser
+
+import (
+	"crypto/tls"
+	"net/http"
+	"net/url"
+)
+
+// APIHandlerOption configures an APIHandler created by NewAPIHandler.
+type APIHandlerOption func(*apiHandler)
+
+// WithFileRoots limits file:// access to the given directories. Without
+// any roots, file URLs are refused.
+func WithFileRoots(roots ...string) APIHandlerOption {
+	return func(ah *apiHandler) {
+		ah.fileLoader.SetAllowedRoots(roots)
+	}
+}
+
+// WithHTTPCache replaces the default in-memory HTTP cache. Passing nil
+// disables caching.
+func WithHTTPCache(cache HTTPCache) APIHandlerOption {
+	return func(ah *apiHandler) {
+		ah.cache = cache
+	}
+}
+
+// WithDiskCache keeps cached responses in dir in addition to memory, so they
+// survive restarts.
+func WithDiskCache(dir string) APIHandlerOption {
+	return func(ah *apiHandler) {
+		ah.cache = NewHTTPCache(dir)
+	}
+}
+
+// WithCookieJar replaces the default in-memory cookie jar. Passing nil
+// disables cookies.
+func WithCookieJar(jar CookieJar) APIHandlerOption {
+	return func(ah *apiHandler) {
+		ah.cookieJar = jar
+	}
+}
+
+// WithSchemeHandler serves URLs of scheme with handler, replacing any
+// built-in handler for that scheme.
+func WithSchemeHandler(scheme string, handler SchemeHandler) APIHandlerOption {
+	return func(ah *apiHandler) {
+		ah.schemes.Register(scheme, handler)
+	}
+}
+
+// WithTransport sends HTTP requests through transport instead of the
+// handler's own http.Transport, e.g. to stub the network in tests.
+func WithTransport(transport http.RoundTripper) APIHandlerOption {
+	return func(ah *apiHandler) {
+		ah.client.Transport = transport
+	}
+}
+
+// WithProxy selects the proxy for each HTTP request, e.g. with
+// ProxyConfig.ProxyFunc. It applies to the handler's own transport and to an
+// *http.Transport given to WithTransport. Without it, the HTTP_PROXY,
+// HTTPS_PROXY and NO_PROXY environment variables are used.
+func WithProxy(proxy func(*http.Request) (*url.URL, error)) APIHandlerOption {
+	return func(ah *apiHandler) {
+		ah.proxy = proxy
+	}
+}
+
+// WithConnectionLimits caps how many requests run at once, overall and to
+// any one host.
+func WithConnectionLimits(maxTotal, maxPerHost int) APIHandlerOption {
+	return func(ah *apiHandler) {
+		ah.scheduler = NewScheduler(maxTotal, maxPerHost)
+	}
+}
+
+// WithTLSConfig sets the TLS configuration of the handler's transport, e.g.
+// from TLSSettings.ClientConfig. Like WithProxy, it also applies to an
+// *http.Transport given to WithTransport.
+func WithTLSConfig(config *tls.Config) APIHandlerOption {
+	return func(ah *apiHandler) {
+		ah.tlsConfig = config
+	}
+}
+
+// WithCertificateExceptions accepts the certificates of hosts matching the
+// given globs, such as "*.staging.internal", without verifying them. Pages
+// from those hosts are shown as not verified.
+func WithCertificateExceptions(patterns ...string) APIHandlerOption {
+	return func(ah *apiHandler) {
+		ah.certExceptions = append(ah.certExceptions, patterns...)
+	}
+}
+
+// WithHSTSStore upgrades requests to the store's hosts to https and records
+// the Strict-Transport-Security headers of responses in it.
+func WithHSTSStore(store HSTSStore) APIHandlerOption {
+	return func(ah *apiHandler) {
+		ah.hsts = store
+	}
+}
+
+// WithRetryPolicy replaces DefaultRetryPolicy. A policy with MaxAttempts of
+// 1 turns retrying off.
+func WithRetryPolicy(policy RetryPolicy) APIHandlerOption {
+	return func(ah *apiHandler) {
+		ah.retryPolicy = policy
+	}
+}
+
+// WithRequestInterceptors appends interceptors to the chain every fetch runs
+// through. They run in the order given.
+func WithRequestInterceptors(interceptors ...RequestInterceptor) APIHandlerOption {
+	return func(ah *apiHandler) {
+		ah.interceptors = append(ah.interceptors, interceptors...)
+	}
+}
+
+// WithHARRecorder records every HTTP exchange the handler makes, including
+// redirects, into recorder.
+func WithHARRecorder(recorder HARRecorder) APIHandlerOption {
+	return func(ah *apiHandler) {
+		ah.harRecorder = recorder
+	}
+}
+
+// WithHARReplay answers every HTTP request from archive without network
+// access. The HTTP cache is kept in memory only, so every response the page
+// sees comes from the archive.
+func WithHARReplay(archive *HAR) APIHandlerOption {
+	return func(ah *apiHandler) {
+		ah.harReplay = archive
+	}
+}
+
+// EngineOption configures an Engine created by NewEngine.
+type EngineOption func(*engineConfig)
+
+type engineConfig struct {
+	apiHandlerOptions []APIHandlerOption
+	profileDir        string
+	appName           string
+	appVersion        string
+	harPath           string
+	filterLists       []string
+	hstsPreloadLists  []string
+	mixedContentMode  MixedContentMode
+	downloadDir       string
+	// autoRefreshDisabled is inverted so refreshing is on by default
+	autoRefreshDisabled bool
+	hoverPrefetch       bool
+}
+
+// WithFilterLists loads Adblock Plus filter lists from paths, in addition to
+// those in the profile's filters directory.
+func WithFilterLists(paths ...string) EngineOption {
+	return func(cfg *engineConfig) {
+		cfg.filterLists = append(cfg.filterLists, paths...)
+	}
+}
+
+// WithHSTSPreloadLists loads HSTS preload lists, in Chromium's
+// transport_security_state_static.json format, into the engine's HSTS store.
+func WithHSTSPreloadLists(paths ...string) EngineOption {
+	return func(cfg *engineConfig) {
+		cfg.hstsPreloadLists = append(cfg.hstsPreloadLists, paths...)
+	}
+}
+
+// WithMixedContentMode chooses whether passive http content on https pages,
+// such as images, is upgraded to https (the default) or loaded with a warning.
+func WithMixedContentMode(mode MixedContentMode) EngineOption {
+	return func(cfg *engineConfig) {
+		cfg.mixedContentMode = mode
+	}
+}
+
+// WithDownloadDir saves downloads to dir instead of the user's Downloads
+// folder.
+func WithDownloadDir(dir string) EngineOption {
+	return func(cfg *engineConfig) {
+		cfg.downloadDir = dir
+	}
+}
+
+// WithAutoRefresh chooses whether pages that ask to be reloaded or
+// redirected after a delay, with a Refresh header or <meta
+// http-equiv="refresh">, are. It is enabled by default.
+func WithAutoRefresh(enabled bool) EngineOption {
+	return func(cfg *engineConfig) {
+		cfg.autoRefreshDisabled = !enabled
+	}
+}
+
+// WithHoverPrefetch prefetches the page a link points to while the pointer
+// rests on it, so following the link is faster. It is disabled by default.
+func WithHoverPrefetch(enabled bool) EngineOption {
+	return func(cfg *engineConfig) {
+		cfg.hoverPrefetch = enabled
+	}
+}
+
+// WithHARRecording records the session's network traffic and writes it to
+// path as a HAR file when the engine shuts down.
+func WithHARRecording(path string) EngineOption {
+	return func(cfg *engineConfig) {
+		cfg.harPath = path
+	}
+}
+
+// WithAppInfo sets the application name and version shown on about:version.
+func WithAppInfo(name, version string) EngineOption {
+	return func(cfg *engineConfig) {
+		cfg.appName = name
+		cfg.appVersion = version
+	}
+}
+
+// WithProfileDir keeps persistent browser state, such as cookies, in dir.
+func WithProfileDir(dir string) EngineOption {
+	return func(cfg *engineConfig) {
+		cfg.profileDir = dir
+	}
+}
+
+// WithAPIHandlerOptions forwards options to the engine's APIHandler.
+func WithAPIHandlerOptions(opts ...APIHandlerOption) EngineOption {
+	return func(cfg *engineConfig) {
+		cfg.apiHandlerOptions = append(cfg.apiHandlerOptions, opts...)
+	}
+}
+
+// WithRoundTripper is shorthand for WithAPIHandlerOptions(WithTransport(transport)).
+func WithRoundTripper(transport http.RoundTripper) EngineOption {
+	return WithAPIHandlerOptions(WithTransport(transport))
+}
+
+// WithInterceptors is shorthand for
+// WithAPIHandlerOptions(WithRequestInterceptors(interceptors...)).
+func WithInterceptors(interceptors ...RequestInterceptor) EngineOption {
+	return WithAPIHandlerOptions(WithRequestInterceptors(interceptors...))
+}
@@ -0,0 +1,102 @@
+package browser
+
+import (
+	"errors"
+	"fmt"
+	"html"
+	"net/url"
+	"path"
+	"strings"
+)
+
+// pageTitleForURL returns the last path segment of a URL, falling back to the
+// URL itself, for use as the title of generated pages.
+func pageTitleForURL(rawURL string) string {
+	parsed, err := url.Parse(rawURL)
+	if err != nil || parsed.Path == "" || parsed.Path == "/" {
+		return rawURL
+	}
+	return path.Base(parsed.Path)
+}
+
+// renderTextPage shows a non-HTML text resource (CSS, JSON, plain text) verbatim.
+func renderTextPage(resp *Response) string {
+	var page strings.Builder
+	page.WriteString("<!DOCTYPE html>\n<html>\n<head>\n")
+	fmt.Fprintf(&page, "<title>%s</title>\n", html.EscapeString(pageTitleForURL(resp.URL)))
+	page.WriteString("</head>\n<body>\n<pre>")
+	page.WriteString(html.EscapeString(resp.Text()))
+	page.WriteString("</pre>\n</body>\n</html>\n")
+	return page.String()
+}
+
+// renderImagePage describes an image resource, since images are not painted yet.
+func renderImagePage(resp *Response) string {
+	title := html.EscapeString(pageTitleForURL(resp.URL))
+
+	var page strings.Builder
+	page.WriteString("<!DOCTYPE html>\n<html>\n<head>\n")
+	fmt.Fprintf(&page, "<title>%s</title>\n", title)
+	page.WriteString("</head>\n<body>\n")
+	fmt.Fprintf(&page, "<h1>%s</h1>\n", title)
+	fmt.Fprintf(&page, "<p>Image (%s, %d bytes)</p>\n", html.EscapeString(resp.ContentType), len(resp.Body))
+	fmt.Fprintf(&page, "<p><small>%s</small></p>\n", html.EscapeString(resp.URL))
+	page.WriteString("</body>\n</html>\n")
+	return page.String()
+}
+
+// errorPageHeading picks a short, user-facing heading for a failed load.
+func errorPageHeading(err error) string {
+	switch {
+	case errors.Is(err, ErrHTTPError):
+		return "This page returned an error"
+	case errors.Is(err, ErrNetworkTimeout):
+		return "The connection timed out"
+	case errors.Is(err, ErrConnectionFailed):
+		return "Unable to connect"
+	case errors.Is(err, ErrInvalidURL):
+		return "Invalid address"
+	case errors.Is(err, ErrAccessDenied):
+		return "Access denied"
+	case errors.Is(err, ErrFileNotFound):
+		return "File not found"
+	case errors.Is(err, ErrUnsupportedContent):
+		return "This content cannot be displayed"
+	case errors.Is(err, ErrRequestCancelled):
+		return "Loading was stopped"
+	case errors.Is(err, ErrRequestBlocked):
+		return "This page has been blocked"
+	case errors.Is(err, ErrParsingFailed):
+		return "The page could not be displayed"
+	default:
+		return "Something went wrong"
+	}
+}
+
+// renderErrorPage describes why failedURL could not be shown and offers a
+// link to try again.
+func renderErrorPage(failedURL string, err error) string {
+	heading := html.EscapeString(errorPageHeading(err))
+
+	detail := err.Error()
+	var browserErr *BrowserError
+	if errors.As(err, &browserErr) {
+		detail = browserErr.Message
+	}
+
+	var page strings.Builder
+	page.WriteString("<!DOCTYPE html>\n<html>\n<head>\n")
+	fmt.Fprintf(&page, "<title>%s</title>\n", heading)
+	fmt.Fprintf(&page, "<style>h1 { color: #%02X%02X%02X; }</style>\n", ErrorColorR, ErrorColorG, ErrorColorB)
+	page.WriteString("</head>\n<body>\n")
+	fmt.Fprintf(&page, "<h1>%s</h1>\n", heading)
+	if failedURL != "" {
+		fmt.Fprintf(&page, "<p>%s could not be loaded.</p>\n", html.EscapeString(failedURL))
+	}
+	fmt.Fprintf(&page, "<p><small>%s</small></p>\n", html.EscapeString(detail))
+	if failedURL != "" {
+		fmt.Fprintf(&page, "<p><a href=\"%s\">Try again</a></p>\n", html.EscapeString(failedURL))
+	}
+	page.WriteString("</body>\n</html>\n")
+	return page.String()
+}
@@ -0,0 +1,113 @@
+package browser
+
+import (
+	"context"
+	"net"
+	"sync"
+	"time"
+)
+
+type dialFunc func(ctx context.Context, network, addr string) (net.Conn, error)
+
+// preconnector opens TCP connections ahead of time for the transport to
+// use, so the first request to a host a page hinted at skips the DNS lookup
+// and TCP handshake. Connections nobody uses are closed after
+// PreconnectIdleTimeout, before servers tend to drop them.
+type preconnector struct {
+	dial  dialFunc
+	idle  map[string][]*warmConn
+	mutex sync.Mutex
+}
+
+type warmConn struct {
+	net.Conn
+	timer *time.Timer
+}
+
+// newPreconnector dials through dial, or a plain net.Dialer when it is nil
+// as the transport's own would be.
+func newPreconnector(dial dialFunc) *preconnector {
+	if dial == nil {
+		dialer := &net.Dialer{Timeout: DefaultTimeout, KeepAlive: KeepAliveTimeout}
+		dial = dialer.DialContext
+	}
+	return &preconnector{
+		dial: dial,
+		idle: make(map[string][]*warmConn),
+	}
+}
+
+// DialContext hands out a preconnected connection to addr if there is one.
+func (pc *preconnector) DialContext(ctx context.Context, network, addr string) (net.Conn, error) {
+	if network == "tcp" {
+		if conn := pc.take(addr); conn != nil {
+			return conn, nil
+		}
+	}
+	return pc.dial(ctx, network, addr)
+}
+
+// Preconnect opens a connection to addr, a host:port, unless enough are
+// already waiting.
+func (pc *preconnector) Preconnect(ctx context.Context, addr string) error {
+	pc.mutex.Lock()
+	waiting := len(pc.idle[addr])
+	pc.mutex.Unlock()
+	if waiting >= MaxPreconnectsPerHost {
+		return nil
+	}
+
+	conn, err := pc.dial(ctx, "tcp", addr)
+	if err != nil {
+		return err
+	}
+
+	warm := &warmConn{Conn: conn}
+	pc.mutex.Lock()
+	defer pc.mutex.Unlock()
+
+	pc.idle[addr] = append(pc.idle[addr], warm)
+	warm.timer = time.AfterFunc(PreconnectIdleTimeout, func() { pc.expire(addr, warm) })
+	return nil
+}
+
+func (pc *preconnector) take(addr string) net.Conn {
+	pc.mutex.Lock()
+	defer pc.mutex.Unlock()
+
+	conns := pc.idle[addr]
+	if len(conns) == 0 {
+		return nil
+	}
+	warm := conns[len(conns)-1]
+	pc.removeLocked(addr, warm)
+	warm.timer.Stop()
+	return warm.Conn
+}
+
+func (pc *preconnector) expire(addr string, warm *warmConn) {
+	pc.mutex.Lock()
+	removed := pc.removeLocked(addr, warm)
+	pc.mutex.Unlock()
+
+	// Already handed out if it was no longer waiting
+	if removed {
+		warm.Close()
+	}
+}
+
+func (pc *preconnector) removeLocked(addr string, target *warmConn) bool {
+	conns := pc.idle[addr]
+	for i, warm := range conns {
+		if warm == target {
+			conns = append(conns[:i], conns[i+1:]...)
+			if len(conns) == 0 {
+				delete(pc.idle, addr)
+			} else {
+				pc.idle[addr] = conns
+			}
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,153 @@
+package browser
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"strings"
+
+	"golang.org/x/net/http/httpproxy"
+)
+
+// ProxyDirect in a rule or as the proxy means connecting without a proxy.
+const ProxyDirect = "DIRECT"
+
+// ProxyConfig chooses the proxy for each request. Proxies are URLs with an
+// http, https, socks5 or socks5h scheme and optional user:password; a bare
+// host:port is taken as an HTTP proxy. HTTPS through an HTTP proxy uses
+// CONNECT.
+type ProxyConfig struct {
+	// Proxy is used for every request no rule matches. When empty, the
+	// HTTP_PROXY, HTTPS_PROXY and NO_PROXY environment variables apply.
+	Proxy string `json:"proxy,omitempty"`
+	// NoProxy lists hosts that bypass Proxy, in NO_PROXY syntax.
+	NoProxy []string `json:"noProxy,omitempty"`
+	// Rules are checked in order before Proxy; the first whose pattern
+	// matches the request host wins.
+	Rules []ProxyRule `json:"rules,omitempty"`
+	// IgnoreEnvironment stops the environment variables being used when
+	// Proxy is empty.
+	IgnoreEnvironment bool `json:"ignoreEnvironment,omitempty"`
+}
+
+// ProxyRule sends requests for hosts matching Pattern, a glob such as
+// "*.corp.example.com" or "10.*", to Proxy or, with ProxyDirect, straight out.
+type ProxyRule struct {
+	Pattern string `json:"pattern"`
+	Proxy   string `json:"proxy"`
+}
+
+// LoadProxyConfig reads a JSON proxy configuration file.
+func LoadProxyConfig(path string) (*ProxyConfig, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, NewBrowserErrorWithContext(ErrFileNotFound, "proxy config does not exist", path)
+		}
+		return nil, err
+	}
+
+	var config ProxyConfig
+	if err := json.Unmarshal(data, &config); err != nil {
+		return nil, NewBrowserErrorWithContext(ErrParsingFailed, "invalid proxy config: "+err.Error(), path)
+	}
+	return &config, nil
+}
+
+// ParseProxyRule parses a rule written as "pattern=proxy", e.g.
+// "*.internal=DIRECT" or "*.example.com=socks5://localhost:1080".
+func ParseProxyRule(rule string) (ProxyRule, error) {
+	pattern, proxy, found := strings.Cut(rule, "=")
+	pattern, proxy = strings.TrimSpace(pattern), strings.TrimSpace(proxy)
+	if !found || pattern == "" || proxy == "" {
+		return ProxyRule{}, NewBrowserErrorWithContext(ErrInvalidInput, "proxy rule must be pattern=proxy", rule)
+	}
+	return ProxyRule{Pattern: pattern, Proxy: proxy}, nil
+}
+
+// ProxyFunc returns a function suitable for http.Transport.Proxy. It fails
+// if a proxy URL or rule pattern is invalid.
+func (c *ProxyConfig) ProxyFunc() (func(*http.Request) (*url.URL, error), error) {
+	type compiledRule struct {
+		pattern string
+		proxy   *url.URL
+	}
+
+	rules := make([]compiledRule, 0, len(c.Rules))
+	for _, rule := range c.Rules {
+		pattern := strings.ToLower(rule.Pattern)
+		if _, err := path.Match(pattern, ""); err != nil {
+			return nil, NewBrowserErrorWithContext(ErrInvalidInput, "invalid proxy rule pattern", rule.Pattern)
+		}
+		proxy, err := parseProxyURL(rule.Proxy)
+		if err != nil {
+			return nil, err
+		}
+		rules = append(rules, compiledRule{pattern: pattern, proxy: proxy})
+	}
+
+	fallback, err := c.fallbackProxyFunc()
+	if err != nil {
+		return nil, err
+	}
+
+	return func(req *http.Request) (*url.URL, error) {
+		host := strings.ToLower(req.URL.Hostname())
+		for _, rule := range rules {
+			if matched, _ := path.Match(rule.pattern, host); matched {
+				return rule.proxy, nil
+			}
+		}
+		return fallback(req.URL)
+	}, nil
+}
+
+func (c *ProxyConfig) fallbackProxyFunc() (func(*url.URL) (*url.URL, error), error) {
+	if c.Proxy == "" {
+		if c.IgnoreEnvironment {
+			return func(*url.URL) (*url.URL, error) { return nil, nil }, nil
+		}
+		return httpproxy.FromEnvironment().ProxyFunc(), nil
+	}
+
+	proxy, err := parseProxyURL(c.Proxy)
+	if err != nil {
+		return nil, err
+	}
+	if proxy == nil {
+		return func(*url.URL) (*url.URL, error) { return nil, nil }, nil
+	}
+
+	// httpproxy applies the NO_PROXY matching rules, including ports and
+	// CIDR ranges, and never proxies localhost
+	return (&httpproxy.Config{
+		HTTPProxy:  proxy.String(),
+		HTTPSProxy: proxy.String(),
+		NoProxy:    strings.Join(c.NoProxy, ","),
+	}).ProxyFunc(), nil
+}
+
+// parseProxyURL returns nil for ProxyDirect.
+func parseProxyURL(raw string) (*url.URL, error) {
+	raw = strings.TrimSpace(raw)
+	if strings.EqualFold(raw, ProxyDirect) {
+		return nil, nil
+	}
+	if !strings.Contains(raw, "://") {
+		raw = "http://" + raw
+	}
+
+	proxy, err := url.Parse(raw)
+	if err != nil || proxy.Host == "" {
+		return nil, NewBrowserErrorWithContext(ErrInvalidInput, "invalid proxy URL", raw)
+	}
+
+	switch strings.ToLower(proxy.Scheme) {
+	case "http", "https", "socks5", "socks5h":
+		return proxy, nil
+	default:
+		return nil, NewBrowserErrorWithContext(ErrInvalidInput, "unsupported proxy scheme "+proxy.Scheme, raw)
+	}
+}
@@ -0,0 +1,206 @@
+package browser
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// ReferrerPolicy controls how much of a document's URL is sent in the
+// Referer header of the requests it makes (Referrer Policy section 3). The
+// zero value behaves as DefaultReferrerPolicy.
+type ReferrerPolicy string
+
+const (
+	ReferrerPolicyNoReferrer                  ReferrerPolicy = "no-referrer"
+	ReferrerPolicyNoReferrerWhenDowngrade     ReferrerPolicy = "no-referrer-when-downgrade"
+	ReferrerPolicySameOrigin                  ReferrerPolicy = "same-origin"
+	ReferrerPolicyOrigin                      ReferrerPolicy = "origin"
+	ReferrerPolicyStrictOrigin                ReferrerPolicy = "strict-origin"
+	ReferrerPolicyOriginWhenCrossOrigin       ReferrerPolicy = "origin-when-cross-origin"
+	ReferrerPolicyStrictOriginWhenCrossOrigin ReferrerPolicy = "strict-origin-when-cross-origin"
+	ReferrerPolicyUnsafeURL                   ReferrerPolicy = "unsafe-url"
+
+	// DefaultReferrerPolicy applies when a document sets no policy.
+	DefaultReferrerPolicy = ReferrerPolicyStrictOriginWhenCrossOrigin
+)
+
+var referrerPolicies = map[string]ReferrerPolicy{
+	string(ReferrerPolicyNoReferrer):                  ReferrerPolicyNoReferrer,
+	string(ReferrerPolicyNoReferrerWhenDowngrade):     ReferrerPolicyNoReferrerWhenDowngrade,
+	string(ReferrerPolicySameOrigin):                  ReferrerPolicySameOrigin,
+	string(ReferrerPolicyOrigin):                      ReferrerPolicyOrigin,
+	string(ReferrerPolicyStrictOrigin):                ReferrerPolicyStrictOrigin,
+	string(ReferrerPolicyOriginWhenCrossOrigin):       ReferrerPolicyOriginWhenCrossOrigin,
+	string(ReferrerPolicyStrictOriginWhenCrossOrigin): ReferrerPolicyStrictOriginWhenCrossOrigin,
+	string(ReferrerPolicyUnsafeURL):                   ReferrerPolicyUnsafeURL,
+}
+
+// legacyReferrerPolicies are the older keywords <meta name="referrer"> also
+// accepts (HTML section 4.2.5.2).
+var legacyReferrerPolicies = map[string]ReferrerPolicy{
+	"never":                   ReferrerPolicyNoReferrer,
+	"default":                 DefaultReferrerPolicy,
+	"always":                  ReferrerPolicyUnsafeURL,
+	"origin-when-crossorigin": ReferrerPolicyOriginWhenCrossOrigin,
+}
+
+// ParseReferrerPolicy parses a Referrer-Policy header or referrerpolicy
+// attribute. Of a comma-separated list, the last policy recognised wins, so
+// sites can name newer policies after a fallback.
+func ParseReferrerPolicy(value string) (ReferrerPolicy, bool) {
+	var policy ReferrerPolicy
+	found := false
+	for _, token := range strings.Split(value, ",") {
+		if parsed, ok := referrerPolicies[strings.ToLower(strings.TrimSpace(token))]; ok {
+			policy, found = parsed, true
+		}
+	}
+	return policy, found
+}
+
+// parseMetaReferrerPolicy parses the content of <meta name="referrer">,
+// which names a single policy or one of the legacy keywords.
+func parseMetaReferrerPolicy(content string) (ReferrerPolicy, bool) {
+	token := strings.ToLower(strings.TrimSpace(content))
+	if policy, ok := referrerPolicies[token]; ok {
+		return policy, true
+	}
+	policy, ok := legacyReferrerPolicies[token]
+	return policy, ok
+}
+
+// Referrer returns the Referer header a request for targetURL made by the
+// document at referrerURL should carry under the policy, or "" for none.
+// Only http and https documents send a referrer; the fragment and any
+// credentials are never included.
+func (p ReferrerPolicy) Referrer(referrerURL, targetURL string) string {
+	referrer, err := url.Parse(referrerURL)
+	if err != nil || (referrer.Scheme != "http" && referrer.Scheme != "https") || referrer.Host == "" {
+		return ""
+	}
+	referrer.User = nil
+	referrer.Fragment, referrer.RawFragment = "", ""
+
+	target, err := url.Parse(targetURL)
+	if err != nil {
+		return ""
+	}
+
+	full := referrer.String()
+	origin := referrer.Scheme + "://" + referrer.Host + "/"
+	// Overlong referrers are cut to their origin (Referrer Policy 8.3)
+	if len(full) > MaxReferrerLength {
+		full = origin
+	}
+
+	sameOrigin := sameOrigin(referrer, target)
+	downgrade := referrer.Scheme == "https" && target.Scheme != "https"
+
+	switch p {
+	case ReferrerPolicyNoReferrer:
+		return ""
+	case ReferrerPolicyOrigin:
+		return origin
+	case ReferrerPolicyUnsafeURL:
+		return full
+	case ReferrerPolicyStrictOrigin:
+		if downgrade {
+			return ""
+		}
+		return origin
+	case ReferrerPolicySameOrigin:
+		if sameOrigin {
+			return full
+		}
+		return ""
+	case ReferrerPolicyOriginWhenCrossOrigin:
+		if sameOrigin {
+			return full
+		}
+		return origin
+	case ReferrerPolicyNoReferrerWhenDowngrade:
+		if downgrade {
+			return ""
+		}
+		return full
+	default:
+		switch {
+		case sameOrigin:
+			return full
+		case downgrade:
+			return ""
+		default:
+			return origin
+		}
+	}
+}
+
+func sameOrigin(a, b *url.URL) bool {
+	return strings.EqualFold(a.Scheme, b.Scheme) &&
+		strings.EqualFold(a.Hostname(), b.Hostname()) &&
+		effectivePort(a) == effectivePort(b)
+}
+
+func effectivePort(u *url.URL) string {
+	if port := u.Port(); port != "" {
+		return port
+	}
+	switch strings.ToLower(u.Scheme) {
+	case "http":
+		return "80"
+	case "https":
+		return "443"
+	}
+	return ""
+}
+
+// hasLinkType reports whether element's rel attribute lists linkType, such
+// as noreferrer.
+func hasLinkType(element Node, linkType string) bool {
+	rel, _ := element.GetAttribute("rel")
+	for _, token := range strings.Fields(rel) {
+		if strings.EqualFold(token, linkType) {
+			return true
+		}
+	}
+	return false
+}
+
+// requestReferrer is the referrer of a request in flight, kept in its
+// context so the Referer can be worked out again for each redirect.
+type requestReferrer struct {
+	url    string
+	policy ReferrerPolicy
+}
+
+type requestReferrerKey struct{}
+
+func withRequestReferrer(ctx context.Context, fetchReq *FetchRequest) context.Context {
+	if fetchReq.Referrer == "" {
+		return ctx
+	}
+	return context.WithValue(ctx, requestReferrerKey{}, &requestReferrer{url: fetchReq.Referrer, policy: fetchReq.ReferrerPolicy})
+}
+
+// applyRedirectReferrer replaces the Referer net/http copies onto a
+// redirect, which is the URL that redirected, with the one the request's
+// policy allows for the new URL. A Referrer-Policy on the redirect response
+// applies from then on.
+func applyRedirectReferrer(req *http.Request) {
+	req.Header.Del("Referer")
+
+	referrer, ok := req.Context().Value(requestReferrerKey{}).(*requestReferrer)
+	if !ok {
+		return
+	}
+	if req.Response != nil {
+		if policy, ok := ParseReferrerPolicy(strings.Join(req.Response.Header.Values("Referrer-Policy"), ",")); ok {
+			referrer.policy = policy
+		}
+	}
+	if value := referrer.policy.Referrer(referrer.url, req.URL.String()); value != "" {
+		req.Header.Set("Referer", value)
+	}
+}
@@ -0,0 +1,217 @@
+package browser
+
+import (
+	"context"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// asciiWhitespace is the whitespace HTML skips when parsing attributes.
+const asciiWhitespace = " \t\n\f\r"
+
+// Refresh is a navigation a page asked for with a Refresh header or
+// <meta http-equiv="refresh">, which happens once its delay has passed.
+type Refresh struct {
+	// URL is the page to load, which is the page itself for a reload.
+	URL    string
+	Reload bool
+	// At is when the refresh is due.
+	At time.Time
+}
+
+// scheduledRefresh is the pending refresh of a tab's page.
+type scheduledRefresh struct {
+	Refresh
+	// pageURL is the page that asked for the refresh; it is dropped once
+	// the tab shows another.
+	pageURL        string
+	referrerPolicy ReferrerPolicy
+	timer          *time.Timer
+}
+
+// parseRefresh parses the value of a Refresh header or the content of a
+// <meta http-equiv="refresh">, such as "5; url=/next" (HTML section
+// 4.2.5.3). target is "" when the page should reload itself.
+func parseRefresh(value string) (delay time.Duration, target string, ok bool) {
+	rest := strings.TrimLeft(value, asciiWhitespace)
+
+	digits := len(rest) - len(strings.TrimLeft(rest, "0123456789"))
+	if digits == 0 && !strings.HasPrefix(rest, ".") {
+		return 0, "", false
+	}
+	seconds := 0
+	if digits > 0 {
+		parsed, err := strconv.Atoi(rest[:digits])
+		if err != nil || parsed > MaxRefreshDelay {
+			return 0, "", false
+		}
+		seconds = parsed
+	}
+	// Fractions of a second are allowed but ignored
+	rest = strings.TrimLeft(rest, "0123456789.")
+	delay = time.Duration(seconds) * time.Second
+
+	if rest == "" {
+		return delay, "", true
+	}
+	if !strings.ContainsAny(rest[:1], ";,"+asciiWhitespace) {
+		return 0, "", false
+	}
+	rest = strings.TrimLeft(rest, asciiWhitespace)
+	if strings.HasPrefix(rest, ";") || strings.HasPrefix(rest, ",") {
+		rest = strings.TrimLeft(rest[1:], asciiWhitespace)
+	}
+
+	if len(rest) >= 3 && strings.EqualFold(rest[:3], "url") {
+		afterURL := strings.TrimLeft(rest[3:], asciiWhitespace)
+		if strings.HasPrefix(afterURL, "=") {
+			rest = strings.TrimLeft(afterURL[1:], asciiWhitespace)
+		}
+	}
+	if rest == "" {
+		return delay, "", true
+	}
+	if quote := rest[0]; quote == '"' || quote == '\'' {
+		rest = rest[1:]
+		if end := strings.IndexByte(rest, quote); end >= 0 {
+			rest = rest[:end]
+		}
+	}
+
+	return delay, strings.TrimSpace(rest), true
+}
+
+// pageRefresh returns the refresh the page asks for. The Refresh header is
+// processed before the document's <meta> tags, so it takes precedence.
+func pageRefresh(resp *Response, doc Document) (string, bool) {
+	if value := resp.Header.Get("Refresh"); value != "" {
+		return value, true
+	}
+	for name, content := range doc.GetMetadata() {
+		if strings.EqualFold(name, "http-equiv-refresh") {
+			return content, true
+		}
+	}
+	return "", false
+}
+
+// newRefresh works out the refresh the page asks for, or returns nil when
+// it asks for none or auto-refresh is disabled.
+func (e *engine) newRefresh(resp *Response, doc Document) *scheduledRefresh {
+	value, ok := pageRefresh(resp, doc)
+	if !ok {
+		return nil
+	}
+	delay, target, ok := parseRefresh(value)
+	if !ok {
+		return nil
+	}
+	if !e.autoRefresh {
+		if e.GetDebugMode() {
+			log.Printf("Auto-refresh is disabled, not refreshing %s", resp.URL)
+		}
+		return nil
+	}
+
+	refreshURL := resp.URL
+	if target != "" {
+		resolved, err := e.urlHandler.Resolve(resp.URL, target)
+		if err != nil {
+			return nil
+		}
+		refreshURL = resolved
+	}
+	reload := refreshURL == resp.URL
+	// A page reloading itself straight away would do so in a tight loop
+	if reload && delay < MinReloadRefreshDelay {
+		delay = MinReloadRefreshDelay
+	}
+
+	return &scheduledRefresh{
+		Refresh:        Refresh{URL: refreshURL, Reload: reload, At: time.Now().Add(delay)},
+		pageURL:        resp.URL,
+		referrerPolicy: doc.GetReferrerPolicy(),
+	}
+}
+
+// scheduleRefresh arms the timer of a refresh for the page just committed
+// to the tab. It is called with navigationMutex held.
+func (e *engine) scheduleRefresh(tab Tab, scheduled *scheduledRefresh) {
+	e.cancelRefreshLocked(tab)
+	if scheduled == nil {
+		return
+	}
+	scheduled.timer = time.AfterFunc(time.Until(scheduled.At), func() { e.runRefresh(tab, scheduled) })
+	e.refreshes[tab.GetID()] = scheduled
+}
+
+// runRefresh carries out a refresh whose timer fired, unless it was
+// cancelled or the tab has gone back or forward to another page since.
+func (e *engine) runRefresh(tab Tab, scheduled *scheduledRefresh) {
+	e.navigationMutex.Lock()
+	current := e.refreshes[tab.GetID()] == scheduled
+	if current {
+		delete(e.refreshes, tab.GetID())
+	}
+	e.navigationMutex.Unlock()
+
+	if !current || tab.GetURL() != scheduled.pageURL {
+		return
+	}
+	tabIdx := e.tabIndex(tab)
+	if tabIdx < 0 {
+		return
+	}
+
+	var err error
+	if scheduled.Reload {
+		err = e.RefreshTab(tabIdx, ReloadNormal)
+	} else {
+		err = e.navigate(context.Background(), tabIdx, &FetchRequest{
+			URL:            scheduled.URL,
+			Referrer:       scheduled.pageURL,
+			ReferrerPolicy: scheduled.referrerPolicy,
+		})
+	}
+	if err != nil && e.GetDebugMode() {
+		log.Printf("Failed to refresh %s: %v", scheduled.pageURL, err)
+	}
+}
+
+func (e *engine) GetPendingRefresh(tabIdx int) *Refresh {
+	tab := e.GetTab(tabIdx)
+	if tab == nil {
+		return nil
+	}
+
+	e.navigationMutex.Lock()
+	defer e.navigationMutex.Unlock()
+
+	scheduled, ok := e.refreshes[tab.GetID()]
+	if !ok || tab.GetURL() != scheduled.pageURL {
+		return nil
+	}
+	refresh := scheduled.Refresh
+	return &refresh
+}
+
+func (e *engine) CancelRefresh(tabIdx int) {
+	tab := e.GetTab(tabIdx)
+	if tab == nil {
+		return
+	}
+
+	e.navigationMutex.Lock()
+	defer e.navigationMutex.Unlock()
+
+	e.cancelRefreshLocked(tab)
+}
+
+func (e *engine) cancelRefreshLocked(tab Tab) {
+	if scheduled, ok := e.refreshes[tab.GetID()]; ok {
+		scheduled.timer.Stop()
+		delete(e.refreshes, tab.GetID())
+	}
+}
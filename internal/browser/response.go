@@ -0,0 +1,138 @@
+package browser
+
+import (
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"strings"
+)
+
+// Response is the result of fetching a resource through the APIHandler.
+type Response struct {
+	// URL is where the resource was actually served from, after redirects.
+	URL string
+	// RequestURL is the URL originally asked for.
+	RequestURL  string
+	StatusCode  int
+	Status      string
+	Header      http.Header
+	ContentType string
+	// Charset is the charset declared by the Content-Type header, if any.
+	Charset string
+	// Encoding is the detected character encoding of Body for text responses.
+	Encoding string
+	Body     []byte
+	// FromCache is set when the body was served from the HTTP cache.
+	FromCache bool
+	// Method is the method of the request that was answered, which a
+	// redirect may have changed from POST to GET. It is empty for responses
+	// that did not come from the network.
+	Method string
+	// Security describes the TLS connection for https responses.
+	Security *SecurityInfo
+
+	// stream is the unread body of a download fetched as a document, left
+	// open for the DownloadManager to save. Whoever drops the response
+	// instead must close it.
+	stream io.ReadCloser
+}
+
+// NewResponse builds a Response and derives its media type and charset from
+// the Content-Type header, sniffing the body when the header is absent.
+func NewResponse(requestURL, finalURL string, statusCode int, header http.Header, body []byte) *Response {
+	if header == nil {
+		header = make(http.Header)
+	}
+	if finalURL == "" {
+		finalURL = requestURL
+	}
+
+	resp := &Response{
+		URL:        finalURL,
+		RequestURL: requestURL,
+		StatusCode: statusCode,
+		Status:     fmt.Sprintf("%d %s", statusCode, http.StatusText(statusCode)),
+		Header:     header,
+		Body:       body,
+	}
+
+	resp.ContentType, resp.Charset = parseContentType(header.Get("Content-Type"))
+	// Only the media type is taken from a sniffed type; the charset it
+	// reports is a guess and left to detection
+	if resp.ContentType == "" && len(body) > 0 {
+		resp.ContentType, _ = parseContentType(http.DetectContentType(body))
+	}
+
+	if resp.IsHTML() || resp.IsText() {
+		resp.Encoding = NewCharsetDecoder().DetectCharset(body, resp.Charset, resp.IsHTML())
+	}
+
+	return resp
+}
+
+func parseContentType(contentType string) (string, string) {
+	if contentType == "" {
+		return "", ""
+	}
+
+	mediaType, params, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		mediaType, _, _ = strings.Cut(contentType, ";")
+		return strings.ToLower(strings.TrimSpace(mediaType)), ""
+	}
+
+	return strings.ToLower(mediaType), strings.ToLower(params["charset"])
+}
+
+// Text returns the body transcoded from its detected encoding to UTF-8.
+func (r *Response) Text() string {
+	if r.Encoding == "" {
+		return string(r.Body)
+	}
+
+	text, err := NewCharsetDecoder().DecodeToUTF8(r.Body, r.Encoding)
+	if err != nil {
+		return string(r.Body)
+	}
+	return text
+}
+
+func (r *Response) IsHTML() bool {
+	return r.ContentType == "text/html" || r.ContentType == "application/xhtml+xml"
+}
+
+func (r *Response) IsImage() bool {
+	return strings.HasPrefix(r.ContentType, "image/")
+}
+
+func (r *Response) IsCSS() bool {
+	return r.ContentType == "text/css"
+}
+
+// IsText reports whether the body is human-readable text that can be shown
+// as-is when it is not HTML.
+func (r *Response) IsText() bool {
+	if strings.HasPrefix(r.ContentType, "text/") {
+		return true
+	}
+
+	switch r.ContentType {
+	case "application/json", "application/javascript", "application/xml",
+		"application/ecmascript", "application/x-javascript":
+		return true
+	}
+
+	return strings.HasSuffix(r.ContentType, "+json") || strings.HasSuffix(r.ContentType, "+xml")
+}
+
+// IsDownload reports whether the response should be saved to disk rather
+// than displayed.
+func (r *Response) IsDownload() bool {
+	return r.IsSuccess() && isDownloadResponse(r.Header)
+}
+
+// IsSuccess reports whether the status code is in the 2xx range.
+func (r *Response) IsSuccess() bool {
+	return r.StatusCode >= 200 && r.StatusCode < 300
+}
@@ -0,0 +1,180 @@
+package browser
+
+import (
+	"context"
+	"errors"
+	"io"
+	"math/rand"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// RetryPolicy controls how often idempotent requests are retried after
+// transient failures: timeouts, dropped connections and 429, 502, 503 or 504
+// responses.
+type RetryPolicy struct {
+	// MaxAttempts counts the first try; 1 disables retrying.
+	MaxAttempts int
+	// BaseDelay is the backoff before the first retry. It doubles for each
+	// later retry, up to MaxDelay, and is randomised to spread retries out.
+	BaseDelay time.Duration
+	MaxDelay  time.Duration
+	// MaxRetryAfter is the longest Retry-After wait that is honoured; a
+	// response asking for longer is returned as it is.
+	MaxRetryAfter time.Duration
+}
+
+func DefaultRetryPolicy() RetryPolicy {
+	return RetryPolicy{
+		MaxAttempts:   DefaultRetryAttempts,
+		BaseDelay:     RetryBaseDelay,
+		MaxDelay:      RetryMaxDelay,
+		MaxRetryAfter: MaxRetryAfterDelay,
+	}
+}
+
+// backoff returns the delay before retry number retry (starting at 1): half
+// the capped exponential delay plus a random share of the other half.
+func (p RetryPolicy) backoff(retry int) time.Duration {
+	delay := p.BaseDelay
+	for i := 1; i < retry && delay < p.MaxDelay; i++ {
+		delay *= 2
+	}
+	if p.MaxDelay > 0 && delay > p.MaxDelay {
+		delay = p.MaxDelay
+	}
+	if delay <= 0 {
+		return 0
+	}
+
+	half := delay / 2
+	return half + time.Duration(rand.Int63n(int64(delay-half)+1))
+}
+
+// attemptsFor returns how many times req may be tried. Only requests that
+// are safe to repeat are retried.
+func (p RetryPolicy) attemptsFor(req *http.Request) int {
+	if req.Method != http.MethodGet && req.Method != http.MethodHead {
+		return 1
+	}
+	if p.MaxAttempts < 1 {
+		return 1
+	}
+	return p.MaxAttempts
+}
+
+// doWithRetry sends req through client, retrying transient failures as the
+// handler's retry policy allows. fetchReq.OnRetry is told about each retry
+// before it starts. slot, if any, is given up while waiting to retry.
+func (ah *apiHandler) doWithRetry(ctx context.Context, client *http.Client, fetchReq *FetchRequest, req *http.Request, slot *schedulerSlot) (*http.Response, error) {
+	policy := ah.retryPolicy
+	attempts := policy.attemptsFor(req)
+
+	for attempt := 1; ; attempt++ {
+		resp, err := client.Do(req)
+		if attempt >= attempts {
+			return resp, err
+		}
+
+		var delay time.Duration
+		switch {
+		case err != nil:
+			if !isRetryableError(err) {
+				return nil, err
+			}
+			delay = policy.backoff(attempt)
+		case isRetryableStatus(resp.StatusCode):
+			delay = policy.backoff(attempt)
+			if resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode == http.StatusServiceUnavailable {
+				if after, ok := parseRetryAfter(resp.Header.Get("Retry-After"), time.Now()); ok {
+					if after > policy.MaxRetryAfter {
+						return resp, nil
+					}
+					delay = after
+				}
+			}
+			// Drain the body so the connection can be reused for the retry
+			io.Copy(io.Discard, io.LimitReader(resp.Body, MaxRetryDrainSize))
+			resp.Body.Close()
+		default:
+			return resp, nil
+		}
+
+		if fetchReq.OnRetry != nil {
+			fetchReq.OnRetry(attempt+1, attempts)
+		}
+
+		slot.Release()
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, ctx.Err()
+		case <-timer.C:
+		}
+		if err := slot.Acquire(ctx); err != nil {
+			return nil, err
+		}
+
+		// The request's own context also carries its referrer for redirects
+		req = req.Clone(req.Context())
+	}
+}
+
+func isRetryableStatus(statusCode int) bool {
+	switch statusCode {
+	case http.StatusTooManyRequests, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	default:
+		return false
+	}
+}
+
+// isRetryableError reports whether err is a timeout or a connection failure
+// that may not happen again. Cancellation and unknown hosts are final.
+func isRetryableError(err error) bool {
+	if errors.Is(err, context.Canceled) {
+		return false
+	}
+
+	var dnsErr *net.DNSError
+	if errors.As(err, &dnsErr) {
+		return dnsErr.IsTimeout || dnsErr.IsTemporary
+	}
+
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return true
+	}
+
+	return errors.Is(err, syscall.ECONNRESET) || errors.Is(err, syscall.ECONNREFUSED) ||
+		errors.Is(err, syscall.ECONNABORTED) || errors.Is(err, io.ErrUnexpectedEOF) || errors.Is(err, io.EOF)
+}
+
+// parseRetryAfter reads a Retry-After value given either in seconds or as an
+// HTTP date.
+func parseRetryAfter(value string, now time.Time) (time.Duration, bool) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return 0, false
+	}
+
+	if seconds, err := strconv.Atoi(value); err == nil {
+		if seconds < 0 {
+			return 0, false
+		}
+		return time.Duration(seconds) * time.Second, true
+	}
+
+	if date, err := http.ParseTime(value); err == nil {
+		if delay := date.Sub(now); delay > 0 {
+			return delay, true
+		}
+		return 0, true
+	}
+	return 0, false
+}
@@ -0,0 +1,261 @@
+package browser
+
+import (
+	"context"
+	"sync"
+)
+
+// RequestPriority orders queued requests; higher priorities start first.
+type RequestPriority int
+
+const (
+	PriorityPrefetch RequestPriority = iota
+	PriorityImage
+	PriorityStylesheet
+	PriorityDocument
+)
+
+// priorityFor maps a request type to its scheduling priority. Stylesheets
+// block rendering, so they come straight after the main document.
+func priorityFor(t RequestType) RequestPriority {
+	switch t {
+	case RequestTypeDocument:
+		return PriorityDocument
+	case RequestTypeStylesheet:
+		return PriorityStylesheet
+	case RequestTypeImage:
+		return PriorityImage
+	case RequestTypePrefetch:
+		return PriorityPrefetch
+	default:
+		return PriorityImage
+	}
+}
+
+// Scheduler limits how many HTTP requests run at once, overall and per host,
+// and decides which queued request starts next.
+type Scheduler interface {
+	// Acquire waits for a connection slot for req. The returned release must
+	// be called once the request is done.
+	Acquire(ctx context.Context, req *FetchRequest) (release func(), err error)
+	// SetActiveTab makes requests of tabID start before other tabs' requests.
+	SetActiveTab(tabID string)
+	// CancelTab drops every queued request of tabID.
+	CancelTab(tabID string)
+	QueueLength() int
+}
+
+// schedulerSlot is the slot a request holds while it is sent and its
+// response read. It is handed back while the request waits to be retried,
+// so other requests can run in the meantime.
+type schedulerSlot struct {
+	scheduler Scheduler
+	req       *FetchRequest
+	release   func()
+}
+
+func acquireSlot(ctx context.Context, scheduler Scheduler, req *FetchRequest) (*schedulerSlot, error) {
+	slot := &schedulerSlot{scheduler: scheduler, req: req}
+	if err := slot.Acquire(ctx); err != nil {
+		return nil, err
+	}
+	return slot, nil
+}
+
+// Acquire waits for a slot again after Release. A nil slot, that of a
+// request not subject to scheduling, needs none.
+func (s *schedulerSlot) Acquire(ctx context.Context) error {
+	if s == nil || s.release != nil {
+		return nil
+	}
+	release, err := s.scheduler.Acquire(ctx, s.req)
+	if err != nil {
+		return err
+	}
+	s.release = release
+	return nil
+}
+
+func (s *schedulerSlot) Release() {
+	if s == nil || s.release == nil {
+		return
+	}
+	s.release()
+	s.release = nil
+}
+
+// schedulerWaiter is a request waiting for a slot. ready is closed when it
+// is granted one or dropped; err is set in the latter case.
+type schedulerWaiter struct {
+	host     string
+	tabID    string
+	priority RequestPriority
+	seq      uint64
+	ready    chan struct{}
+	err      error
+}
+
+type scheduler struct {
+	maxTotal   int
+	maxPerHost int
+
+	running   int
+	perHost   map[string]int
+	queue     []*schedulerWaiter
+	activeTab string
+	nextSeq   uint64
+	mutex     sync.Mutex
+}
+
+// NewScheduler returns a scheduler running at most maxTotal requests, and at
+// most maxPerHost to any one host, at a time.
+func NewScheduler(maxTotal, maxPerHost int) Scheduler {
+	if maxTotal < 1 {
+		maxTotal = 1
+	}
+	if maxPerHost < 1 || maxPerHost > maxTotal {
+		maxPerHost = maxTotal
+	}
+
+	return &scheduler{
+		maxTotal:   maxTotal,
+		maxPerHost: maxPerHost,
+		perHost:    make(map[string]int),
+	}
+}
+
+func (s *scheduler) Acquire(ctx context.Context, req *FetchRequest) (func(), error) {
+	waiter := &schedulerWaiter{
+		host:     hostOf(req.URL),
+		tabID:    req.TabID,
+		priority: priorityFor(req.Type),
+		ready:    make(chan struct{}),
+	}
+
+	s.mutex.Lock()
+	waiter.seq = s.nextSeq
+	s.nextSeq++
+	s.queue = append(s.queue, waiter)
+	s.dispatchLocked()
+	s.mutex.Unlock()
+
+	select {
+	case <-waiter.ready:
+	case <-ctx.Done():
+		s.mutex.Lock()
+		if s.removeLocked(waiter) {
+			s.mutex.Unlock()
+			return nil, NewBrowserErrorWithContext(ErrRequestCancelled, "request cancelled while queued", req.URL)
+		}
+		s.mutex.Unlock()
+		// The slot was granted or the request dropped at the same moment
+		<-waiter.ready
+		if waiter.err == nil {
+			s.release(waiter)
+		}
+		return nil, NewBrowserErrorWithContext(ErrRequestCancelled, "request cancelled while queued", req.URL)
+	}
+
+	if waiter.err != nil {
+		return nil, waiter.err
+	}
+
+	var once sync.Once
+	return func() { once.Do(func() { s.release(waiter) }) }, nil
+}
+
+func (s *scheduler) release(waiter *schedulerWaiter) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.running--
+	if s.perHost[waiter.host]--; s.perHost[waiter.host] <= 0 {
+		delete(s.perHost, waiter.host)
+	}
+	s.dispatchLocked()
+}
+
+// dispatchLocked starts queued requests, best first, while there are free
+// slots. Requests to a host at its limit wait without holding up others.
+func (s *scheduler) dispatchLocked() {
+	for s.running < s.maxTotal {
+		best := -1
+		for i, waiter := range s.queue {
+			if s.perHost[waiter.host] >= s.maxPerHost {
+				continue
+			}
+			if best < 0 || s.before(waiter, s.queue[best]) {
+				best = i
+			}
+		}
+		if best < 0 {
+			return
+		}
+
+		waiter := s.queue[best]
+		s.queue = append(s.queue[:best], s.queue[best+1:]...)
+		s.running++
+		s.perHost[waiter.host]++
+		close(waiter.ready)
+	}
+}
+
+// before orders waiters: the active tab first, then by priority, then in
+// the order they were queued.
+func (s *scheduler) before(a, b *schedulerWaiter) bool {
+	aActive := s.activeTab != "" && a.tabID == s.activeTab
+	bActive := s.activeTab != "" && b.tabID == s.activeTab
+	if aActive != bActive {
+		return aActive
+	}
+	if a.priority != b.priority {
+		return a.priority > b.priority
+	}
+	return a.seq < b.seq
+}
+
+func (s *scheduler) removeLocked(target *schedulerWaiter) bool {
+	for i, waiter := range s.queue {
+		if waiter == target {
+			s.queue = append(s.queue[:i], s.queue[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+func (s *scheduler) SetActiveTab(tabID string) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.activeTab = tabID
+}
+
+func (s *scheduler) CancelTab(tabID string) {
+	if tabID == "" {
+		return
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	kept := s.queue[:0]
+	for _, waiter := range s.queue {
+		if waiter.tabID != tabID {
+			kept = append(kept, waiter)
+			continue
+		}
+		waiter.err = NewBrowserError(ErrRequestCancelled, "tab was closed")
+		close(waiter.ready)
+	}
+	// Clear the tail so dropped waiters can be collected
+	for i := len(kept); i < len(s.queue); i++ {
+		s.queue[i] = nil
+	}
+	s.queue = kept
+}
+
+func (s *scheduler) QueueLength() int {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return len(s.queue)
+}
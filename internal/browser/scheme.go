@@ -0,0 +1,96 @@
+package browser
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// SchemeHandler loads URLs of a scheme that is not fetched over HTTP, such
+// as file:, data: or about:.
+type SchemeHandler interface {
+	Load(ctx context.Context, req *FetchRequest) (*Response, error)
+}
+
+// SchemeHandlerFunc adapts an ordinary function to a SchemeHandler.
+type SchemeHandlerFunc func(ctx context.Context, req *FetchRequest) (*Response, error)
+
+func (f SchemeHandlerFunc) Load(ctx context.Context, req *FetchRequest) (*Response, error) {
+	return f(ctx, req)
+}
+
+type SchemeRegistry interface {
+	Register(scheme string, handler SchemeHandler)
+	Unregister(scheme string)
+	Lookup(scheme string) (SchemeHandler, bool)
+	IsRegistered(scheme string) bool
+	Schemes() []string
+}
+
+type schemeRegistry struct {
+	handlers map[string]SchemeHandler
+	mutex    sync.RWMutex
+}
+
+func NewSchemeRegistry() SchemeRegistry {
+	return &schemeRegistry{
+		handlers: make(map[string]SchemeHandler),
+	}
+}
+
+func (sr *schemeRegistry) Register(scheme string, handler SchemeHandler) {
+	sr.mutex.Lock()
+	defer sr.mutex.Unlock()
+	sr.handlers[strings.ToLower(scheme)] = handler
+}
+
+func (sr *schemeRegistry) Unregister(scheme string) {
+	sr.mutex.Lock()
+	defer sr.mutex.Unlock()
+	delete(sr.handlers, strings.ToLower(scheme))
+}
+
+func (sr *schemeRegistry) Lookup(scheme string) (SchemeHandler, bool) {
+	sr.mutex.RLock()
+	defer sr.mutex.RUnlock()
+
+	handler, ok := sr.handlers[strings.ToLower(scheme)]
+	return handler, ok
+}
+
+func (sr *schemeRegistry) IsRegistered(scheme string) bool {
+	_, ok := sr.Lookup(scheme)
+	return ok
+}
+
+func (sr *schemeRegistry) Schemes() []string {
+	sr.mutex.RLock()
+	defer sr.mutex.RUnlock()
+
+	schemes := make([]string, 0, len(sr.handlers))
+	for scheme := range sr.handlers {
+		schemes = append(schemes, scheme)
+	}
+	sort.Strings(schemes)
+	return schemes
+}
+
+// urlScheme returns the lower-cased scheme of rawURL, or "" when it has none.
+func urlScheme(rawURL string) string {
+	scheme, _, found := strings.Cut(rawURL, ":")
+	if !found || scheme == "" {
+		return ""
+	}
+
+	for i, r := range scheme {
+		isLetter := (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z')
+		if i == 0 && !isLetter {
+			return ""
+		}
+		if !isLetter && !(r >= '0' && r <= '9') && r != '+' && r != '-' && r != '.' {
+			return ""
+		}
+	}
+	return strings.ToLower(scheme)
+}
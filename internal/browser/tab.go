@@ -2,10 +2,13 @@ package browser
 
 import (
 	"strings"
+	"sync"
 )
 
 type page struct {
-	url  string
+	url string
+	// form is the POST submission that loaded the page, if any.
+	form *FormSubmission
 	prev *page
 	next *page
 }
@@ -19,18 +22,47 @@ type Tab interface {
 	GetDocument() Document
 	SetDocument(doc Document)
 	Navigate(url string)
+	// NavigateForm adds a history entry for a form POST, which is kept so
+	// reloading the entry can submit it again.
+	NavigateForm(submission *FormSubmission)
+	// GetFormSubmission returns the POST submission of the current history
+	// entry, or nil if it was loaded with a GET.
+	GetFormSubmission() *FormSubmission
+	// SetFormSubmission replaces the submission of the current entry, e.g.
+	// with nil once a redirect has turned the POST into a GET.
+	SetFormSubmission(submission *FormSubmission)
+	// AbandonNavigation drops the history entries added for a navigation to
+	// url that did not replace the page, such as one that became a download.
+	AbandonNavigation(url string)
 	CanGoBack() bool
 	GoBack()
 	CanGoNext() bool
 	GoNext()
+	IsLoading() bool
+	SetLoading(loading bool)
+	// GetLoadAttempt reports which attempt at fetching the page is running
+	// and how many there may be; attempt is 0 when not retrying.
+	GetLoadAttempt() (attempt, maxAttempts int)
+	SetLoadAttempt(attempt, maxAttempts int)
+	IsPrivate() bool
+	// GetSecurityInfo describes the TLS connection of the current page, or
+	// returns nil when it was not loaded over https.
+	GetSecurityInfo() *SecurityInfo
+	SetSecurityInfo(info *SecurityInfo)
+	GetCookieJar() CookieJar
 }
 
 type tab struct {
-	id       string
-	title    string
-	document Document
-	history  *page
-	loading  bool
+	id        string
+	title     string
+	document  Document
+	history   *page
+	loading   bool
+	attempt   int
+	attempts  int
+	cookieJar CookieJar
+	security  *SecurityInfo
+	mutex     sync.RWMutex
 }
 
 func NewTab() Tab {
@@ -42,11 +74,22 @@ func NewTab() Tab {
 	}
 }
 
+// NewPrivateTab returns a tab with its own in-memory cookie jar, which is
+// discarded when the tab is closed.
+func NewPrivateTab() Tab {
+	t := NewTab().(*tab)
+	t.cookieJar, _ = NewCookieJar("")
+	return t
+}
+
 func (t *tab) GetID() string {
 	return t.id
 }
 
 func (t *tab) GetTitle() string {
+	t.mutex.RLock()
+	defer t.mutex.RUnlock()
+
 	if t.title != "" {
 		return t.title
 	}
@@ -55,10 +98,71 @@ func (t *tab) GetTitle() string {
 }
 
 func (t *tab) SetTitle(title string) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
 	t.title = title
 }
 
+func (t *tab) IsLoading() bool {
+	t.mutex.RLock()
+	defer t.mutex.RUnlock()
+
+	return t.loading
+}
+
+// SetLoading also clears the retry attempt, which only describes the load
+// in progress.
+func (t *tab) SetLoading(loading bool) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	t.loading = loading
+	t.attempt, t.attempts = 0, 0
+}
+
+func (t *tab) GetLoadAttempt() (int, int) {
+	t.mutex.RLock()
+	defer t.mutex.RUnlock()
+
+	return t.attempt, t.attempts
+}
+
+func (t *tab) SetLoadAttempt(attempt, maxAttempts int) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	t.attempt, t.attempts = attempt, maxAttempts
+}
+
+func (t *tab) GetSecurityInfo() *SecurityInfo {
+	t.mutex.RLock()
+	defer t.mutex.RUnlock()
+
+	return t.security
+}
+
+func (t *tab) SetSecurityInfo(info *SecurityInfo) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	t.security = info
+}
+
+func (t *tab) IsPrivate() bool {
+	return t.cookieJar != nil
+}
+
+// GetCookieJar returns the tab's own jar, or nil when the tab uses the
+// engine's shared jar.
+func (t *tab) GetCookieJar() CookieJar {
+	return t.cookieJar
+}
+
 func (t *tab) GetURL() string {
+	t.mutex.RLock()
+	defer t.mutex.RUnlock()
+
 	if t.history == nil {
 		return ""
 	}
@@ -66,6 +170,9 @@ func (t *tab) GetURL() string {
 }
 
 func (t *tab) SetURL(url string) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
 	if t.history == nil {
 		t.history = &page{url: url}
 		return
@@ -74,10 +181,16 @@ func (t *tab) SetURL(url string) {
 }
 
 func (t *tab) GetDocument() Document {
+	t.mutex.RLock()
+	defer t.mutex.RUnlock()
+
 	return t.document
 }
 
 func (t *tab) SetDocument(doc Document) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
 	t.document = doc
 	if doc != nil && doc.GetTitle() != "" {
 		t.title = doc.GetTitle()
@@ -85,6 +198,9 @@ func (t *tab) SetDocument(doc Document) {
 }
 
 func (t *tab) Navigate(url string) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
 	if strings.TrimSpace(url) == "" {
 		return
 	}
@@ -92,12 +208,61 @@ func (t *tab) Navigate(url string) {
 	t.loading = true
 }
 
+func (t *tab) NavigateForm(submission *FormSubmission) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	if submission == nil || strings.TrimSpace(submission.URL) == "" {
+		return
+	}
+	t.addToHistory(submission.URL)
+	t.history.form = submission
+	t.loading = true
+}
+
+func (t *tab) GetFormSubmission() *FormSubmission {
+	t.mutex.RLock()
+	defer t.mutex.RUnlock()
+
+	if t.history == nil {
+		return nil
+	}
+	return t.history.form
+}
+
+func (t *tab) SetFormSubmission(submission *FormSubmission) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	if t.history != nil {
+		t.history.form = submission
+	}
+}
+
+func (t *tab) AbandonNavigation(url string) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	for t.history != nil && t.history.url == url {
+		t.history = t.history.prev
+		if t.history != nil {
+			t.history.next = nil
+		}
+	}
+}
+
 func (t *tab) CanGoBack() bool {
+	t.mutex.RLock()
+	defer t.mutex.RUnlock()
+
 	return t.history != nil && t.history.prev != nil
 }
 
 func (t *tab) GoBack() {
-	if !t.CanGoBack() {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	if t.history == nil || t.history.prev == nil {
 		return
 	}
 
@@ -105,11 +270,17 @@ func (t *tab) GoBack() {
 }
 
 func (t *tab) CanGoNext() bool {
+	t.mutex.RLock()
+	defer t.mutex.RUnlock()
+
 	return t.history != nil && t.history.next != nil
 }
 
 func (t *tab) GoNext() {
-	if !t.CanGoNext() {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	if t.history == nil || t.history.next == nil {
 		return
 	}
 
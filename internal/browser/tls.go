@@ -0,0 +1,212 @@
+package browser
+
+import (
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
+	"net/http"
+	"os"
+	"path"
+	"strings"
+	"time"
+)
+
+// TLSSettings adds trust and client authentication on top of the system
+// defaults.
+type TLSSettings struct {
+	// CAFiles are PEM bundles trusted in addition to the system roots.
+	CAFiles []string
+	// ClientCertificates are offered to servers that ask for one.
+	ClientCertificates []ClientCertificate
+	// ExceptionHosts are host globs, such as "*.staging.internal", whose
+	// certificates are accepted without verification. They are applied with
+	// WithCertificateExceptions.
+	ExceptionHosts []string
+}
+
+// ClientCertificate is a PEM certificate and its private key.
+type ClientCertificate struct {
+	CertFile string
+	KeyFile  string
+}
+
+// ClientConfig builds the tls.Config for the APIHandler's transport.
+func (s *TLSSettings) ClientConfig() (*tls.Config, error) {
+	roots, err := x509.SystemCertPool()
+	if err != nil || roots == nil {
+		roots = x509.NewCertPool()
+	}
+
+	for _, caFile := range s.CAFiles {
+		data, err := os.ReadFile(caFile)
+		if err != nil {
+			return nil, NewBrowserErrorWithContext(ErrFileNotFound, "cannot read CA bundle: "+err.Error(), caFile)
+		}
+		if !roots.AppendCertsFromPEM(data) {
+			return nil, NewBrowserErrorWithContext(ErrParsingFailed, "no PEM certificates found", caFile)
+		}
+	}
+
+	config := &tls.Config{
+		RootCAs:    roots,
+		MinVersion: tls.VersionTLS12,
+	}
+
+	for _, clientCert := range s.ClientCertificates {
+		cert, err := tls.LoadX509KeyPair(clientCert.CertFile, clientCert.KeyFile)
+		if err != nil {
+			return nil, NewBrowserErrorWithContext(ErrParsingFailed, "invalid client certificate: "+err.Error(), clientCert.CertFile)
+		}
+		config.Certificates = append(config.Certificates, cert)
+	}
+
+	for _, pattern := range s.ExceptionHosts {
+		if _, err := path.Match(strings.ToLower(pattern), ""); err != nil {
+			return nil, NewBrowserErrorWithContext(ErrInvalidInput, "invalid certificate exception pattern", pattern)
+		}
+	}
+
+	return config, nil
+}
+
+// certificateExceptionTransport sends https requests for the excepted hosts
+// through a transport that skips certificate verification. A tls.Config
+// verifies either every host or none, and it does not see the host for IP
+// addresses, so the choice is made per request instead. Known HSTS hosts are
+// always verified, as their certificate errors cannot be bypassed (RFC 6797
+// section 12.1).
+type certificateExceptionTransport struct {
+	verified http.RoundTripper
+	excepted http.RoundTripper
+	patterns []string
+	hsts     HSTSStore
+}
+
+func newCertificateExceptionTransport(transport *http.Transport, patterns []string, hsts HSTSStore) http.RoundTripper {
+	excepted := transport.Clone()
+	if excepted.TLSClientConfig == nil {
+		excepted.TLSClientConfig = &tls.Config{}
+	}
+	excepted.TLSClientConfig.InsecureSkipVerify = true
+
+	lowered := make([]string, 0, len(patterns))
+	for _, pattern := range patterns {
+		lowered = append(lowered, strings.ToLower(strings.TrimSpace(pattern)))
+	}
+
+	return &certificateExceptionTransport{
+		verified: transport,
+		excepted: excepted,
+		patterns: lowered,
+		hsts:     hsts,
+	}
+}
+
+func (t *certificateExceptionTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	host := req.URL.Hostname()
+	if req.URL.Scheme == "https" && matchesHostPattern(host, t.patterns) && (t.hsts == nil || !t.hsts.IsKnownHost(host)) {
+		return t.excepted.RoundTrip(req)
+	}
+	return t.verified.RoundTrip(req)
+}
+
+func matchesHostPattern(host string, patterns []string) bool {
+	host = strings.ToLower(host)
+	for _, pattern := range patterns {
+		if matched, _ := path.Match(pattern, host); matched {
+			return true
+		}
+	}
+	return false
+}
+
+// verifyCertificateChain verifies the server's certificates for host against
+// roots, or the system roots when roots is nil, and returns the verified
+// chain.
+func verifyCertificateChain(state *tls.ConnectionState, host string, roots *x509.CertPool) ([]*x509.Certificate, error) {
+	if len(state.PeerCertificates) == 0 {
+		return nil, NewBrowserError(ErrAccessDenied, "server sent no certificate")
+	}
+
+	intermediates := x509.NewCertPool()
+	for _, cert := range state.PeerCertificates[1:] {
+		intermediates.AddCert(cert)
+	}
+
+	chains, err := state.PeerCertificates[0].Verify(x509.VerifyOptions{
+		DNSName:       host,
+		Roots:         roots,
+		Intermediates: intermediates,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return chains[0], nil
+}
+
+// SecurityInfo describes the TLS connection a response arrived over.
+type SecurityInfo struct {
+	Protocol    string `json:"protocol"`
+	CipherSuite string `json:"cipher_suite"`
+	// Chain runs from the server's certificate to the root. For a host with
+	// a certificate exception it is the chain the server sent.
+	Chain []CertificateInfo `json:"chain"`
+	// Verified is false when the certificate was only accepted through a
+	// certificate exception.
+	Verified bool `json:"verified"`
+}
+
+type CertificateInfo struct {
+	Subject           string    `json:"subject"`
+	Issuer            string    `json:"issuer"`
+	SerialNumber      string    `json:"serial_number"`
+	NotBefore         time.Time `json:"not_before"`
+	NotAfter          time.Time `json:"not_after"`
+	DNSNames          []string  `json:"dns_names,omitempty"`
+	IPAddresses       []string  `json:"ip_addresses,omitempty"`
+	SHA256Fingerprint string    `json:"sha256_fingerprint"`
+}
+
+// newSecurityInfo describes the connection to host, verifying the chain
+// again against roots to tell verified connections from excepted ones.
+func newSecurityInfo(state *tls.ConnectionState, host string, roots *x509.CertPool) *SecurityInfo {
+	if state == nil {
+		return nil
+	}
+
+	info := &SecurityInfo{
+		Protocol:    tls.VersionName(state.Version),
+		CipherSuite: tls.CipherSuiteName(state.CipherSuite),
+	}
+
+	chain := state.PeerCertificates
+	if len(state.VerifiedChains) > 0 {
+		chain, info.Verified = state.VerifiedChains[0], true
+	} else if verified, err := verifyCertificateChain(state, host, roots); err == nil {
+		chain, info.Verified = verified, true
+	}
+
+	for _, cert := range chain {
+		info.Chain = append(info.Chain, newCertificateInfo(cert))
+	}
+	return info
+}
+
+func newCertificateInfo(cert *x509.Certificate) CertificateInfo {
+	fingerprint := sha256.Sum256(cert.Raw)
+
+	info := CertificateInfo{
+		Subject:           cert.Subject.String(),
+		Issuer:            cert.Issuer.String(),
+		SerialNumber:      cert.SerialNumber.String(),
+		NotBefore:         cert.NotBefore,
+		NotAfter:          cert.NotAfter,
+		DNSNames:          cert.DNSNames,
+		SHA256Fingerprint: strings.ToUpper(hex.EncodeToString(fingerprint[:])),
+	}
+	for _, ip := range cert.IPAddresses {
+		info.IPAddresses = append(info.IPAddresses, ip.String())
+	}
+	return info
+}
@@ -276,13 +276,16 @@ func (t *tokenizer) parseCommentOrDoctype() (*Token, error) {
 }
 
 func (t *tokenizer) parseComment() (*Token, error) {
-	t.pos += 2 // Skip "--"
+	// Skip "--" with advance so the current rune stays in sync with pos
+	t.advance()
+	t.advance()
 	start := t.pos
 
 	for t.pos+1 < t.len {
 		if t.content[t.pos:t.pos+2] == "--" {
 			content := t.content[start:t.pos]
-			t.pos += 2
+			t.advance()
+			t.advance()
 			t.skipToChar('>')
 			if t.HasMore() {
 				t.advance()
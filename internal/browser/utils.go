@@ -1,9 +1,12 @@
 package browser
 
 import (
+	"bytes"
 	"compress/gzip"
 	"context"
 	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
 	"fmt"
 	"io"
 	"net/http"
@@ -42,6 +45,7 @@ type URLHandler interface {
 
 type urlHandler struct {
 	supportedSchemes map[string]bool
+	schemes          SchemeRegistry
 }
 
 func NewURLHandler() URLHandler {
@@ -55,30 +59,44 @@ func NewURLHandler() URLHandler {
 	}
 }
 
+// NewURLHandlerWithSchemes returns a URLHandler that accepts http, https and
+// every scheme registered in schemes, including ones registered later.
+func NewURLHandlerWithSchemes(schemes SchemeRegistry) URLHandler {
+	return &urlHandler{
+		supportedSchemes: map[string]bool{
+			"http":  true,
+			"https": true,
+		},
+		schemes: schemes,
+	}
+}
+
 func (h *urlHandler) Normalize(rawURL string) (string, error) {
 	if rawURL == "" {
-		return "", ErrInvalidURL
+		return "", NewBrowserError(ErrInvalidURL, "empty URL")
 	}
 
 	rawURL = strings.TrimSpace(rawURL)
 
-	if strings.HasPrefix(rawURL, "data:") || strings.HasPrefix(rawURL, "file:") {
-		return rawURL, nil
+	// Schemes served by a SchemeHandler own their URL syntax, so they are
+	// passed through with only the scheme lower-cased
+	if scheme := urlScheme(rawURL); scheme != "" && scheme != "http" && scheme != "https" && h.IsValidScheme(scheme) {
+		return scheme + rawURL[len(scheme):], nil
 	}
 
 	if strings.Contains(rawURL, "://") {
 		parsed, err := url.Parse(rawURL)
 		if err != nil {
-			return "", fmt.Errorf("%s: %w", ErrInvalidURL, err)
+			return "", NewBrowserErrorWithContext(ErrInvalidURL, err.Error(), rawURL)
 		}
 
 		// Validate scheme
 		if !h.IsValidScheme(parsed.Scheme) {
-			return "", fmt.Errorf("%s: unsupported scheme '%s'", ErrInvalidURL, parsed.Scheme)
+			return "", NewBrowserErrorWithContext(ErrInvalidURL, fmt.Sprintf("unsupported scheme '%s'", parsed.Scheme), rawURL)
 		}
 
 		if parsed.Host == "" {
-			return "", fmt.Errorf("%s: missing host", ErrInvalidURL)
+			return "", NewBrowserErrorWithContext(ErrInvalidURL, "missing host", rawURL)
 		}
 
 		normalized := parsed.String()
@@ -91,7 +109,7 @@ func (h *urlHandler) Normalize(rawURL string) (string, error) {
 		return normalized, nil
 	}
 
-	return "", fmt.Errorf("%s: relative URL '%s' requires base URL for resolution", ErrInvalidURL, rawURL)
+	return "", NewBrowserError(ErrInvalidURL, fmt.Sprintf("relative URL '%s' requires base URL for resolution", rawURL))
 }
 
 func (h *urlHandler) Resolve(baseURL, relativeURL string) (string, error) {
@@ -113,6 +131,9 @@ func (h *urlHandler) Resolve(baseURL, relativeURL string) (string, error) {
 	if err != nil {
 		return "", err
 	}
+	if parsedBase.Opaque != "" {
+		return "", NewBrowserErrorWithContext(ErrInvalidURL, "cannot resolve a relative URL against "+parsedBase.Scheme+": URLs", relativeURL)
+	}
 
 	var resolvedURL string
 
@@ -149,11 +170,21 @@ func (h *urlHandler) Resolve(baseURL, relativeURL string) (string, error) {
 }
 
 func (h *urlHandler) IsValidScheme(scheme string) bool {
-	return h.supportedSchemes[scheme]
+	scheme = strings.ToLower(scheme)
+	if h.supportedSchemes[scheme] {
+		return true
+	}
+	return h.schemes != nil && h.schemes.IsRegistered(scheme)
 }
 
 func (h *urlHandler) IsAbsoluteURL(rawURL string) bool {
-	return strings.Contains(rawURL, "://")
+	if strings.Contains(rawURL, "://") {
+		return true
+	}
+
+	// Opaque URLs such as data: or about: have a scheme but no authority
+	scheme := urlScheme(rawURL)
+	return scheme != "" && h.IsValidScheme(scheme)
 }
 
 func (h *urlHandler) GetDomain(rawURL string) (string, error) {
@@ -357,96 +388,570 @@ func (tp *textProcessor) TrimAndNormalize(text string) string {
 	return strings.Join(normalized, " ")
 }
 
+// RequestType tells interceptors what a fetched resource will be used for.
+type RequestType int
+
+const (
+	RequestTypeOther RequestType = iota
+	RequestTypeDocument
+	RequestTypeStylesheet
+	RequestTypeImage
+	RequestTypePrefetch
+)
+
+func (rt RequestType) String() string {
+	switch rt {
+	case RequestTypeDocument:
+		return "document"
+	case RequestTypeStylesheet:
+		return "stylesheet"
+	case RequestTypeImage:
+		return "image"
+	case RequestTypePrefetch:
+		return "prefetch"
+	default:
+		return "other"
+	}
+}
+
+// FetchRequest describes a single fetch made through the APIHandler.
+type FetchRequest struct {
+	URL       string
+	Type      RequestType
+	CacheMode CacheMode
+	// Method is the HTTP method; empty means GET. Only GET responses are
+	// cached.
+	Method string
+	// Body is sent with the request, e.g. the data of a form POST.
+	Body []byte
+	// Header holds extra request headers, overriding the defaults.
+	Header http.Header
+	// CookieJar overrides the handler's jar, e.g. for a private tab.
+	CookieJar CookieJar
+	// FirstPartyURL is the URL of the document that made the request. It is
+	// empty for top-level navigations.
+	FirstPartyURL string
+	// Referrer is the URL of the document the request is made from, such as
+	// the page a followed link was on, and ReferrerPolicy limits how much of
+	// it the Referer header reveals. An empty Referrer sends no Referer.
+	Referrer       string
+	ReferrerPolicy ReferrerPolicy
+	// TabID identifies the tab the request was made for, if any.
+	TabID string
+	// OnRetry is called before each retry of a failed attempt with the
+	// number of the attempt about to start and the most there will be.
+	OnRetry func(attempt, maxAttempts int)
+}
+
 type APIHandler interface {
-	FetchContent(ctx context.Context, normalizedURL string) (string, error)
+	Fetch(ctx context.Context, req *FetchRequest) (*Response, error)
+	FetchContent(ctx context.Context, normalizedURL string) (*Response, error)
+	GetCache() HTTPCache
+	GetCookieJar() CookieJar
+	GetSchemeRegistry() SchemeRegistry
+	GetScheduler() Scheduler
+	GetHSTSStore() HSTSStore
+	// GetHintQueue returns the queue that carries out pages' resource hints.
+	// Responses it preloads are used by the next matching request.
+	GetHintQueue() HintQueue
+	// Stream sends an http or https request and returns the response with
+	// its body unread, for the caller to close. It skips the cache, the
+	// interceptors and the scheduler; downloads use it to write large bodies
+	// straight to disk.
+	Stream(ctx context.Context, req *FetchRequest) (*http.Response, error)
+	// CancelAll aborts every request currently in flight.
+	CancelAll()
 }
 
 type apiHandler struct {
 	client         *http.Client
-	activeRequests map[string]context.CancelFunc
+	cache          HTTPCache
+	cookieJar      CookieJar
+	schemes        SchemeRegistry
+	harRecorder    HARRecorder
+	harReplay      *HAR
+	interceptors   []RequestInterceptor
+	proxy          func(*http.Request) (*url.URL, error)
+	retryPolicy    RetryPolicy
+	tlsConfig      *tls.Config
+	certExceptions []string
+	hsts           HSTSStore
+	fileLoader     FileLoader
+	dataURLLoader  DataURLLoader
+	activeRequests map[*FetchRequest]context.CancelFunc
 	requestMutex   sync.Mutex
-	fetchPool      chan struct{}
+	scheduler      Scheduler
+
+	hints       HintQueue
+	preloads    *preloadCache
+	connections *preconnector
 }
 
-func NewAPIHandler() APIHandler {
+func NewAPIHandler(opts ...APIHandlerOption) APIHandler {
 	transport := &http.Transport{
 		MaxIdleConns:        MaxConcurrentConnections,
 		MaxIdleConnsPerHost: 10,
 		IdleConnTimeout:     DefaultTimeout,
 		DisableCompression:  false,
 		ForceAttemptHTTP2:   true,
+		Proxy:               http.ProxyFromEnvironment,
 	}
+	// Streamed downloads have no overall timeout, so a server that never
+	// answers is given up on here
+	transport.ResponseHeaderTimeout = DefaultTimeout
 
 	client := &http.Client{
 		Timeout:   DefaultTimeout,
 		Transport: transport,
 		CheckRedirect: func(req *http.Request, via []*http.Request) error {
-			if len(via) >= 10 {
+			if len(via) >= MaxRedirects {
 				return fmt.Errorf("too many redirects")
 			}
+			applyRedirectReferrer(req)
 			return nil
 		},
 	}
 
-	return &apiHandler{
+	cookieJar, _ := NewCookieJar("")
+
+	ah := &apiHandler{
 		client:         client,
-		fetchPool:      make(chan struct{}, MaxConcurrentConnections),
-		activeRequests: make(map[string]context.CancelFunc),
+		cache:          NewHTTPCache(""),
+		cookieJar:      cookieJar,
+		schemes:        NewSchemeRegistry(),
+		fileLoader:     NewFileLoader(),
+		dataURLLoader:  NewDataURLLoader(),
+		scheduler:      NewScheduler(MaxConcurrentConnections, MaxConnectionsPerHost),
+		retryPolicy:    DefaultRetryPolicy(),
+		activeRequests: make(map[*FetchRequest]context.CancelFunc),
+		preloads:       newPreloadCache(),
+	}
+	ah.hints = newHintQueue(ah)
+
+	ah.schemes.Register("file", SchemeHandlerFunc(func(ctx context.Context, req *FetchRequest) (*Response, error) {
+		return ah.fileLoader.Load(req.URL)
+	}))
+	ah.schemes.Register("data", SchemeHandlerFunc(func(ctx context.Context, req *FetchRequest) (*Response, error) {
+		return ah.dataURLLoader.Load(req.URL)
+	}))
+
+	for _, opt := range opts {
+		opt(ah)
 	}
+
+	// A disk cache would serve responses from outside the archive
+	if ah.harReplay != nil && ah.cache != nil {
+		ah.cache = NewHTTPCache("")
+	}
+	if base, ok := ah.client.Transport.(*http.Transport); ok {
+		// A transport given to WithTransport may be shared, as
+		// http.DefaultTransport is, so the handler configures its own copy
+		transport := base.Clone()
+		ah.client.Transport = transport
+		if ah.proxy != nil {
+			transport.Proxy = ah.proxy
+		}
+		if ah.tlsConfig != nil {
+			transport.TLSClientConfig = ah.tlsConfig
+		}
+		// Replayed requests never dial, so there is nothing to preconnect
+		if ah.harReplay == nil {
+			ah.connections = newPreconnector(transport.DialContext)
+			transport.DialContext = ah.connections.DialContext
+		}
+		if len(ah.certExceptions) > 0 {
+			ah.client.Transport = newCertificateExceptionTransport(transport, ah.certExceptions, ah.hsts)
+		}
+	}
+	ah.client.Transport = ah.wrapTransport(ah.client.Transport)
+
+	return ah
 }
 
-func (ah *apiHandler) FetchContent(ctx context.Context, normalizedURL string) (string, error) {
-	if err := ah.acquireFetchSlot(ctx); err != nil {
-		return "", err
+// wrapTransport layers replay and recording over the base transport. The
+// recorder goes outermost so it also captures replayed exchanges.
+func (ah *apiHandler) wrapTransport(transport http.RoundTripper) http.RoundTripper {
+	if ah.harReplay != nil {
+		transport = NewHARReplayTransport(ah.harReplay)
+	}
+	if ah.hsts != nil {
+		transport = &hstsTransport{store: ah.hsts, transport: transport}
+	}
+	if ah.harRecorder != nil {
+		transport = ah.harRecorder.Wrap(transport)
+	}
+	return transport
+}
+
+func (ah *apiHandler) GetCache() HTTPCache {
+	return ah.cache
+}
+
+func (ah *apiHandler) GetCookieJar() CookieJar {
+	return ah.cookieJar
+}
+
+func (ah *apiHandler) GetSchemeRegistry() SchemeRegistry {
+	return ah.schemes
+}
+
+func (ah *apiHandler) GetScheduler() Scheduler {
+	return ah.scheduler
+}
+
+func (ah *apiHandler) GetHSTSStore() HSTSStore {
+	return ah.hsts
+}
+
+func (ah *apiHandler) GetHintQueue() HintQueue {
+	return ah.hints
+}
+
+func (ah *apiHandler) Stream(ctx context.Context, fetchReq *FetchRequest) (*http.Response, error) {
+	urlStr := fetchReq.URL
+	if ah.hsts != nil {
+		urlStr, _ = ah.hsts.Upgrade(urlStr)
+	}
+	if scheme := urlScheme(urlStr); scheme != "http" && scheme != "https" {
+		return nil, NewBrowserErrorWithContext(ErrUnsupportedContent, "cannot stream "+scheme+" URLs", urlStr)
 	}
-	defer ah.releaseFetchSlot()
 
-	cancelCtx := ah.registerRequest(ctx, normalizedURL)
-	defer ah.unregisterRequest(normalizedURL)
+	req, err := ah.createHTTPRequest(ctx, fetchReq, urlStr)
+	if err != nil {
+		return nil, err
+	}
+	for name, values := range fetchReq.Header {
+		req.Header[name] = values
+	}
 
-	content, err := ah.performHTTPRequest(cancelCtx, normalizedURL)
+	resp, err := ah.doWithRetry(ctx, ah.streamClientFor(fetchReq), fetchReq, req, nil)
 	if err != nil {
-		return "", err
+		return nil, NewNetworkError(err, urlStr)
 	}
+	return resp, nil
+}
 
-	return content, nil
+func (ah *apiHandler) FetchContent(ctx context.Context, normalizedURL string) (*Response, error) {
+	return ah.Fetch(ctx, &FetchRequest{URL: normalizedURL})
 }
 
-func (ah *apiHandler) performHTTPRequest(ctx context.Context, urlStr string) (string, error) {
-	req, err := ah.createHTTPRequest(ctx, urlStr)
+// Fetch runs the request through the interceptor chain and then loads it.
+// Interceptors work on a copy, so fetchReq itself is never modified. http
+// URLs of known HSTS hosts are upgraded to https first.
+func (ah *apiHandler) Fetch(ctx context.Context, fetchReq *FetchRequest) (*Response, error) {
+	req := *fetchReq
+	req.Header = fetchReq.Header.Clone()
+	if ah.hsts != nil {
+		req.URL, _ = ah.hsts.Upgrade(req.URL)
+	}
+
+	return chainInterceptors(ah.interceptors, ah.fetch)(ctx, &req)
+}
+
+func (ah *apiHandler) fetch(ctx context.Context, fetchReq *FetchRequest) (*Response, error) {
+	normalizedURL := fetchReq.URL
+
+	if handler, ok := ah.schemes.Lookup(urlScheme(normalizedURL)); ok {
+		return handler.Load(ctx, fetchReq)
+	}
+
+	if preloaded := ah.takePreload(ctx, fetchReq); preloaded != nil {
+		return preloaded, nil
+	}
+
+	cached := ah.lookupCache(fetchReq)
+	if cached != nil && fetchReq.CacheMode == CacheModeDefault && cached.IsFresh(time.Now()) {
+		if _, ok := cached.redirectLocation(); ok {
+			return ah.followCachedRedirect(ctx, fetchReq, cached)
+		}
+		return cached.ToResponse(normalizedURL), nil
+	}
+	// A redirect is not revalidated, as a 304 would leave nothing to follow
+	if cached != nil {
+		if _, ok := cached.redirectLocation(); ok {
+			cached = nil
+		}
+	}
+
+	cancelCtx := ah.registerRequest(ctx, fetchReq)
+	defer ah.unregisterRequest(fetchReq)
+
+	// Queued requests are registered too, so CancelAll also drops them
+	slot, err := acquireSlot(cancelCtx, ah.scheduler, fetchReq)
 	if err != nil {
-		return "", err
+		return nil, err
+	}
+	defer slot.Release()
+
+	return ah.performHTTPRequest(cancelCtx, fetchReq, cached, slot)
+}
+
+// lookupCache returns the cached entry for the request. Private tabs, which
+// have their own cookie jar, neither read nor write the shared cache.
+func (ah *apiHandler) lookupCache(fetchReq *FetchRequest) *CacheEntry {
+	if ah.cache == nil || fetchReq.CookieJar != nil || fetchReq.CacheMode == CacheModeReload || !isGetRequest(fetchReq) {
+		return nil
+	}
+
+	entry, ok := ah.cache.Get(fetchReq.URL)
+	if !ok {
+		return nil
+	}
+	return entry
+}
+
+// followCachedRedirect fetches the target of a cached permanent redirect in
+// place of the URL that redirected, through any further cached redirects.
+func (ah *apiHandler) followCachedRedirect(ctx context.Context, fetchReq *FetchRequest, cached *CacheEntry) (*Response, error) {
+	redirected := *fetchReq
+	for hops := 0; cached != nil && cached.IsFresh(time.Now()); hops++ {
+		location, ok := cached.redirectLocation()
+		if !ok {
+			break
+		}
+		if hops >= MaxRedirects {
+			return nil, NewBrowserErrorWithContext(ErrHTTPError, "too many redirects", fetchReq.URL)
+		}
+		redirected.URL = location
+		cached = ah.lookupCache(&redirected)
 	}
 
-	resp, err := ah.client.Do(req)
+	resp, err := ah.fetch(ctx, &redirected)
 	if err != nil {
-		return "", err
+		return nil, err
+	}
+	resp.RequestURL = fetchReq.URL
+	return resp, nil
+}
+
+func (ah *apiHandler) performHTTPRequest(ctx context.Context, fetchReq *FetchRequest, cached *CacheEntry, slot *schedulerSlot) (*Response, error) {
+	urlStr := fetchReq.URL
+
+	// A document that turns out to be a download hands its open body to the
+	// DownloadManager, which reads it after the fetch returns, so the request
+	// follows ctx only until then
+	requestCtx, cancelRequest := ctx, context.CancelFunc(func() {})
+	if fetchReq.Type == RequestTypeDocument {
+		requestCtx, cancelRequest = context.WithCancel(context.WithoutCancel(ctx))
+		stopFollowing := context.AfterFunc(ctx, cancelRequest)
+		defer stopFollowing()
+	}
+	handedOff := false
+	defer func() {
+		if !handedOff {
+			cancelRequest()
+		}
+	}()
+
+	req, err := ah.createHTTPRequest(requestCtx, fetchReq, urlStr)
+	if err != nil {
+		return nil, err
+	}
+	for name, values := range fetchReq.Header {
+		req.Header[name] = values
+	}
+
+	switch {
+	case fetchReq.CacheMode == CacheModeReload:
+		req.Header.Set("Cache-Control", "no-cache")
+		req.Header.Set("Pragma", "no-cache")
+	case cached != nil && cached.HasValidators():
+		cached.ApplyValidators(req)
+	}
+
+	requestTime := time.Now()
+	resp, err := ah.doWithRetry(ctx, ah.clientFor(fetchReq), fetchReq, req, slot)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if !handedOff {
+			resp.Body.Close()
+		}
+	}()
+	responseTime := time.Now()
+	if fetchReq.CookieJar == nil {
+		ah.storeRedirects(resp, requestTime, responseTime)
+	}
+
+	if resp.StatusCode == http.StatusNotModified && cached != nil {
+		refreshed := cached.clone()
+		refreshed.Refresh(resp.Header, requestTime, responseTime)
+		ah.cache.Put(refreshed)
+		return refreshed.ToResponse(urlStr), nil
+	}
+
+	finalURL, finalMethod := urlStr, req.Method
+	if resp.Request != nil && resp.Request.URL != nil {
+		finalURL, finalMethod = resp.Request.URL.String(), resp.Request.Method
+	}
+	security := newSecurityInfo(resp.TLS, hostOf(finalURL), ah.rootCAs())
+
+	// Downloads are streamed to disk by the DownloadManager, so the body of
+	// a document is left open for it and neither read nor cached here. Hints
+	// skip downloads, and bodies too large for the preload cache.
+	download := fetchReq.Type == RequestTypeDocument && isDownloadResponse(resp.Header)
+	skipBody := fetchReq.Type == RequestTypePrefetch && (isDownloadResponse(resp.Header) || resp.ContentLength > MaxCacheEntrySize)
+	if (download || skipBody) && resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		result := NewResponse(urlStr, finalURL, resp.StatusCode, resp.Header, nil)
+		result.Status = resp.Status
+		result.Method = finalMethod
+		result.Security = security
+		if download {
+			result.stream = &downloadStream{Reader: ah.createResponseReader(resp), body: resp.Body, cancel: cancelRequest}
+			handedOff = true
+		}
+		return result, nil
+	}
+
+	content, err := ah.readResponseContent(resp)
+	if err != nil {
+		return nil, err
+	}
+
+	if fetchReq.CookieJar == nil {
+		ah.storeInCache(req, resp, finalURL, content, security, requestTime, responseTime)
+	}
+
+	result := NewResponse(urlStr, finalURL, resp.StatusCode, resp.Header, content)
+	result.Status = resp.Status
+	result.Method = finalMethod
+	result.Security = security
+	return result, nil
+}
+
+// rootCAs returns the roots certificates are verified against; nil means
+// the system roots.
+func (ah *apiHandler) rootCAs() *x509.CertPool {
+	if ah.tlsConfig == nil {
+		return nil
+	}
+	return ah.tlsConfig.RootCAs
+}
+
+// clientFor returns a client that shares the handler's transport but sends and
+// stores cookies through the jar the request belongs to.
+func (ah *apiHandler) clientFor(fetchReq *FetchRequest) *http.Client {
+	jar := fetchReq.CookieJar
+	if jar == nil {
+		jar = ah.cookieJar
+	}
+	if jar == nil {
+		return ah.client
+	}
+
+	client := *ah.client
+	client.Jar = jar.ForSite(fetchReq.FirstPartyURL)
+	return &client
+}
+
+// streamClientFor is clientFor without the overall timeout, which would also
+// cut off a body that takes longer than that to arrive. The caller's context
+// and the transport's header timeout bound streamed requests instead.
+func (ah *apiHandler) streamClientFor(fetchReq *FetchRequest) *http.Client {
+	client := *ah.clientFor(fetchReq)
+	client.Timeout = 0
+	return &client
+}
+
+func (ah *apiHandler) storeInCache(req *http.Request, resp *http.Response, finalURL string, content []byte, security *SecurityInfo, requestTime, responseTime time.Time) {
+	if ah.cache == nil {
+		return
+	}
+
+	// An unsafe request such as a POST invalidates what is stored for the
+	// URL instead of being stored itself (RFC 9111 section 4.4)
+	if req.Method != http.MethodGet {
+		ah.cache.Delete(req.URL.String())
+		ah.cache.Delete(finalURL)
+		return
+	}
+
+	if !isStorable(resp.StatusCode, req.Header, resp.Header, len(content)) {
+		ah.cache.Delete(finalURL)
+		return
 	}
-	defer resp.Body.Close()
 
-	return ah.readResponseContent(resp)
+	// The body is stored decoded, so its transfer encoding no longer applies
+	header := resp.Header.Clone()
+	header.Del("Content-Encoding")
+	header.Del("Content-Length")
+
+	ah.cache.Put(&CacheEntry{
+		URL:          finalURL,
+		StatusCode:   resp.StatusCode,
+		Header:       header,
+		Body:         content,
+		RequestTime:  requestTime,
+		ResponseTime: responseTime,
+		Security:     security,
+	})
+}
+
+// storeRedirects caches the permanent redirects followed on the way to resp,
+// which net/http leaves linked from its request, so that later requests for
+// the URLs that redirected skip them.
+func (ah *apiHandler) storeRedirects(resp *http.Response, requestTime, responseTime time.Time) {
+	if ah.cache == nil || resp.Request == nil {
+		return
+	}
+
+	for redirect := resp.Request.Response; redirect != nil && redirect.Request != nil; redirect = redirect.Request.Response {
+		req := redirect.Request
+		if req.Method != http.MethodGet || !isStorable(redirect.StatusCode, req.Header, redirect.Header, 0) {
+			continue
+		}
+
+		header := redirect.Header.Clone()
+		header.Del("Content-Encoding")
+		header.Del("Content-Length")
+		entry := &CacheEntry{
+			URL:          req.URL.String(),
+			StatusCode:   redirect.StatusCode,
+			Header:       header,
+			RequestTime:  requestTime,
+			ResponseTime: responseTime,
+		}
+		if _, ok := entry.redirectLocation(); ok {
+			ah.cache.Put(entry)
+		}
+	}
 }
 
-func (ah *apiHandler) createHTTPRequest(ctx context.Context, urlStr string) (*http.Request, error) {
-	req, err := http.NewRequestWithContext(ctx, http.MethodGet, urlStr, nil)
+func (ah *apiHandler) createHTTPRequest(ctx context.Context, fetchReq *FetchRequest, urlStr string) (*http.Request, error) {
+	method := fetchReq.Method
+	if method == "" {
+		method = http.MethodGet
+	}
+
+	// A bytes.Reader lets redirects and retries replay the body
+	var body io.Reader
+	if fetchReq.Body != nil {
+		body = bytes.NewReader(fetchReq.Body)
+	}
+
+	ctx = withPrivateRequest(withRequestReferrer(ctx, fetchReq), fetchReq)
+	req, err := http.NewRequestWithContext(ctx, method, urlStr, body)
 	if err != nil {
 		return nil, NewBrowserError(ErrInvalidURL, "failed to create request: "+err.Error())
 	}
 
 	ah.setRequestHeaders(req)
+	if referrer := fetchReq.ReferrerPolicy.Referrer(fetchReq.Referrer, urlStr); referrer != "" {
+		req.Header.Set("Referer", referrer)
+	}
 	return req, nil
 }
 
-func (ah *apiHandler) readResponseContent(resp *http.Response) (string, error) {
+func isGetRequest(fetchReq *FetchRequest) bool {
+	return fetchReq.Method == "" || fetchReq.Method == http.MethodGet
+}
+
+func (ah *apiHandler) readResponseContent(resp *http.Response) ([]byte, error) {
 	reader := ah.createResponseReader(resp)
 	defer ah.closeReader(reader, resp)
 
-	content, err := io.ReadAll(reader)
-	if err != nil {
-		return "", err
-	}
-
-	return string(content), nil
+	return io.ReadAll(reader)
 }
 
 func (ah *apiHandler) createResponseReader(resp *http.Response) io.Reader {
@@ -461,6 +966,20 @@ func (ah *apiHandler) createResponseReader(resp *http.Response) io.Reader {
 	return gzReader
 }
 
+// downloadStream is the body of a download, decoded as it is read. Closing
+// it ends the request.
+type downloadStream struct {
+	io.Reader
+	body   io.Closer
+	cancel context.CancelFunc
+}
+
+func (s *downloadStream) Close() error {
+	err := s.body.Close()
+	s.cancel()
+	return err
+}
+
 func (ah *apiHandler) closeReader(reader io.Reader, resp *http.Response) {
 	if gzReader, ok := reader.(*gzip.Reader); ok && gzReader != resp.Body {
 		gzReader.Close()
@@ -476,30 +995,35 @@ func (ah *apiHandler) setRequestHeaders(req *http.Request) {
 	req.Header.Set("Upgrade-Insecure-Requests", "1")
 }
 
-func (ah *apiHandler) acquireFetchSlot(ctx context.Context) error {
-	select {
-	case ah.fetchPool <- struct{}{}:
-		return nil
-	case <-ctx.Done():
-		return NewBrowserError(ErrNetworkTimeout, "request cancelled")
-	}
-}
+// registerRequest tracks each fetch separately, so two tabs loading the same
+// URL never cancel or unregister each other.
+func (ah *apiHandler) registerRequest(ctx context.Context, fetchReq *FetchRequest) context.Context {
+	ah.requestMutex.Lock()
+	defer ah.requestMutex.Unlock()
 
-func (ah *apiHandler) releaseFetchSlot() {
-	<-ah.fetchPool
+	cancelCtx, cancel := context.WithCancel(ctx)
+	ah.activeRequests[fetchReq] = cancel
+	return cancelCtx
 }
 
-func (ah *apiHandler) registerRequest(ctx context.Context, urlStr string) context.Context {
+func (ah *apiHandler) unregisterRequest(fetchReq *FetchRequest) {
 	ah.requestMutex.Lock()
 	defer ah.requestMutex.Unlock()
 
-	cancelCtx, cancel := context.WithCancel(ctx)
-	ah.activeRequests[urlStr] = cancel
-	return cancelCtx
+	if cancel, ok := ah.activeRequests[fetchReq]; ok {
+		cancel()
+		delete(ah.activeRequests, fetchReq)
+	}
 }
 
-func (ah *apiHandler) unregisterRequest(urlStr string) {
+func (ah *apiHandler) CancelAll() {
+	ah.hints.CancelAll()
+
 	ah.requestMutex.Lock()
 	defer ah.requestMutex.Unlock()
-	delete(ah.activeRequests, urlStr)
+
+	for fetchReq, cancel := range ah.activeRequests {
+		cancel()
+		delete(ah.activeRequests, fetchReq)
+	}
 }
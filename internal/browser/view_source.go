@@ -0,0 +1,252 @@
+package browser
+
+import (
+	"context"
+	"fmt"
+	"html"
+	"net/http"
+	"regexp"
+	"strings"
+)
+
+const viewSourceScheme = "view-source"
+
+// sourceSegment is a run of raw source text rendered with one class. link is
+// set for href and src values, which open view-source for their target.
+type sourceSegment struct {
+	class string
+	text  string
+	link  string
+}
+
+var (
+	tagOpenPattern   = regexp.MustCompile(`^</?[^\s/>]*`)
+	attributePattern = regexp.MustCompile(`([^\s=/>"']+)(?:(\s*=\s*)("[^"]*"|'[^']*'|[^\s>]+))?`)
+)
+
+// viewSourceHandler serves view-source:<url> by fetching <url> and showing
+// its raw text as a line-numbered, colour-coded document.
+type viewSourceHandler struct {
+	apiHandler APIHandler
+	urlHandler URLHandler
+}
+
+func newViewSourceHandler(apiHandler APIHandler, urlHandler URLHandler) SchemeHandler {
+	return &viewSourceHandler{apiHandler: apiHandler, urlHandler: urlHandler}
+}
+
+func (vh *viewSourceHandler) Load(ctx context.Context, req *FetchRequest) (*Response, error) {
+	target := strings.TrimSpace(req.URL[len(viewSourceScheme)+1:])
+	if urlScheme(target) == viewSourceScheme {
+		return nil, NewBrowserErrorWithContext(ErrInvalidURL, "view-source cannot be nested", req.URL)
+	}
+
+	normalizedTarget, err := vh.urlHandler.Normalize(target)
+	if err != nil {
+		return nil, err
+	}
+
+	innerReq := *req
+	innerReq.URL = normalizedTarget
+	resp, err := vh.apiHandler.Fetch(ctx, &innerReq)
+	if err != nil {
+		return nil, NewNetworkError(err, normalizedTarget)
+	}
+
+	pageURL := viewSourceScheme + ":" + resp.URL
+
+	var segments []sourceSegment
+	switch {
+	case resp.IsHTML() || resp.ContentType == "":
+		segments = vh.highlightHTML(resp.Text(), resp.URL)
+	case resp.IsText():
+		segments = []sourceSegment{{text: resp.Text()}}
+	default:
+		segments = []sourceSegment{{
+			class: "comment",
+			text:  fmt.Sprintf("Binary content (%s, %d bytes)", resp.ContentType, len(resp.Body)),
+		}}
+	}
+
+	header := http.Header{}
+	header.Set("Content-Type", "text/html; charset=utf-8")
+	return NewResponse(req.URL, pageURL, http.StatusOK, header, []byte(renderSourcePage(pageURL, segments))), nil
+}
+
+// highlightHTML splits source into segments using the spans of the tokens the
+// Tokenizer produces, so the output shows exactly what the parser received.
+func (vh *viewSourceHandler) highlightHTML(source, baseURL string) []sourceSegment {
+	var segments []sourceSegment
+
+	tokenizer := NewTokenizer(source)
+	for tokenizer.HasMore() {
+		start := tokenizer.GetPosition()
+		token, err := tokenizer.NextToken()
+		end := tokenizer.GetPosition()
+		if err != nil || token.Type == TokenTypeEOF || end <= start {
+			break
+		}
+
+		raw := source[start:end]
+		// The tokenizer skips whitespace before a token; keep it as plain text
+		trimmed := strings.TrimLeft(raw, " \t\r\n\f")
+		if leading := raw[:len(raw)-len(trimmed)]; leading != "" {
+			segments = append(segments, sourceSegment{text: leading})
+		}
+
+		switch token.Type {
+		case TokenTypeStartTag, TokenTypeEndTag, TokenTypeSelfClosingTag:
+			segments = append(segments, vh.highlightTag(trimmed, baseURL)...)
+		case TokenTypeComment:
+			segments = append(segments, sourceSegment{class: "comment", text: trimmed})
+		case TokenTypeDoctype:
+			segments = append(segments, sourceSegment{class: "doctype", text: trimmed})
+		default:
+			segments = append(segments, sourceSegment{text: trimmed})
+		}
+	}
+
+	if end := tokenizer.GetPosition(); end < len(source) {
+		segments = append(segments, sourceSegment{text: source[end:]})
+	}
+
+	return segments
+}
+
+func (vh *viewSourceHandler) highlightTag(raw, baseURL string) []sourceSegment {
+	open := tagOpenPattern.FindString(raw)
+	segments := []sourceSegment{{class: "tag", text: open}}
+
+	rest := raw[len(open):]
+	closing := ""
+	if strings.HasSuffix(rest, "/>") {
+		rest, closing = rest[:len(rest)-2], "/>"
+	} else if strings.HasSuffix(rest, ">") {
+		rest, closing = rest[:len(rest)-1], ">"
+	}
+
+	offset := 0
+	for _, match := range attributePattern.FindAllStringSubmatchIndex(rest, -1) {
+		if match[0] > offset {
+			segments = append(segments, sourceSegment{class: "tag", text: rest[offset:match[0]]})
+		}
+
+		name := rest[match[2]:match[3]]
+		segments = append(segments, sourceSegment{class: "attr-name", text: name})
+
+		if match[4] >= 0 {
+			segments = append(segments, sourceSegment{text: rest[match[4]:match[5]]})
+
+			value := rest[match[6]:match[7]]
+			segment := sourceSegment{class: "attr-value", text: value}
+			if lowerName := strings.ToLower(name); lowerName == "href" || lowerName == "src" {
+				segment.link = vh.sourceLink(baseURL, html.UnescapeString(strings.Trim(value, `"'`)))
+			}
+			segments = append(segments, segment)
+		}
+
+		offset = match[1]
+	}
+
+	if offset < len(rest) {
+		segments = append(segments, sourceSegment{class: "tag", text: rest[offset:]})
+	}
+	return append(segments, sourceSegment{class: "tag", text: closing})
+}
+
+// sourceLink returns the view-source URL for a reference found in the page,
+// or "" when it cannot be resolved.
+func (vh *viewSourceHandler) sourceLink(baseURL, reference string) string {
+	reference = strings.TrimSpace(reference)
+	if reference == "" || strings.HasPrefix(reference, "#") {
+		return ""
+	}
+
+	target := reference
+	if !vh.urlHandler.IsAbsoluteURL(reference) {
+		resolved, err := vh.urlHandler.Resolve(baseURL, reference)
+		if err != nil {
+			return ""
+		}
+		target = resolved
+	}
+
+	if urlScheme(target) == viewSourceScheme {
+		return target
+	}
+	return viewSourceScheme + ":" + target
+}
+
+func renderSourcePage(pageURL string, segments []sourceSegment) string {
+	var page strings.Builder
+	page.WriteString("<!DOCTYPE html>\n<html>\n<head>\n")
+	fmt.Fprintf(&page, "<title>%s</title>\n", html.EscapeString(pageURL))
+	page.WriteString("<style>\n")
+	page.WriteString("pre { font-family: monospace; }\n")
+	fmt.Fprintf(&page, ".line-number { color: %s; }\n", ViewSourceLineNumberColor)
+	fmt.Fprintf(&page, ".tag { color: %s; }\n", ViewSourceTagColor)
+	fmt.Fprintf(&page, ".attr-name { color: %s; }\n", ViewSourceAttrNameColor)
+	fmt.Fprintf(&page, ".attr-value { color: %s; }\n", ViewSourceAttrValueColor)
+	fmt.Fprintf(&page, ".comment { color: %s; }\n", ViewSourceCommentColor)
+	fmt.Fprintf(&page, ".doctype { color: %s; }\n", ViewSourceDoctypeColor)
+	page.WriteString("</style>\n</head>\n<body>\n<pre>")
+
+	lines := splitSegmentsIntoLines(segments)
+	width := len(fmt.Sprint(len(lines)))
+	for i, line := range lines {
+		number := fmt.Sprintf("%*d ", width, i+1)
+		fmt.Fprintf(&page, "<span class=\"line-number\">%s</span>", sourceHTML(number))
+		for _, segment := range line {
+			writeSourceSegment(&page, segment)
+		}
+		page.WriteString("<br>")
+	}
+
+	page.WriteString("</pre>\n</body>\n</html>\n")
+	return page.String()
+}
+
+// splitSegmentsIntoLines breaks segments at newlines so each line can carry
+// its own number.
+func splitSegmentsIntoLines(segments []sourceSegment) [][]sourceSegment {
+	lines := [][]sourceSegment{nil}
+	for _, segment := range segments {
+		parts := strings.Split(strings.ReplaceAll(segment.text, "\r\n", "\n"), "\n")
+		for i, part := range parts {
+			if i > 0 {
+				lines = append(lines, nil)
+			}
+			if part != "" {
+				piece := segment
+				piece.text = part
+				lines[len(lines)-1] = append(lines[len(lines)-1], piece)
+			}
+		}
+	}
+
+	// A trailing newline does not start another line
+	if len(lines) > 1 && len(lines[len(lines)-1]) == 0 {
+		lines = lines[:len(lines)-1]
+	}
+	return lines
+}
+
+func writeSourceSegment(page *strings.Builder, segment sourceSegment) {
+	text := sourceHTML(segment.text)
+	if segment.link != "" {
+		text = fmt.Sprintf("<a href=\"%s\">%s</a>", html.EscapeString(segment.link), text)
+	}
+	if segment.class != "" {
+		fmt.Fprintf(page, "<span class=\"%s\">%s</span>", segment.class, text)
+		return
+	}
+	page.WriteString(text)
+}
+
+// sourceHTML escapes source text and protects its spaces, which the
+// tokenizer would otherwise drop at the start of text runs.
+func sourceHTML(text string) string {
+	text = strings.ReplaceAll(text, "\r", "")
+	text = strings.ReplaceAll(text, "\t", strings.Repeat(" ", ViewSourceTabWidth))
+	return strings.ReplaceAll(html.EscapeString(text), " ", "&nbsp;")
+}
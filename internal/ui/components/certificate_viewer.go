@@ -0,0 +1,137 @@
+package components
+
+import (
+	"fmt"
+	"image/color"
+	"strings"
+
+	"gioui.org/layout"
+	"gioui.org/op/clip"
+	"gioui.org/op/paint"
+	"gioui.org/unit"
+	"gioui.org/widget"
+	"gioui.org/widget/material"
+	"github.com/ducnd58233/gobrowser/internal/browser"
+)
+
+// CertificateViewer is a panel listing the certificate chain of a page.
+type CertificateViewer interface {
+	Render(gtx layout.Context, theme *material.Theme, info *browser.SecurityInfo) layout.Dimensions
+	IsOpen() bool
+	Toggle()
+}
+
+type certificateViewer struct {
+	open        bool
+	closeButton *widget.Clickable
+	list        widget.List
+}
+
+func NewCertificateViewer() CertificateViewer {
+	return &certificateViewer{
+		closeButton: &widget.Clickable{},
+		list:        widget.List{List: layout.List{Axis: layout.Vertical}},
+	}
+}
+
+func (cv *certificateViewer) IsOpen() bool {
+	return cv.open
+}
+
+func (cv *certificateViewer) Toggle() {
+	cv.open = !cv.open
+}
+
+func (cv *certificateViewer) Render(gtx layout.Context, theme *material.Theme, info *browser.SecurityInfo) layout.Dimensions {
+	if cv.closeButton.Clicked(gtx) {
+		cv.open = false
+	}
+	if !cv.open || info == nil {
+		return layout.Dimensions{}
+	}
+
+	gtx.Constraints.Max.Y = gtx.Dp(unit.Dp(CertificateViewerHeight))
+
+	return layout.Background{}.Layout(gtx,
+		func(gtx layout.Context) layout.Dimensions {
+			size := gtx.Constraints.Min
+			paint.FillShape(gtx.Ops, color.NRGBA{R: 0xF8, G: 0xF9, B: 0xFA, A: 0xFF}, clip.Rect{Max: size}.Op())
+			return layout.Dimensions{Size: size}
+		},
+		func(gtx layout.Context) layout.Dimensions {
+			return layout.UniformInset(unit.Dp(browser.DefaultPadding)).Layout(gtx, func(gtx layout.Context) layout.Dimensions {
+				return cv.renderContent(gtx, theme, info)
+			})
+		},
+	)
+}
+
+func (cv *certificateViewer) renderContent(gtx layout.Context, theme *material.Theme, info *browser.SecurityInfo) layout.Dimensions {
+	lines := certificateLines(info)
+
+	return layout.Flex{Axis: layout.Horizontal}.Layout(gtx,
+		layout.Flexed(1, func(gtx layout.Context) layout.Dimensions {
+			gtx.Constraints.Min.X = gtx.Constraints.Max.X
+			return material.List(theme, &cv.list).Layout(gtx, len(lines), func(gtx layout.Context, i int) layout.Dimensions {
+				label := material.Body2(theme, lines[i].text)
+				if lines[i].heading {
+					label = material.Subtitle2(theme, lines[i].text)
+				}
+				return layout.Inset{Bottom: unit.Dp(2)}.Layout(gtx, label.Layout)
+			})
+		}),
+		layout.Rigid(func(gtx layout.Context) layout.Dimensions {
+			return material.Button(theme, cv.closeButton, CloseTabText).Layout(gtx)
+		}),
+	)
+}
+
+type certificateLine struct {
+	text    string
+	heading bool
+}
+
+func certificateLines(info *browser.SecurityInfo) []certificateLine {
+	status := CertificateVerifiedText
+	if !info.Verified {
+		status = CertificateExceptionText
+	}
+
+	lines := []certificateLine{
+		{text: status, heading: true},
+		{text: fmt.Sprintf("%s, %s", info.Protocol, info.CipherSuite)},
+	}
+
+	for i, cert := range info.Chain {
+		lines = append(lines,
+			certificateLine{text: fmt.Sprintf("Certificate %d", i+1), heading: true},
+			certificateLine{text: "Subject: " + cert.Subject},
+			certificateLine{text: "Issuer: " + cert.Issuer},
+			certificateLine{text: fmt.Sprintf("Valid: %s to %s",
+				cert.NotBefore.Format(CertificateTimeFormat), cert.NotAfter.Format(CertificateTimeFormat))},
+		)
+
+		sans := append(append([]string(nil), cert.DNSNames...), cert.IPAddresses...)
+		if len(sans) > 0 {
+			lines = append(lines, certificateLine{text: "Subject alternative names: " + strings.Join(sans, ", ")})
+		}
+		lines = append(lines, certificateLine{text: "SHA-256: " + cert.SHA256Fingerprint})
+	}
+
+	return lines
+}
+
+// securityIndicator returns the toolbar label for a page, or "" for pages
+// that are not fetched over the network.
+func securityIndicator(pageURL string, info *browser.SecurityInfo) string {
+	switch {
+	case strings.HasPrefix(pageURL, "https://") && info != nil && info.Verified:
+		return SecureText
+	case strings.HasPrefix(pageURL, "https://") && info != nil:
+		return CertificateExceptionText
+	case strings.HasPrefix(pageURL, "http://"):
+		return NotSecureText
+	default:
+		return ""
+	}
+}
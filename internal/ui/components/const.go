@@ -1,5 +1,7 @@
 package components
 
+import "time"
+
 // Application constants
 const (
 	AppName = "GoBrowser"
@@ -20,6 +22,9 @@ const (
 	ButtonHeight   = 32
 	TabHeight      = 32
 	ScrollbarWidth = 16
+
+	CertificateViewerHeight = 220
+	DownloadsPanelHeight    = 220
 )
 
 const (
@@ -36,16 +41,24 @@ const (
 const (
 	CloseTabText           = "×"
 	AddTabText             = "+"
+	AddPrivateTabText      = "+P"
 	NewTabText             = "New Tab"
 	MaxTabTitleLength      = 25
 	TruncationSuffixLength = 3
 )
 
+// HoverPrefetchDelay is how long the pointer rests on a link before the
+// engine is told, so links merely passed over are not prefetched
+const HoverPrefetchDelay = 150 * time.Millisecond
+
 // Progress bar constants
 const (
 	ProgressBarHeight = 2
 	ProgressBarBg     = 0xE0E0E0 // Light gray background
 	ProgressBarFill   = 0x4285F4 // Chrome blue fill
+
+	// RetryProgressStart is where the bar stands while the first attempt runs
+	RetryProgressStart = 0.3
 )
 
 // Button and icon sizing
@@ -57,6 +70,7 @@ const (
 
 const (
 	TabColorActive   = "#4285f4"
+	TabColorPrivate  = "#6a3fb5"
 	TabColorInactive = "#f5f5f5"
 	TabColorHover    = "#ebebeb"
 	TabBorderColor   = "#dadce0"
@@ -93,10 +107,38 @@ const (
 
 // Text constants
 const (
-	URLPlaceholder = "Search Google or type a URL"
-	LoadingText    = "Loading..."
-	ErrorText      = "Error loading page"
-	EmptyText      = "No content to display"
+	URLPlaceholder    = "Search Google or type a URL"
+	LoadingText       = "Loading..."
+	ErrorText         = "Error loading page"
+	EmptyText         = "No content to display"
+	BlockerButtonText = "Blocked %d"
+	BlockerOffText    = "Blocking off"
+	RetryingText      = "Retrying (attempt %d of %d)"
+
+	SecureText               = "Secure"
+	NotSecureText            = "Not secure"
+	CertificateVerifiedText  = "Connection is secure"
+	CertificateExceptionText = "Certificate not verified"
+	CertificateTimeFormat    = "2006-01-02 15:04 MST"
+
+	MixedContentBlockedText = "Insecure content blocked (%d)"
+	MixedContentWarningText = "Insecure content loaded (%d)"
+	CSPBlockedText          = "Blocked by Content Security Policy (%d)"
+
+	DownloadsButtonText = "Downloads"
+	NoDownloadsText     = "Nothing has been downloaded yet."
+	PauseDownloadText   = "Pause"
+	ResumeDownloadText  = "Resume"
+	CancelDownloadText  = "Cancel"
+	RemoveDownloadText  = "Remove"
+
+	FormResubmissionText = "This page was the result of a form submission. Reloading sends the form again, which may repeat what it did."
+	ResubmitFormText     = "Resubmit"
+	CancelResubmitText   = "Cancel"
+
+	RedirectPendingText = "Redirecting to %s in %d s"
+	ReloadPendingText   = "Reloading this page in %d s"
+	StayOnPageText      = "Stay on page"
 )
 
 const (
@@ -1,14 +1,20 @@
 package components
 
 import (
+	"context"
 	"image"
+	"log"
+	"time"
 
+	"gioui.org/io/event"
+	"gioui.org/io/pointer"
 	"gioui.org/layout"
 	"gioui.org/op/clip"
 	"gioui.org/widget"
 	"gioui.org/widget/material"
 	"github.com/ducnd58233/gobrowser/internal/browser"
 	blayout "github.com/ducnd58233/gobrowser/internal/ui/layout"
+	"github.com/ducnd58233/gobrowser/internal/ui/render"
 )
 
 type Content interface {
@@ -24,6 +30,11 @@ type ContentDependencies struct {
 type contentRenderer struct {
 	deps ContentDependencies
 	list widget.List
+	// hoveredLink is the link under the pointer since hoverStart, reported
+	// to the engine once the pointer has rested on it
+	hoveredLink browser.Node
+	hoverStart  time.Time
+	reported    bool
 }
 
 func NewContentRenderer(deps ContentDependencies) Content {
@@ -44,10 +55,10 @@ func (cr *contentRenderer) Render(gtx layout.Context, theme *material.Theme, tab
 		return cr.renderEmptyState(gtx, theme, "Loading content...")
 	}
 
-	return cr.renderDocumentContent(gtx, theme, document)
+	return cr.renderDocumentContent(gtx, theme, document, tabIndex)
 }
 
-func (cr *contentRenderer) renderDocumentContent(gtx layout.Context, theme *material.Theme, document browser.Document) layout.Dimensions {
+func (cr *contentRenderer) renderDocumentContent(gtx layout.Context, theme *material.Theme, document browser.Document, tabIndex int) layout.Dimensions {
 	viewportWidth := float64(gtx.Constraints.Max.X)
 	viewportHeight := float64(gtx.Constraints.Max.Y)
 
@@ -62,6 +73,8 @@ func (cr *contentRenderer) renderDocumentContent(gtx layout.Context, theme *mate
 					contentArea := clip.Rect{Max: gtx.Constraints.Max}
 					defer contentArea.Push(gtx.Ops).Pop()
 					scrollY := float64(cr.list.Position.Offset)
+					cr.handlePointer(gtx, displayList, scrollY, tabIndex)
+					event.Op(gtx.Ops, cr)
 					displayList.Paint(gtx, theme, scrollY)
 
 					return layout.Dimensions{
@@ -91,3 +104,77 @@ func (cr *contentRenderer) renderEmptyState(gtx layout.Context, theme *material.
 		return label.Layout(gtx)
 	})
 }
+
+// handlePointer follows clicked links, submits forms whose submit button
+// was clicked and tells the engine about links the pointer rests on.
+func (cr *contentRenderer) handlePointer(gtx layout.Context, displayList render.DisplayList, scrollY float64, tabIndex int) {
+	defer cr.reportHover(tabIndex)
+
+	for {
+		ev, ok := gtx.Event(pointer.Filter{Target: cr, Kinds: pointer.Press | pointer.Move | pointer.Leave})
+		if !ok {
+			return
+		}
+
+		press, ok := ev.(pointer.Event)
+		if !ok {
+			continue
+		}
+		switch press.Kind {
+		case pointer.Move:
+			cr.trackHover(displayList.FindElementAt(float64(press.Position.X), float64(press.Position.Y), scrollY))
+			continue
+		case pointer.Leave:
+			cr.trackHover(nil)
+			continue
+		}
+		if !press.Buttons.Contain(pointer.ButtonPrimary) {
+			continue
+		}
+
+		node := displayList.FindElementAt(float64(press.Position.X), float64(press.Position.Y), scrollY)
+		if link := browser.FindEnclosingLink(node); link != nil {
+			go cr.followLink(tabIndex, link)
+		} else if submitter := browser.FindEnclosingSubmitButton(node); submitter != nil {
+			go cr.submitForm(tabIndex, submitter)
+		}
+	}
+}
+
+func (cr *contentRenderer) trackHover(node browser.Node) {
+	link := browser.FindEnclosingLink(node)
+	if link == cr.hoveredLink {
+		return
+	}
+	cr.hoveredLink = link
+	cr.hoverStart = time.Now()
+	cr.reported = false
+}
+
+// reportHover tells the engine about the hovered link once the pointer has
+// stayed on it for HoverPrefetchDelay.
+func (cr *contentRenderer) reportHover(tabIndex int) {
+	if cr.hoveredLink == nil || cr.reported || time.Since(cr.hoverStart) < HoverPrefetchDelay {
+		return
+	}
+	cr.reported = true
+	go cr.deps.Engine.HoverLink(tabIndex, cr.hoveredLink)
+}
+
+func (cr *contentRenderer) followLink(tabIndex int, link browser.Node) {
+	ctx, cancel := context.WithTimeout(context.Background(), browser.DefaultTimeout)
+	defer cancel()
+
+	if err := cr.deps.Engine.FollowLink(ctx, tabIndex, link); err != nil && cr.deps.DebugMode {
+		log.Printf("Failed to follow link: %v", err)
+	}
+}
+
+func (cr *contentRenderer) submitForm(tabIndex int, submitter browser.Node) {
+	ctx, cancel := context.WithTimeout(context.Background(), browser.DefaultTimeout)
+	defer cancel()
+
+	if err := cr.deps.Engine.SubmitForm(ctx, tabIndex, nil, submitter); err != nil && cr.deps.DebugMode {
+		log.Printf("Failed to submit form: %v", err)
+	}
+}
@@ -0,0 +1,222 @@
+package components
+
+import (
+	"fmt"
+	"image/color"
+
+	"gioui.org/layout"
+	"gioui.org/op/clip"
+	"gioui.org/op/paint"
+	"gioui.org/unit"
+	"gioui.org/widget"
+	"gioui.org/widget/material"
+	"github.com/ducnd58233/gobrowser/internal/browser"
+)
+
+// DownloadsPanel lists the engine's downloads with controls for each.
+type DownloadsPanel interface {
+	Render(gtx layout.Context, theme *material.Theme) layout.Dimensions
+	IsOpen() bool
+	Toggle()
+	// Open shows the panel, e.g. when a download starts.
+	Open()
+}
+
+type downloadControls struct {
+	pauseButton  widget.Clickable
+	cancelButton widget.Clickable
+	removeButton widget.Clickable
+}
+
+type downloadsPanel struct {
+	downloads   browser.DownloadManager
+	open        bool
+	closeButton *widget.Clickable
+	controls    map[string]*downloadControls
+	list        widget.List
+}
+
+func NewDownloadsPanel(downloads browser.DownloadManager) DownloadsPanel {
+	return &downloadsPanel{
+		downloads:   downloads,
+		closeButton: &widget.Clickable{},
+		controls:    make(map[string]*downloadControls),
+		list:        widget.List{List: layout.List{Axis: layout.Vertical}},
+	}
+}
+
+func (dp *downloadsPanel) IsOpen() bool {
+	return dp.open
+}
+
+func (dp *downloadsPanel) Toggle() {
+	dp.open = !dp.open
+}
+
+func (dp *downloadsPanel) Open() {
+	dp.open = true
+}
+
+func (dp *downloadsPanel) Render(gtx layout.Context, theme *material.Theme) layout.Dimensions {
+	if dp.closeButton.Clicked(gtx) {
+		dp.open = false
+	}
+	if !dp.open || dp.downloads == nil {
+		return layout.Dimensions{}
+	}
+
+	// Newest first
+	all := dp.downloads.List()
+	downloads := make([]browser.Download, 0, len(all))
+	for i := len(all) - 1; i >= 0; i-- {
+		downloads = append(downloads, all[i])
+	}
+	dp.handleClicks(gtx, downloads)
+
+	gtx.Constraints.Max.Y = gtx.Dp(unit.Dp(DownloadsPanelHeight))
+
+	return layout.Background{}.Layout(gtx,
+		func(gtx layout.Context) layout.Dimensions {
+			size := gtx.Constraints.Min
+			paint.FillShape(gtx.Ops, color.NRGBA{R: 0xF8, G: 0xF9, B: 0xFA, A: 0xFF}, clip.Rect{Max: size}.Op())
+			return layout.Dimensions{Size: size}
+		},
+		func(gtx layout.Context) layout.Dimensions {
+			return layout.UniformInset(unit.Dp(browser.DefaultPadding)).Layout(gtx, func(gtx layout.Context) layout.Dimensions {
+				return dp.renderContent(gtx, theme, downloads)
+			})
+		},
+	)
+}
+
+// handleClicks applies the buttons clicked since the last frame. Controls of
+// downloads no longer listed are dropped.
+func (dp *downloadsPanel) handleClicks(gtx layout.Context, downloads []browser.Download) {
+	listed := make(map[string]bool, len(downloads))
+	for _, download := range downloads {
+		listed[download.ID] = true
+
+		controls := dp.controlsFor(download.ID)
+		if controls.pauseButton.Clicked(gtx) {
+			if download.State == browser.DownloadInProgress {
+				go dp.downloads.Pause(download.ID)
+			} else {
+				dp.downloads.Resume(download.ID)
+			}
+		}
+		if controls.cancelButton.Clicked(gtx) {
+			go dp.downloads.Cancel(download.ID)
+		}
+		if controls.removeButton.Clicked(gtx) {
+			dp.downloads.Remove(download.ID)
+		}
+	}
+
+	for id := range dp.controls {
+		if !listed[id] {
+			delete(dp.controls, id)
+		}
+	}
+}
+
+func (dp *downloadsPanel) controlsFor(id string) *downloadControls {
+	controls, ok := dp.controls[id]
+	if !ok {
+		controls = &downloadControls{}
+		dp.controls[id] = controls
+	}
+	return controls
+}
+
+func (dp *downloadsPanel) renderContent(gtx layout.Context, theme *material.Theme, downloads []browser.Download) layout.Dimensions {
+	return layout.Flex{Axis: layout.Horizontal}.Layout(gtx,
+		layout.Flexed(1, func(gtx layout.Context) layout.Dimensions {
+			gtx.Constraints.Min.X = gtx.Constraints.Max.X
+			if len(downloads) == 0 {
+				return material.Body2(theme, NoDownloadsText).Layout(gtx)
+			}
+			return material.List(theme, &dp.list).Layout(gtx, len(downloads), func(gtx layout.Context, i int) layout.Dimensions {
+				return layout.Inset{Bottom: unit.Dp(browser.DefaultSpacing)}.Layout(gtx, func(gtx layout.Context) layout.Dimensions {
+					return dp.renderDownload(gtx, theme, downloads[i])
+				})
+			})
+		}),
+		layout.Rigid(func(gtx layout.Context) layout.Dimensions {
+			return material.Button(theme, dp.closeButton, CloseTabText).Layout(gtx)
+		}),
+	)
+}
+
+func (dp *downloadsPanel) renderDownload(gtx layout.Context, theme *material.Theme, download browser.Download) layout.Dimensions {
+	controls := dp.controlsFor(download.ID)
+
+	children := []layout.FlexChild{
+		layout.Flexed(1, func(gtx layout.Context) layout.Dimensions {
+			return layout.Flex{Axis: layout.Vertical}.Layout(gtx,
+				layout.Rigid(material.Subtitle2(theme, download.FileName()).Layout),
+				layout.Rigid(material.Caption(theme, downloadStatus(download)).Layout),
+				layout.Rigid(func(gtx layout.Context) layout.Dimensions {
+					if download.State != browser.DownloadInProgress || download.Progress() < 0 {
+						return layout.Dimensions{}
+					}
+					return material.ProgressBar(theme, float32(download.Progress())).Layout(gtx)
+				}),
+			)
+		}),
+	}
+
+	switch download.State {
+	case browser.DownloadInProgress:
+		children = append(children,
+			dp.button(theme, &controls.pauseButton, PauseDownloadText),
+			dp.button(theme, &controls.cancelButton, CancelDownloadText),
+		)
+	case browser.DownloadPaused, browser.DownloadFailed:
+		children = append(children,
+			dp.button(theme, &controls.pauseButton, ResumeDownloadText),
+			dp.button(theme, &controls.cancelButton, CancelDownloadText),
+		)
+	default:
+		children = append(children, dp.button(theme, &controls.removeButton, RemoveDownloadText))
+	}
+
+	return layout.Flex{Alignment: layout.Middle}.Layout(gtx, children...)
+}
+
+func (dp *downloadsPanel) button(theme *material.Theme, clickable *widget.Clickable, label string) layout.FlexChild {
+	return layout.Rigid(func(gtx layout.Context) layout.Dimensions {
+		return layout.Inset{Left: unit.Dp(browser.ButtonSpacing)}.Layout(gtx,
+			material.Button(theme, clickable, label).Layout)
+	})
+}
+
+// downloadStatus describes a download's state and size for the panel.
+func downloadStatus(download browser.Download) string {
+	switch download.State {
+	case browser.DownloadCompleted:
+		return fmt.Sprintf("%s, %s", download.State, formatBytes(download.ReceivedBytes))
+	case browser.DownloadFailed:
+		return fmt.Sprintf("%s: %s", download.State, download.Error)
+	case browser.DownloadCancelled:
+		return download.State.String()
+	}
+
+	if download.TotalBytes >= 0 {
+		return fmt.Sprintf("%s, %s of %s", download.State, formatBytes(download.ReceivedBytes), formatBytes(download.TotalBytes))
+	}
+	return fmt.Sprintf("%s, %s", download.State, formatBytes(download.ReceivedBytes))
+}
+
+func formatBytes(n int64) string {
+	const base = 1024
+	if n < base {
+		return fmt.Sprintf("%d B", n)
+	}
+
+	div, exp := int64(base), 0
+	for m := n / base; m >= base; m /= base {
+		div *= base
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(n)/float64(div), "KMGTPE"[exp])
+}
@@ -21,12 +21,13 @@ type TabView interface {
 }
 
 type tabView struct {
-	engine       browser.Engine
-	currentIdx   int
-	tabButtons   []*widget.Clickable
-	closeButtons []*widget.Clickable
-	newTabButton *widget.Clickable
-	colorParser  browser.ColorParser
+	engine           browser.Engine
+	currentIdx       int
+	tabButtons       []*widget.Clickable
+	closeButtons     []*widget.Clickable
+	newTabButton     *widget.Clickable
+	privateTabButton *widget.Clickable
+	colorParser      browser.ColorParser
 
 	tabHoverStates   []bool
 	closeHoverStates []bool
@@ -39,6 +40,7 @@ func NewTabView(engine browser.Engine) TabView {
 		tabButtons:       make([]*widget.Clickable, 0),
 		closeButtons:     make([]*widget.Clickable, 0),
 		newTabButton:     &widget.Clickable{},
+		privateTabButton: &widget.Clickable{},
 		colorParser:      browser.NewColorParser(),
 		tabHoverStates:   make([]bool, 0),
 		closeHoverStates: make([]bool, 0),
@@ -97,6 +99,10 @@ func (t *tabView) renderTabs(theme *material.Theme) []layout.FlexChild {
 		return t.renderNewTabButton(gtx, theme)
 	}))
 
+	children = append(children, layout.Rigid(func(gtx layout.Context) layout.Dimensions {
+		return t.renderPrivateTabButton(gtx, theme)
+	}))
+
 	return children
 }
 
@@ -112,7 +118,7 @@ func (t *tabView) renderTab(gtx layout.Context, theme *material.Theme, tab brows
 			gtx.Constraints.Min = minSize
 			gtx.Constraints.Max = maxSize
 
-			return t.renderTabBackground(gtx, isActive, func(gtx layout.Context) layout.Dimensions {
+			return t.renderTabBackground(gtx, isActive, tab.IsPrivate(), func(gtx layout.Context) layout.Dimensions {
 				return layout.Flex{Axis: layout.Horizontal, Alignment: layout.Middle}.Layout(gtx,
 					// Tab title
 					layout.Flexed(1, func(gtx layout.Context) layout.Dimensions {
@@ -128,9 +134,11 @@ func (t *tabView) renderTab(gtx layout.Context, theme *material.Theme, tab brows
 	)
 }
 
-func (t *tabView) renderTabBackground(gtx layout.Context, isActive bool, w layout.Widget) layout.Dimensions {
+func (t *tabView) renderTabBackground(gtx layout.Context, isActive, isPrivate bool, w layout.Widget) layout.Dimensions {
 	var bgColor color.NRGBA
-	if isActive {
+	if isActive && isPrivate {
+		bgColor = t.parseColor(TabColorPrivate)
+	} else if isActive {
 		bgColor = t.parseColor(TabColorActive)
 	} else {
 		bgColor = t.parseColor(TabColorInactive)
@@ -213,6 +221,32 @@ func (t *tabView) renderNewTabButton(gtx layout.Context, theme *material.Theme)
 	})
 }
 
+func (t *tabView) renderPrivateTabButton(gtx layout.Context, theme *material.Theme) layout.Dimensions {
+	if t.privateTabButton.Clicked(gtx) {
+		newTab := t.engine.AddPrivateTab()
+		if newTab != nil {
+			t.currentIdx = t.engine.GetTabCount() - 1
+		}
+	}
+
+	buttonSize := gtx.Dp(unit.Dp(TabBarHeight))
+
+	return material.Clickable(gtx, t.privateTabButton, func(gtx layout.Context) layout.Dimensions {
+		gtx.Constraints = layout.Exact(image.Pt(buttonSize, buttonSize))
+
+		bgColor := t.parseColor(TabColorInactive)
+		defer clip.Rect{Max: gtx.Constraints.Max}.Push(gtx.Ops).Pop()
+		paint.ColorOp{Color: bgColor}.Add(gtx.Ops)
+		paint.PaintOp{}.Add(gtx.Ops)
+
+		return layout.Center.Layout(gtx, func(gtx layout.Context) layout.Dimensions {
+			label := material.Body1(theme, AddPrivateTabText)
+			label.Color = t.parseColor(TabColorPrivate)
+			return label.Layout(gtx)
+		})
+	})
+}
+
 func (t *tabView) drawTabBorder(gtx layout.Context, borderColor color.NRGBA) {
 	borderWidth := gtx.Dp(unit.Dp(1))
 	size := gtx.Constraints.Max
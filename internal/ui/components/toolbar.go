@@ -2,11 +2,16 @@ package components
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"image"
 	"image/color"
+	"math"
 	"net/url"
 	"strings"
+	"time"
 
+	"gioui.org/io/key"
 	"gioui.org/layout"
 	"gioui.org/op/clip"
 	"gioui.org/op/paint"
@@ -23,26 +28,54 @@ type Toolbar interface {
 }
 
 type toolbar struct {
-	engine        browser.Engine
-	urlEditor     *widget.Editor
-	progress      float32
-	goButton      *widget.Clickable
-	backButton    *widget.Clickable
-	forwardButton *widget.Clickable
-	refreshButton *widget.Clickable
-	lastTabIndex  int
-	lastTabURL    string
+	engine          browser.Engine
+	urlEditor       *widget.Editor
+	progress        float32
+	goButton        *widget.Clickable
+	backButton      *widget.Clickable
+	forwardButton   *widget.Clickable
+	refreshButton   *widget.Clickable
+	stopButton      *widget.Clickable
+	blockerButton   *widget.Clickable
+	securityButton  *widget.Clickable
+	downloadsButton *widget.Clickable
+	resubmitButton  *widget.Clickable
+	keepPageButton  *widget.Clickable
+	stayButton      *widget.Clickable
+	certificates    CertificateViewer
+	downloads       DownloadsPanel
+	downloadCount   int
+	lastTabIndex    int
+	lastTabURL      string
+	// resubmitTab is the tab asking whether to resend a form, or -1
+	resubmitTab int
 }
 
 func NewToolbar(engine browser.Engine) Toolbar {
+	downloadCount := 0
+	if downloads := engine.GetDownloadManager(); downloads != nil {
+		downloadCount = len(downloads.List())
+	}
+
 	return &toolbar{
-		engine:        engine,
-		urlEditor:     &widget.Editor{SingleLine: true, Submit: true},
-		progress:      0.0,
-		goButton:      &widget.Clickable{},
-		backButton:    &widget.Clickable{},
-		forwardButton: &widget.Clickable{},
-		refreshButton: &widget.Clickable{},
+		engine:          engine,
+		urlEditor:       &widget.Editor{SingleLine: true, Submit: true},
+		progress:        0.0,
+		goButton:        &widget.Clickable{},
+		backButton:      &widget.Clickable{},
+		forwardButton:   &widget.Clickable{},
+		refreshButton:   &widget.Clickable{},
+		stopButton:      &widget.Clickable{},
+		blockerButton:   &widget.Clickable{},
+		securityButton:  &widget.Clickable{},
+		certificates:    NewCertificateViewer(),
+		downloadsButton: &widget.Clickable{},
+		resubmitButton:  &widget.Clickable{},
+		keepPageButton:  &widget.Clickable{},
+		stayButton:      &widget.Clickable{},
+		resubmitTab:     -1,
+		downloads:       NewDownloadsPanel(engine.GetDownloadManager()),
+		downloadCount:   downloadCount,
 	}
 }
 
@@ -61,6 +94,45 @@ func (t *toolbar) GetProgress() float32 {
 }
 
 func (t *toolbar) Render(gtx layout.Context, theme *material.Theme, currTabIdx int) layout.Dimensions {
+	return layout.Flex{Axis: layout.Vertical}.Layout(gtx,
+		layout.Rigid(func(gtx layout.Context) layout.Dimensions {
+			return t.renderToolbarRow(gtx, theme, currTabIdx)
+		}),
+		layout.Rigid(func(gtx layout.Context) layout.Dimensions {
+			return t.renderResubmitPrompt(gtx, theme, currTabIdx)
+		}),
+		layout.Rigid(func(gtx layout.Context) layout.Dimensions {
+			return t.renderPendingRefresh(gtx, theme, currTabIdx)
+		}),
+		layout.Rigid(func(gtx layout.Context) layout.Dimensions {
+			var info *browser.SecurityInfo
+			if tab := t.engine.GetTab(currTabIdx); tab != nil {
+				info = tab.GetSecurityInfo()
+			}
+			return t.certificates.Render(gtx, theme, info)
+		}),
+		layout.Rigid(func(gtx layout.Context) layout.Dimensions {
+			t.syncDownloads()
+			return t.downloads.Render(gtx, theme)
+		}),
+	)
+}
+
+// syncDownloads opens the downloads panel when a download starts.
+func (t *toolbar) syncDownloads() {
+	downloads := t.engine.GetDownloadManager()
+	if downloads == nil {
+		return
+	}
+
+	count := len(downloads.List())
+	if count > t.downloadCount {
+		t.downloads.Open()
+	}
+	t.downloadCount = count
+}
+
+func (t *toolbar) renderToolbarRow(gtx layout.Context, theme *material.Theme, currTabIdx int) layout.Dimensions {
 	return layout.Flex{}.Layout(gtx, layout.Rigid(func(gtx layout.Context) layout.Dimensions {
 		return layout.Inset{
 			Top:    unit.Dp(browser.DefaultPadding),
@@ -76,6 +148,9 @@ func (t *toolbar) Render(gtx layout.Context, theme *material.Theme, currTabIdx i
 				layout.Rigid(func(gtx layout.Context) layout.Dimensions {
 					return t.renderNavigationButtons(gtx, theme, currTabIdx)
 				}),
+				layout.Rigid(func(gtx layout.Context) layout.Dimensions {
+					return t.renderSecurityButton(gtx, theme, currTabIdx)
+				}),
 				layout.Flexed(1, func(gtx layout.Context) layout.Dimensions {
 					return t.renderURLBarWithProgress(gtx, theme, currTabIdx)
 				}),
@@ -88,6 +163,10 @@ func (t *toolbar) Render(gtx layout.Context, theme *material.Theme, currTabIdx i
 }
 
 func (t *toolbar) renderURLBarWithProgress(gtx layout.Context, theme *material.Theme, currTabIdx int) layout.Dimensions {
+	retryLabel := t.syncRetryProgress(currTabIdx)
+	mixedLabel, mixedColor := t.mixedContentStatus(currTabIdx)
+	cspLabel := t.cspStatus(currTabIdx)
+
 	return layout.Flex{Axis: layout.Vertical}.Layout(gtx,
 		layout.Rigid(func(gtx layout.Context) layout.Dimensions {
 			return t.renderURLBar(gtx, theme, currTabIdx)
@@ -98,9 +177,92 @@ func (t *toolbar) renderURLBarWithProgress(gtx layout.Context, theme *material.T
 			}
 			return layout.Dimensions{}
 		}),
+		layout.Rigid(func(gtx layout.Context) layout.Dimensions {
+			if retryLabel == "" {
+				return layout.Dimensions{}
+			}
+			return layout.Inset{Left: unit.Dp(browser.DefaultSpacing)}.Layout(gtx,
+				material.Caption(theme, retryLabel).Layout)
+		}),
+		layout.Rigid(func(gtx layout.Context) layout.Dimensions {
+			if mixedLabel == "" {
+				return layout.Dimensions{}
+			}
+			label := material.Caption(theme, mixedLabel)
+			label.Color = mixedColor
+			return layout.Inset{Left: unit.Dp(browser.DefaultSpacing)}.Layout(gtx, label.Layout)
+		}),
+		layout.Rigid(func(gtx layout.Context) layout.Dimensions {
+			if cspLabel == "" {
+				return layout.Dimensions{}
+			}
+			label := material.Caption(theme, cspLabel)
+			label.Color = color.NRGBA{R: 0xD9, G: 0x30, B: 0x25, A: 0xFF}
+			return layout.Inset{Left: unit.Dp(browser.DefaultSpacing)}.Layout(gtx, label.Layout)
+		}),
 	)
 }
 
+// cspStatus counts the resources the current page's Content-Security-Policy
+// blocked. Report-only violations blocked nothing, so they are left out.
+func (t *toolbar) cspStatus(currTabIdx int) string {
+	tab := t.engine.GetTab(currTabIdx)
+	if tab == nil || tab.IsLoading() || tab.GetDocument() == nil {
+		return ""
+	}
+
+	blocked := 0
+	for _, violation := range tab.GetDocument().GetCSPViolations() {
+		if !violation.ReportOnly {
+			blocked++
+		}
+	}
+	if blocked == 0 {
+		return ""
+	}
+	return fmt.Sprintf(CSPBlockedText, blocked)
+}
+
+// mixedContentStatus describes the insecure content the current page referred
+// to: blocked content first, then content loaded over http anyway.
+func (t *toolbar) mixedContentStatus(currTabIdx int) (string, color.NRGBA) {
+	tab := t.engine.GetTab(currTabIdx)
+	if tab == nil || tab.IsLoading() || tab.GetDocument() == nil {
+		return "", color.NRGBA{}
+	}
+
+	report := tab.GetDocument().GetMixedContent()
+	switch {
+	case len(report.Blocked) > 0:
+		return fmt.Sprintf(MixedContentBlockedText, len(report.Blocked)), color.NRGBA{R: 0xD9, G: 0x30, B: 0x25, A: 0xFF}
+	case len(report.Warned) > 0:
+		return fmt.Sprintf(MixedContentWarningText, len(report.Warned)), color.NRGBA{R: 0xB0, G: 0x60, B: 0x00, A: 0xFF}
+	default:
+		return "", color.NRGBA{}
+	}
+}
+
+// syncRetryProgress advances the progress bar as the page load is retried,
+// giving each attempt an equal share of what is left after the first, and
+// returns a label describing the retry.
+func (t *toolbar) syncRetryProgress(currTabIdx int) string {
+	tab := t.engine.GetTab(currTabIdx)
+	if tab == nil || !tab.IsLoading() {
+		return ""
+	}
+
+	attempt, maxAttempts := tab.GetLoadAttempt()
+	if attempt < 2 || maxAttempts < 1 {
+		return ""
+	}
+
+	progress := RetryProgressStart + (1-RetryProgressStart)*float32(attempt-1)/float32(maxAttempts)
+	if progress > t.progress {
+		t.SetProgress(progress)
+	}
+	return fmt.Sprintf(RetryingText, attempt, maxAttempts)
+}
+
 func (t *toolbar) renderURLBar(gtx layout.Context, theme *material.Theme, currTabIdx int) layout.Dimensions {
 	tab := t.engine.GetTab(currTabIdx)
 
@@ -186,6 +348,9 @@ func (t *toolbar) renderNavigationButtons(gtx layout.Context, theme *material.Th
 			return t.renderForwardButton(gtx, theme, currTabIdx, canGoNext)
 		}),
 		layout.Rigid(func(gtx layout.Context) layout.Dimensions {
+			if tab := t.engine.GetTab(currTabIdx); tab != nil && tab.IsLoading() {
+				return t.renderStopButton(gtx, theme, currTabIdx)
+			}
 			return t.renderRefreshButton(gtx, theme, currTabIdx)
 		}),
 	)
@@ -222,24 +387,221 @@ func (t *toolbar) renderForwardButton(gtx layout.Context, theme *material.Theme,
 }
 
 func (t *toolbar) renderRefreshButton(gtx layout.Context, theme *material.Theme, currTabIdx int) layout.Dimensions {
-	if t.refreshButton.Clicked(gtx) {
-		t.engine.RefreshTab(currTabIdx)
+	if click, ok := t.refreshButton.Update(gtx); ok {
+		// Shift-click bypasses the cache, like Ctrl+Shift+R in other browsers
+		reloadType := browser.ReloadNormal
+		if click.Modifiers.Contain(key.ModShift) {
+			reloadType = browser.ReloadBypassCache
+		}
+
+		t.reload(currTabIdx, reloadType)
+	}
+
+	btn := material.Button(theme, t.refreshButton, "⟳")
+	return btn.Layout(gtx)
+}
+
+func (t *toolbar) renderStopButton(gtx layout.Context, theme *material.Theme, currTabIdx int) layout.Dimensions {
+	if t.stopButton.Clicked(gtx) {
+		if err := t.engine.StopLoading(currTabIdx); err == nil {
+			t.SetProgress(0.0)
+		}
+	}
+
+	btn := material.Button(theme, t.stopButton, "✕")
+	return btn.Layout(gtx)
+}
+
+// reload refreshes the tab. A page that was the result of a form POST is
+// not reloaded until the user confirms sending the form again.
+func (t *toolbar) reload(currTabIdx int, reloadType browser.ReloadType) {
+	if tab := t.engine.GetTab(currTabIdx); tab != nil && tab.GetFormSubmission() != nil {
+		t.resubmitTab = currTabIdx
+		return
+	}
+
+	t.SetProgress(0.1)
+	go func() {
+		t.finishProgress(t.engine.RefreshTab(currTabIdx, reloadType))
+	}()
+}
+
+// renderResubmitPrompt asks whether to reload a page by resending the form
+// that produced it.
+func (t *toolbar) renderResubmitPrompt(gtx layout.Context, theme *material.Theme, currTabIdx int) layout.Dimensions {
+	if t.resubmitTab != currTabIdx {
+		return layout.Dimensions{}
+	}
+	// The prompt no longer applies once the tab has moved on
+	tab := t.engine.GetTab(currTabIdx)
+	if tab == nil || tab.GetFormSubmission() == nil {
+		t.resubmitTab = -1
+		return layout.Dimensions{}
+	}
+
+	if t.resubmitButton.Clicked(gtx) {
+		t.resubmitTab = -1
 		t.SetProgress(0.1)
 		go func() {
-			t.SetProgress(1.0)
+			ctx, cancel := context.WithTimeout(context.Background(), browser.DefaultTimeout)
+			defer cancel()
+
+			t.finishProgress(t.engine.ResubmitForm(ctx, currTabIdx))
 		}()
+		return layout.Dimensions{}
+	}
+	if t.keepPageButton.Clicked(gtx) {
+		t.resubmitTab = -1
+		return layout.Dimensions{}
 	}
 
-	btn := material.Button(theme, t.refreshButton, "⟳")
-	return btn.Layout(gtx)
+	return layout.UniformInset(unit.Dp(browser.DefaultPadding)).Layout(gtx, func(gtx layout.Context) layout.Dimensions {
+		return layout.Flex{Alignment: layout.Middle}.Layout(gtx,
+			layout.Flexed(1, material.Body2(theme, FormResubmissionText).Layout),
+			layout.Rigid(func(gtx layout.Context) layout.Dimensions {
+				return layout.Inset{Left: unit.Dp(browser.ButtonSpacing)}.Layout(gtx,
+					material.Button(theme, t.resubmitButton, ResubmitFormText).Layout)
+			}),
+			layout.Rigid(func(gtx layout.Context) layout.Dimensions {
+				return layout.Inset{Left: unit.Dp(browser.ButtonSpacing)}.Layout(gtx,
+					material.Button(theme, t.keepPageButton, CancelResubmitText).Layout)
+			}),
+		)
+	})
+}
+
+// renderPendingRefresh counts down to the redirect or reload the page asked
+// for, offering to stay on the page instead.
+func (t *toolbar) renderPendingRefresh(gtx layout.Context, theme *material.Theme, currTabIdx int) layout.Dimensions {
+	refresh := t.engine.GetPendingRefresh(currTabIdx)
+	if refresh == nil {
+		return layout.Dimensions{}
+	}
+
+	if t.stayButton.Clicked(gtx) {
+		t.engine.CancelRefresh(currTabIdx)
+		return layout.Dimensions{}
+	}
+
+	seconds := int(math.Ceil(time.Until(refresh.At).Seconds()))
+	text := fmt.Sprintf(ReloadPendingText, max(seconds, 0))
+	if !refresh.Reload {
+		text = fmt.Sprintf(RedirectPendingText, refresh.URL, max(seconds, 0))
+	}
+
+	return layout.UniformInset(unit.Dp(browser.DefaultPadding)).Layout(gtx, func(gtx layout.Context) layout.Dimensions {
+		return layout.Flex{Alignment: layout.Middle}.Layout(gtx,
+			layout.Flexed(1, material.Body2(theme, text).Layout),
+			layout.Rigid(func(gtx layout.Context) layout.Dimensions {
+				return layout.Inset{Left: unit.Dp(browser.ButtonSpacing)}.Layout(gtx,
+					material.Button(theme, t.stayButton, StayOnPageText).Layout)
+			}),
+		)
+	})
+}
+
+// finishProgress completes the progress bar for a finished navigation. A
+// navigation that was stopped or superseded leaves it to whatever replaced it.
+func (t *toolbar) finishProgress(err error) {
+	switch {
+	case err == nil:
+		t.SetProgress(1.0)
+	case errors.Is(err, browser.ErrRequestCancelled):
+	default:
+		t.SetProgress(0.0)
+	}
 }
 
 func (t *toolbar) renderActionButtons(gtx layout.Context, theme *material.Theme, currTabIdx int) layout.Dimensions {
 	if t.goButton.Clicked(gtx) {
 		go t.handleNavigate(currTabIdx)
 	}
+	if t.downloadsButton.Clicked(gtx) {
+		t.downloads.Toggle()
+	}
 
-	btn := material.Button(theme, t.goButton, "Go")
+	return layout.Flex{
+		Axis:    layout.Horizontal,
+		Spacing: layout.SpaceAround,
+	}.Layout(gtx,
+		layout.Rigid(func(gtx layout.Context) layout.Dimensions {
+			return t.renderBlockerButton(gtx, theme, currTabIdx)
+		}),
+		layout.Rigid(func(gtx layout.Context) layout.Dimensions {
+			return layout.Inset{Left: unit.Dp(browser.ButtonSpacing)}.Layout(gtx,
+				material.Button(theme, t.downloadsButton, DownloadsButtonText).Layout)
+		}),
+		layout.Rigid(func(gtx layout.Context) layout.Dimensions {
+			return layout.Inset{Left: unit.Dp(browser.ButtonSpacing)}.Layout(gtx,
+				material.Button(theme, t.goButton, "Go").Layout)
+		}),
+	)
+}
+
+// renderSecurityButton shows whether the page was loaded securely. For https
+// pages it opens the certificate viewer.
+func (t *toolbar) renderSecurityButton(gtx layout.Context, theme *material.Theme, currTabIdx int) layout.Dimensions {
+	tab := t.engine.GetTab(currTabIdx)
+	if tab == nil {
+		return layout.Dimensions{}
+	}
+
+	info := tab.GetSecurityInfo()
+	label := securityIndicator(tab.GetURL(), info)
+	if label == "" {
+		return layout.Dimensions{}
+	}
+
+	if t.securityButton.Clicked(gtx) && info != nil {
+		t.certificates.Toggle()
+	}
+
+	btn := material.Button(theme, t.securityButton, label)
+	btn.Background = t.securityColor(info)
+	return layout.Inset{Left: unit.Dp(browser.ButtonSpacing)}.Layout(gtx, btn.Layout)
+}
+
+func (t *toolbar) securityColor(info *browser.SecurityInfo) color.NRGBA {
+	switch {
+	case info != nil && info.Verified:
+		return color.NRGBA{R: 0x1E, G: 0x8E, B: 0x3E, A: 0xFF}
+	default:
+		return color.NRGBA{R: 0xD9, G: 0x30, B: 0x25, A: 0xFF}
+	}
+}
+
+// renderBlockerButton shows how many requests were blocked in the tab.
+// Clicking it turns blocking off or back on for the current site.
+func (t *toolbar) renderBlockerButton(gtx layout.Context, theme *material.Theme, currTabIdx int) layout.Dimensions {
+	tab := t.engine.GetTab(currTabIdx)
+	blocker := t.engine.GetContentBlocker()
+	if tab == nil || blocker == nil {
+		return layout.Dimensions{}
+	}
+
+	pageURL := tab.GetURL()
+	allowed := blocker.IsSiteAllowed(pageURL)
+
+	if t.blockerButton.Clicked(gtx) && pageURL != "" {
+		if allowed {
+			blocker.DisallowSite(pageURL)
+		} else {
+			blocker.AllowSite(pageURL)
+		}
+		allowed = !allowed
+
+		t.reload(currTabIdx, browser.ReloadNormal)
+	}
+
+	label := fmt.Sprintf(BlockerButtonText, blocker.BlockedCount(tab.GetID()))
+	if allowed {
+		label = BlockerOffText
+	}
+
+	btn := material.Button(theme, t.blockerButton, label)
+	if allowed {
+		btn.Background = color.NRGBA{R: 200, G: 200, B: 200, A: 255}
+	}
 	return btn.Layout(gtx)
 }
 
@@ -269,18 +631,14 @@ func (t *toolbar) handleNavigate(currTabIdx int) {
 		defer cancel()
 
 		t.SetProgress(0.3)
-		if err := t.engine.Navigate(ctx, currTabIdx, navigationURL); err == nil {
-			t.SetProgress(1.0)
-		} else {
-			t.SetProgress(0.0)
-		}
+		t.finishProgress(t.engine.Navigate(ctx, currTabIdx, navigationURL))
 	}()
 }
 
 func (t *toolbar) resolveNavigationURL(input, currentURL string) string {
 	input = strings.TrimSpace(input)
 
-	if strings.Contains(input, "://") {
+	if t.engine.GetURLHandler().IsAbsoluteURL(input) {
 		return input
 	}
 
@@ -31,10 +31,10 @@ type mainWindow struct {
 	contentRenderer components.Content
 }
 
-func NewMainWindow(isDebugMode bool) MainWindow {
+func NewMainWindow(isDebugMode bool, engineOpts ...browser.EngineOption) MainWindow {
 	window := createAppWindow()
 
-	engine := browser.NewEngine()
+	engine := browser.NewEngine(engineOpts...)
 	engine.SetDebugMode(isDebugMode)
 	engine.AddTab()
 
@@ -103,6 +103,9 @@ func (mw *mainWindow) runEventLoop() {
 }
 
 func (mw *mainWindow) handleDestroyEvent(e app.DestroyEvent) {
+	if err := mw.engine.Shutdown(); err != nil {
+		log.Printf("Failed to save browser state: %v", err)
+	}
 	if e.Err != nil {
 		log.Fatalf("Window destroy error: %v", e.Err)
 	}
@@ -117,6 +120,8 @@ func (mw *mainWindow) handleFrameEvent(ops *op.Ops, e app.FrameEvent) {
 }
 
 func (mw *mainWindow) render(gtx layout.Context) layout.Dimensions {
+	mw.engine.SetActiveTab(mw.tabView.GetCurrentTabIndex())
+
 	return layout.Flex{Axis: layout.Vertical}.Layout(gtx,
 		layout.Rigid(func(gtx layout.Context) layout.Dimensions {
 			return mw.tabView.Render(gtx, mw.theme)